@@ -5,7 +5,7 @@ go 1.24.2
 require (
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/go-telegram/bot v1.17.0
-	github.com/justinian/dice v1.0.3
+	go.etcd.io/bbolt v1.4.3
 	google.golang.org/genai v1.24.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/gtrindade/ultra-kiew/internal/config"
+)
+
+// Role is what a user is allowed to do with the bot. Higher roles include
+// the permissions of lower ones.
+type Role int
+
+const (
+	// RolePlayer is the role of everyone in a chat.
+	RolePlayer Role = iota
+	// RoleGM is the role of the game masters of a chat.
+	RoleGM
+	// RoleOwner is the role of the people running the bot.
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleOwner:
+		return "owner"
+	case RoleGM:
+		return "GM"
+	default:
+		return "player"
+	}
+}
+
+// Allows tells whether the role grants the permissions of required.
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// Identity is the user on whose behalf the bot is acting, and the chat they
+// are acting in.
+type Identity struct {
+	ChatID   int64
+	UserID   int64
+	UserName string
+	Role     Role
+}
+
+type identityKey struct{}
+
+// RoleOf returns the role of a user in a chat according to the configuration.
+func RoleOf(cfg *config.Config, chatID, userID int64) Role {
+	if cfg == nil || cfg.Roles == nil {
+		return RolePlayer
+	}
+	if slices.Contains(cfg.Roles.Owners, userID) {
+		return RoleOwner
+	}
+	if slices.Contains(cfg.Roles.GameMasters[chatID], userID) {
+		return RoleGM
+	}
+	return RolePlayer
+}
+
+// GameMasters returns the user IDs of the game masters of a chat.
+func GameMasters(cfg *config.Config, chatID int64) []int64 {
+	if cfg == nil || cfg.Roles == nil {
+		return nil
+	}
+	return cfg.Roles.GameMasters[chatID]
+}
+
+// WithIdentity returns a context carrying identity.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity carried by ctx. Without one, the
+// caller is treated as an anonymous player.
+func IdentityFromContext(ctx context.Context) Identity {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	if !ok {
+		return Identity{Role: RolePlayer}
+	}
+	return identity
+}
+
+// Require returns an error explaining why the caller in ctx can't perform
+// action if they don't have the required role.
+func Require(ctx context.Context, required Role, action string) error {
+	identity := IdentityFromContext(ctx)
+	if identity.Role.Allows(required) {
+		return nil
+	}
+	name := identity.UserName
+	if name == "" {
+		name = "This user"
+	}
+	return fmt.Errorf("%s needs the %s role to %s", name, required, action)
+}
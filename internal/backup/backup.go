@@ -0,0 +1,532 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+const (
+	// DefaultDirectory is where snapshots are written unless configured.
+	DefaultDirectory = "backups"
+
+	// DefaultInterval is how often a snapshot is taken unless configured.
+	DefaultInterval = 24 * time.Hour
+
+	// DefaultKeep is how many snapshots are kept unless configured.
+	DefaultKeep = 7
+
+	// ManifestName is the name of the entry listing the files of a snapshot.
+	ManifestName = "manifest.json"
+
+	// ManifestVersion is the version of the format of snapshots.
+	ManifestVersion = 1
+
+	filePrefix = "backup-"
+	fileSuffix = ".tar.gz"
+	// encryptedSuffix is added to the name of snapshots encrypted with the
+	// storage encryption key.
+	encryptedSuffix = ".enc"
+	timeFormat      = "20060102-150405"
+)
+
+// Manifest lists the files of a snapshot with their SHA-256 checksums, so a
+// snapshot can be validated before it is restored.
+type Manifest struct {
+	Version int               `json:"version"`
+	Time    time.Time         `json:"time"`
+	Files   map[string]string `json:"files"`
+}
+
+// Snapshot is an archive of the bot state.
+type Snapshot struct {
+	Name  string
+	Time  time.Time
+	Size  int64
+	Files int
+}
+
+// String renders the snapshot like "backup-20240501-201500.tar.gz (12.3 KB)".
+func (s *Snapshot) String() string {
+	text := fmt.Sprintf("%s (%s", s.Name, formatSize(s.Size))
+	if s.Files > 0 {
+		text += fmt.Sprintf(", %d files", s.Files)
+	}
+	return text + ")"
+}
+
+// Manager takes, lists and restores snapshots of the data the storage client
+// keeps under storage.DBPath. Snapshots are encrypted when the storage is.
+type Manager struct {
+	storage  *storage.Client
+	cipher   *storage.Cipher
+	dir      string
+	interval time.Duration
+	keep     int
+	// lock serializes taking, pruning and restoring snapshots.
+	lock sync.Mutex
+}
+
+// NewManager creates a Manager configured by cfg, which may be nil.
+func NewManager(cfg *config.BackupConfig, storageClient *storage.Client) (*Manager, error) {
+	m := &Manager{
+		storage:  storageClient,
+		cipher:   storage.CipherOf(storageClient.Store()),
+		dir:      DefaultDirectory,
+		interval: DefaultInterval,
+		keep:     DefaultKeep,
+	}
+	if cfg == nil {
+		return m, nil
+	}
+
+	if cfg.Directory != "" {
+		m.dir = cfg.Directory
+	}
+	if cfg.Interval != "" {
+		interval, err := time.ParseDuration(cfg.Interval)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid backup interval %q, use a duration like 6h or 0 to disable it", cfg.Interval)
+		}
+		m.interval = interval
+	}
+	if cfg.Keep < 0 {
+		return nil, fmt.Errorf("invalid number of backups to keep: %d", cfg.Keep)
+	}
+	if cfg.Keep > 0 {
+		m.keep = cfg.Keep
+	}
+	return m, nil
+}
+
+// Run takes a snapshot every interval until ctx is done. It returns right
+// away when scheduled snapshots are disabled.
+func (m *Manager) Run(ctx context.Context) {
+	if m.interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			snapshot, err := m.Create()
+			if err != nil {
+				fmt.Printf("Failed to back up the bot state: %v\n", err)
+				continue
+			}
+			fmt.Printf("Backed up the bot state to %s\n", snapshot)
+		}
+	}
+}
+
+// Create writes a snapshot of the current state, then removes the oldest
+// snapshots beyond the ones to keep.
+func (m *Manager) Create() (*Snapshot, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	snapshot, err := m.create()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.prune(); err != nil {
+		fmt.Printf("Failed to remove old backups: %v\n", err)
+	}
+	return snapshot, nil
+}
+
+func (m *Manager) create() (*Snapshot, error) {
+	if err := m.storage.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to save pending data: %w", err)
+	}
+
+	// Read everything in one transaction, so the snapshot is consistent.
+	files := make(map[string][]byte)
+	err := m.storage.Store().Update(func(tx storage.Tx) error {
+		keys, err := tx.List(storage.DBPath + "/")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if files[key], err = tx.Get(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bot state: %w", err)
+	}
+
+	var archive bytes.Buffer
+	now := time.Now()
+	if err := writeArchive(&archive, now, files); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	data := archive.Bytes()
+
+	name := filePrefix + now.UTC().Format(timeFormat) + fileSuffix
+	if m.cipher != nil {
+		name += encryptedSuffix
+		data = m.cipher.Seal(data)
+	}
+	filePath := filepath.Join(m.dir, name)
+	if _, err := os.Stat(filePath); err == nil {
+		return nil, fmt.Errorf("backup %s already exists, try again in a second", name)
+	}
+	if err := m.writeFile(name, data); err != nil {
+		return nil, err
+	}
+	return &Snapshot{Name: name, Time: now, Size: int64(len(data)), Files: len(files)}, nil
+}
+
+// writeFile writes data to a temporary file that then replaces the snapshot
+// with the specified name.
+func (m *Manager) writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create backup directory %s: %w", m.dir, err)
+	}
+
+	filePath := filepath.Join(m.dir, name)
+	file, err := os.CreateTemp(m.dir, name+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", filePath, err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", file.Name(), err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file %s: %w", file.Name(), err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", file.Name(), err)
+	}
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// writeArchive writes files and their manifest as a gzipped tarball.
+func writeArchive(w io.Writer, now time.Time, files map[string][]byte) error {
+	manifest := &Manifest{Version: ManifestVersion, Time: now, Files: make(map[string]string)}
+	for key, value := range files {
+		manifest.Files[key] = checksum(value)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: now}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := archive.Write(data)
+		return err
+	}
+
+	if err := add(ManifestName, manifestData); err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(files)) {
+		if err := add(key, files[key]); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// prune removes the oldest snapshots beyond the ones to keep.
+func (m *Manager) prune() error {
+	snapshots, err := m.Snapshots()
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots[min(m.keep, len(snapshots)):] {
+		if err := os.Remove(filepath.Join(m.dir, snapshot.Name)); err != nil {
+			return fmt.Errorf("failed to remove backup %s: %w", snapshot.Name, err)
+		}
+		fmt.Printf("Removed old backup %s\n", snapshot.Name)
+	}
+	return nil
+}
+
+// Snapshots lists the snapshots, newest first.
+func (m *Manager) Snapshots() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list backups in %s: %w", m.dir, err)
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		taken, valid := parseName(name)
+		if !valid || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat backup %s: %w", name, err)
+		}
+		snapshots = append(snapshots, &Snapshot{Name: name, Time: taken, Size: info.Size()})
+	}
+	slices.SortFunc(snapshots, func(a, b *Snapshot) int {
+		return b.Time.Compare(a.Time)
+	})
+	return snapshots, nil
+}
+
+// parseName returns the time in the name of a snapshot, telling whether it is
+// the name of a snapshot.
+func parseName(name string) (time.Time, bool) {
+	stamp, found := strings.CutPrefix(name, filePrefix)
+	stamp = strings.TrimSuffix(stamp, encryptedSuffix)
+	stamp, suffixed := strings.CutSuffix(stamp, fileSuffix)
+	if !found || !suffixed {
+		return time.Time{}, false
+	}
+	taken, err := time.Parse(timeFormat, stamp)
+	return taken, err == nil
+}
+
+// read returns the archive of a snapshot, decrypting it if needed.
+func (m *Manager) read(name string) ([]byte, error) {
+	if _, valid := parseName(name); !valid || name != filepath.Base(name) {
+		return nil, fmt.Errorf("invalid backup name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(m.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", name, err)
+	}
+	if !strings.HasSuffix(name, encryptedSuffix) {
+		return data, nil
+	}
+
+	if m.cipher == nil {
+		return nil, fmt.Errorf("backup %s is encrypted, set the storage encryption key to read it", name)
+	}
+	data, err = m.cipher.Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// Reencrypt encrypts every snapshot again with the current storage encryption
+// key, including those taken before encryption was enabled, and returns how
+// many there were.
+func (m *Manager) Reencrypt() (int, error) {
+	if m.cipher == nil {
+		return 0, fmt.Errorf("the storage encryption key is not set")
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	snapshots, err := m.Snapshots()
+	if err != nil {
+		return 0, err
+	}
+	for _, snapshot := range snapshots {
+		data, err := m.read(snapshot.Name)
+		if err != nil {
+			return 0, err
+		}
+		name := strings.TrimSuffix(snapshot.Name, encryptedSuffix) + encryptedSuffix
+		if err := m.writeFile(name, m.cipher.Seal(data)); err != nil {
+			return 0, err
+		}
+		if name != snapshot.Name {
+			if err := os.Remove(filepath.Join(m.dir, snapshot.Name)); err != nil {
+				return 0, fmt.Errorf("failed to remove unencrypted backup %s: %w", snapshot.Name, err)
+			}
+		}
+	}
+	return len(snapshots), nil
+}
+
+// Validate reads a snapshot, checking every file against its manifest and
+// that the JSON files decode, and returns its files.
+func (m *Manager) Validate(name string) (map[string][]byte, error) {
+	data, err := m.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("backup %s is not a gzip archive: %w", name, err)
+	}
+	archive := tar.NewReader(gz)
+
+	var manifest *Manifest
+	files := make(map[string][]byte)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup %s is corrupted: %w", name, err)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("backup %s is corrupted: %w", name, err)
+		}
+
+		if header.Name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("backup %s has an invalid manifest: %w", name, err)
+			}
+			continue
+		}
+		if path.Clean(header.Name) != header.Name || !strings.HasPrefix(header.Name, storage.DBPath+"/") {
+			return nil, fmt.Errorf("backup %s has an unexpected file %s", name, header.Name)
+		}
+		files[header.Name] = data
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("backup %s has no manifest", name)
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("backup %s has unsupported version %d", name, manifest.Version)
+	}
+	for key, sum := range manifest.Files {
+		data, exists := files[key]
+		if !exists {
+			return nil, fmt.Errorf("backup %s is missing %s", name, key)
+		}
+		if checksum(data) != sum {
+			return nil, fmt.Errorf("backup %s has a corrupted %s", name, key)
+		}
+		if err := validateJSON(key, data); err != nil {
+			return nil, fmt.Errorf("backup %s has an invalid %s: %w", name, key, err)
+		}
+	}
+	if len(files) != len(manifest.Files) {
+		return nil, fmt.Errorf("backup %s has files missing from its manifest", name)
+	}
+	return files, nil
+}
+
+// validateJSON checks that a file holds JSON, or JSON lines for ".jsonl" files.
+func validateJSON(key string, data []byte) error {
+	if !strings.HasSuffix(key, ".jsonl") {
+		if !json.Valid(data) {
+			return fmt.Errorf("not valid JSON")
+		}
+		return nil
+	}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 && !json.Valid(line) {
+			return fmt.Errorf("line %d is not valid JSON", i+1)
+		}
+	}
+	return nil
+}
+
+// Restore validates a snapshot and replaces the current state with it, after
+// taking a snapshot of the current state. It returns that snapshot, so the
+// restore can be undone. The bot must not be running.
+func (m *Manager) Restore(name string) (*Snapshot, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	files, err := m.Validate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := m.create()
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up the current state before restoring: %w", err)
+	}
+
+	err = m.storage.Store().Update(func(tx storage.Tx) error {
+		keys, err := tx.List(storage.DBPath + "/")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(files)) {
+			if !strings.HasSuffix(key, ".jsonl") {
+				if err := tx.Put(key, files[key]); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, line := range bytes.Split(files[key], []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				if err := tx.Append(key, line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore backup %s: %w", name, err)
+	}
+	return current, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// formatSize renders a number of bytes like "12.3 KB".
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
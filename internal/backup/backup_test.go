@@ -0,0 +1,255 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+// oldName is the name of a snapshot taken long ago. Snapshot names only have
+// second precision, so tests move snapshots out of the way of the next one.
+const oldName = "backup-20200101-000000.tar.gz"
+
+func newTestManager(t *testing.T, store storage.Store, cfg *config.BackupConfig) *Manager {
+	t.Helper()
+	storageClient := storage.NewClient(store)
+	t.Cleanup(func() {
+		if err := storageClient.Close(); err != nil {
+			t.Errorf("failed to close storage: %v", err)
+		}
+	})
+	if cfg == nil {
+		cfg = &config.BackupConfig{}
+	}
+	cfg.Directory = t.TempDir()
+	manager, err := NewManager(cfg, storageClient)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	return manager
+}
+
+// state returns every value under storage.DBPath, reading lines one by one.
+func state(t *testing.T, store storage.Store) map[string]string {
+	t.Helper()
+	keys, err := store.List(storage.DBPath + "/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	values := make(map[string]string)
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".jsonl") {
+			var lines []string
+			err := store.Lines(key, func(line []byte) error {
+				lines = append(lines, string(line))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Lines(%q) error = %v", key, err)
+			}
+			values[key] = strings.Join(lines, "|")
+			continue
+		}
+		value, err := store.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", key, err)
+		}
+		values[key] = string(value)
+	}
+	return values
+}
+
+func put(t *testing.T, store storage.Store, values map[string]string) {
+	t.Helper()
+	for key, value := range values {
+		if err := store.Put(key, []byte(value)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+}
+
+func appendLines(t *testing.T, store storage.Store, key string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if err := store.Append(key, []byte(line)); err != nil {
+			t.Fatalf("Append(%q) error = %v", key, err)
+		}
+	}
+}
+
+// snapshot takes a snapshot and moves it to oldName.
+func snapshot(t *testing.T, manager *Manager) {
+	t.Helper()
+	created, err := manager.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	name := oldName
+	if strings.HasSuffix(created.Name, encryptedSuffix) {
+		name += encryptedSuffix
+	}
+	err = os.Rename(filepath.Join(manager.dir, created.Name), filepath.Join(manager.dir, name))
+	if err != nil {
+		t.Fatalf("failed to rename the snapshot: %v", err)
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	key := storage.GenerateKey()
+	for name, open := range map[string]func(t *testing.T) storage.Store{
+		"file": func(t *testing.T) storage.Store { return storage.NewFileStore(t.TempDir()) },
+		"bolt": func(t *testing.T) storage.Store {
+			store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "state.db"))
+			if err != nil {
+				t.Fatalf("OpenBoltStore() error = %v", err)
+			}
+			return store
+		},
+		"encrypted": func(t *testing.T) storage.Store {
+			crypt, err := storage.NewCipher(key, nil)
+			if err != nil {
+				t.Fatalf("NewCipher() error = %v", err)
+			}
+			return storage.NewEncryptedStore(storage.NewFileStore(t.TempDir()), crypt)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			manager := newTestManager(t, store, nil)
+			put(t, store, map[string]string{"db/chat-data-1.json": `{"version":2}`, "db/settings.json": `{"a":1}`})
+			appendLines(t, store, "db/rolls-1.jsonl", `{"n":1}`, `{"n":2}`)
+			want := state(t, store)
+
+			snapshot(t, manager)
+			put(t, store, map[string]string{"db/chat-data-1.json": `{"version":2,"changed":true}`, "db/new.json": `{}`})
+			appendLines(t, store, "db/rolls-1.jsonl", `{"n":3}`)
+			changed := state(t, store)
+
+			snapshots, err := manager.Snapshots()
+			if err != nil || len(snapshots) != 1 {
+				t.Fatalf("Snapshots() = %v, %v, want the snapshot", snapshots, err)
+			}
+
+			current, err := manager.Restore(snapshots[0].Name)
+			if err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			if got := state(t, store); !reflect.DeepEqual(got, want) {
+				t.Errorf("state after Restore() = %v, want %v", got, want)
+			}
+
+			// The state replaced by the restore was kept, so it can be undone.
+			files, err := manager.Validate(current.Name)
+			if err != nil {
+				t.Fatalf("Validate() of the snapshot taken before restoring error = %v", err)
+			}
+			if len(files) != len(changed) || string(files["db/new.json"]) != changed["db/new.json"] {
+				t.Errorf("snapshot taken before restoring has %v, want %v", files, changed)
+			}
+		})
+	}
+}
+
+func TestEncryptedSnapshots(t *testing.T) {
+	crypt, err := storage.NewCipher(storage.GenerateKey(), nil)
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	store := storage.NewEncryptedStore(storage.NewFileStore(t.TempDir()), crypt)
+	manager := newTestManager(t, store, nil)
+	put(t, store, map[string]string{"db/secret.json": `{"gm":"plans"}`})
+
+	created, err := manager.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasSuffix(created.Name, encryptedSuffix) {
+		t.Errorf("Create() = %s, want an encrypted snapshot", created.Name)
+	}
+	data, err := os.ReadFile(filepath.Join(manager.dir, created.Name))
+	if err != nil {
+		t.Fatalf("failed to read the snapshot: %v", err)
+	}
+	if strings.Contains(string(data), "plans") || strings.Contains(string(data), ManifestName) {
+		t.Errorf("snapshot %s is readable without the key", created.Name)
+	}
+
+	// Without the key, the snapshot can't be read.
+	plain := newTestManager(t, storage.NewFileStore(t.TempDir()), nil)
+	plain.dir = manager.dir
+	if _, err := plain.Validate(created.Name); err == nil || !strings.Contains(err.Error(), "is encrypted") {
+		t.Errorf("Validate() without the key error = %v, want it to ask for the key", err)
+	}
+}
+
+func TestValidateRejectsCorruptedSnapshots(t *testing.T) {
+	store := storage.NewFileStore(t.TempDir())
+	manager := newTestManager(t, store, nil)
+	put(t, store, map[string]string{"db/a.json": `{"a":1}`})
+	snapshot(t, manager)
+
+	path := filepath.Join(manager.dir, oldName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the snapshot: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to corrupt the snapshot: %v", err)
+	}
+
+	if _, err := manager.Restore(oldName); err == nil {
+		t.Fatalf("Restore() of a corrupted snapshot succeeded, want an error")
+	}
+	if got := state(t, store); got["db/a.json"] != `{"a":1}` {
+		t.Errorf("state after a failed restore = %v, want it unchanged", got)
+	}
+	for _, name := range []string{"../" + oldName, "state.json"} {
+		if _, err := manager.Validate(name); err == nil || !strings.Contains(err.Error(), "invalid backup name") {
+			t.Errorf("Validate(%q) error = %v, want an invalid name", name, err)
+		}
+	}
+}
+
+func TestCreateKeepsTheNewestSnapshots(t *testing.T) {
+	manager := newTestManager(t, storage.NewFileStore(t.TempDir()), &config.BackupConfig{Keep: 2})
+	for _, name := range []string{"backup-20200101-000000.tar.gz", "backup-20200102-000000.tar.gz", "backup-20200103-000000.tar.gz.enc", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(manager.dir, name), []byte("old"), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	created, err := manager.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	snapshots, err := manager.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots() error = %v", err)
+	}
+	var names []string
+	for _, snapshot := range snapshots {
+		names = append(names, snapshot.Name)
+	}
+	if want := []string{created.Name, "backup-20200103-000000.tar.gz.enc"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Snapshots() = %v, want %v", names, want)
+	}
+	if _, err := os.Stat(filepath.Join(manager.dir, "notes.txt")); err != nil {
+		t.Errorf("Create() removed a file that is not a snapshot: %v", err)
+	}
+}
+
+func TestNewManagerRejectsInvalidConfig(t *testing.T) {
+	storageClient := storage.NewClient(storage.NewFileStore(t.TempDir()))
+	defer storageClient.Close()
+	for _, cfg := range []*config.BackupConfig{{Interval: "often"}, {Interval: "-1h"}, {Keep: -1}} {
+		if _, err := NewManager(cfg, storageClient); err == nil {
+			t.Errorf("NewManager(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
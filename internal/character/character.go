@@ -0,0 +1,231 @@
+package character
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Abilities holds the six ability scores. A score of 0 means it is unknown.
+type Abilities struct {
+	Str int `json:"str,omitempty"`
+	Dex int `json:"dex,omitempty"`
+	Con int `json:"con,omitempty"`
+	Int int `json:"int,omitempty"`
+	Wis int `json:"wis,omitempty"`
+	Cha int `json:"cha,omitempty"`
+}
+
+// Saves holds the base saving throw bonuses, before ability modifiers.
+type Saves struct {
+	Fort int `json:"fort,omitempty"`
+	Ref  int `json:"ref,omitempty"`
+	Will int `json:"will,omitempty"`
+}
+
+// Item is an entry of a list with a quantity, like an inventory item or a
+// spell prepared several times.
+type Item struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// Character is the sheet of a D&D 3.5 character.
+type Character struct {
+	Name string `json:"name"`
+	// Classes holds the level of the character in each of its classes.
+	Classes   map[string]int `json:"classes,omitempty"`
+	XP        int            `json:"xp,omitempty"`
+	Abilities Abilities      `json:"abilities"`
+	HP        int            `json:"hp,omitempty"`
+	MaxHP     int            `json:"max_hp,omitempty"`
+	AC        int            `json:"ac,omitempty"`
+	BAB       int            `json:"bab,omitempty"`
+	Saves     Saves          `json:"saves"`
+	// Skills holds the ranks of the character in each skill. Cross-class
+	// skills can have half ranks.
+	Skills         map[string]float64 `json:"skills,omitempty"`
+	Feats          []string           `json:"feats,omitempty"`
+	SpellsKnown    []string           `json:"spells_known,omitempty"`
+	SpellsPrepared []*Item            `json:"spells_prepared,omitempty"`
+	Inventory      []*Item            `json:"inventory,omitempty"`
+	Gold           float64            `json:"gold,omitempty"`
+	// Properties holds anything else about the character, like roll macros or notes.
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// New creates an empty character.
+func New(name string) *Character {
+	return &Character{Name: name}
+}
+
+// Modifier returns the modifier of an ability score, or 0 for unknown scores.
+func Modifier(score int) int {
+	if score == 0 {
+		return 0
+	}
+	// Round down for odd scores below 10, like 9 giving -1.
+	if score < 10 {
+		return (score - 11) / 2
+	}
+	return (score - 10) / 2
+}
+
+// Level returns the character level, the sum of its class levels.
+func (c *Character) Level() int {
+	level := 0
+	for _, classLevel := range c.Classes {
+		level += classLevel
+	}
+	return level
+}
+
+// Fort returns the total Fortitude save.
+func (c *Character) Fort() int {
+	return c.Saves.Fort + Modifier(c.Abilities.Con)
+}
+
+// Ref returns the total Reflex save.
+func (c *Character) Ref() int {
+	return c.Saves.Ref + Modifier(c.Abilities.Dex)
+}
+
+// Will returns the total Will save.
+func (c *Character) Will() int {
+	return c.Saves.Will + Modifier(c.Abilities.Wis)
+}
+
+// Initiative returns the initiative modifier, which is the Dexterity modifier
+// unless overridden by an "initiative" property.
+func (c *Character) Initiative() int {
+	if value, exists := c.Properties["initiative"]; exists {
+		if initiative, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return initiative
+		}
+	}
+	return Modifier(c.Abilities.Dex)
+}
+
+// String renders the character sheet, leaving out what is unknown.
+func (c *Character) String() string {
+	lines := []string{c.header()}
+
+	var stats []string
+	if c.MaxHP > 0 {
+		stats = append(stats, fmt.Sprintf("HP %d/%d", c.HP, c.MaxHP))
+	} else if c.HP != 0 {
+		stats = append(stats, fmt.Sprintf("HP %d", c.HP))
+	}
+	if c.AC > 0 {
+		stats = append(stats, fmt.Sprintf("AC %d", c.AC))
+	}
+	if c.BAB > 0 {
+		stats = append(stats, fmt.Sprintf("BAB %+d", c.BAB))
+	}
+	if c.Abilities.Dex > 0 || c.Properties["initiative"] != "" {
+		stats = append(stats, fmt.Sprintf("initiative %+d", c.Initiative()))
+	}
+	if len(stats) > 0 {
+		lines = append(lines, strings.Join(stats, ", "))
+	}
+
+	var abilities []string
+	for _, ability := range abilityNames {
+		if score := *c.ability(ability); score > 0 {
+			abilities = append(abilities, fmt.Sprintf("%s %d (%+d)", strings.ToUpper(ability[:1])+ability[1:], score, Modifier(score)))
+		}
+	}
+	if len(abilities) > 0 {
+		lines = append(lines, strings.Join(abilities, ", "))
+	}
+
+	if c.Saves != (Saves{}) || c.Abilities.Con > 0 || c.Abilities.Dex > 0 || c.Abilities.Wis > 0 {
+		lines = append(lines, fmt.Sprintf("Saves: Fort %+d, Ref %+d, Will %+d", c.Fort(), c.Ref(), c.Will()))
+	}
+
+	if len(c.Skills) > 0 {
+		var skills []string
+		for _, skill := range slices.Sorted(maps.Keys(c.Skills)) {
+			skills = append(skills, fmt.Sprintf("%s %s", skill, formatNumber(c.Skills[skill])))
+		}
+		lines = append(lines, "Skills: "+strings.Join(skills, ", "))
+	}
+	if len(c.Feats) > 0 {
+		lines = append(lines, "Feats: "+strings.Join(c.Feats, ", "))
+	}
+	if len(c.SpellsKnown) > 0 {
+		lines = append(lines, "Spells known: "+strings.Join(c.SpellsKnown, ", "))
+	}
+	if len(c.SpellsPrepared) > 0 {
+		lines = append(lines, "Spells prepared: "+formatItems(c.SpellsPrepared))
+	}
+	if len(c.Inventory) > 0 {
+		lines = append(lines, "Inventory: "+formatItems(c.Inventory))
+	}
+	if c.Gold > 0 {
+		lines = append(lines, fmt.Sprintf("Gold: %s gp", formatNumber(c.Gold)))
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.Properties)) {
+		lines = append(lines, fmt.Sprintf("%s: %s", key, c.Properties[key]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// header renders the name, classes and experience, like "Bob: Fighter 3, Rogue 1 (level 4), 6000 XP".
+func (c *Character) header() string {
+	header := c.Name
+	var details []string
+	if len(c.Classes) > 0 {
+		var classes []string
+		for _, class := range slices.Sorted(maps.Keys(c.Classes)) {
+			classes = append(classes, fmt.Sprintf("%s %d", class, c.Classes[class]))
+		}
+		details = append(details, fmt.Sprintf("%s (level %d)", strings.Join(classes, ", "), c.Level()))
+	}
+	if c.XP > 0 {
+		details = append(details, fmt.Sprintf("%d XP", c.XP))
+	}
+	if len(details) > 0 {
+		header += ": " + strings.Join(details, ", ")
+	}
+	return header
+}
+
+func formatItems(items []*Item) string {
+	var names []string
+	for _, item := range items {
+		names = append(names, fmt.Sprintf("%s (x%d)", item.Name, item.Quantity))
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// Clone returns a deep copy of the character.
+func (c *Character) Clone() *Character {
+	clone := *c
+	clone.Classes = maps.Clone(c.Classes)
+	clone.Skills = maps.Clone(c.Skills)
+	clone.Feats = slices.Clone(c.Feats)
+	clone.SpellsKnown = slices.Clone(c.SpellsKnown)
+	clone.SpellsPrepared = cloneItems(c.SpellsPrepared)
+	clone.Inventory = cloneItems(c.Inventory)
+	clone.Properties = maps.Clone(c.Properties)
+	return &clone
+}
+
+func cloneItems(items []*Item) []*Item {
+	if items == nil {
+		return nil
+	}
+	clone := make([]*Item, len(items))
+	for i, item := range items {
+		copied := *item
+		clone[i] = &copied
+	}
+	return clone
+}
@@ -0,0 +1,229 @@
+package character
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// Version is the version of the format of stored rosters.
+	Version = 2
+)
+
+var leadingNumberPattern = regexp.MustCompile(`^\s*([+-]?\d+)`)
+
+// Roster holds the characters of a chat.
+type Roster struct {
+	Version    int                   `json:"version"`
+	Characters map[string]*Character `json:"characters"`
+	// Notes holds free-form chat data that doesn't belong to a character.
+	Notes map[string]string `json:"notes,omitempty"`
+}
+
+// NewRoster creates an empty roster.
+func NewRoster() *Roster {
+	return &Roster{Version: Version, Characters: make(map[string]*Character)}
+}
+
+// Find returns the character with the given name, ignoring case, or nil.
+func (r *Roster) Find(name string) *Character {
+	name = strings.TrimSpace(name)
+	if character, exists := r.Characters[name]; exists {
+		return character
+	}
+	for key, character := range r.Characters {
+		if strings.EqualFold(key, name) {
+			return character
+		}
+	}
+	return nil
+}
+
+// FindOrCreate returns the character with the given name, creating it if needed.
+func (r *Roster) FindOrCreate(name string) (*Character, error) {
+	if character := r.Find(name); character != nil {
+		return character, nil
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, ". ") {
+		return nil, fmt.Errorf("%q is not a valid character name, it can't be empty or have spaces or dots", name)
+	}
+	character := New(name)
+	r.Characters[name] = character
+	return character, nil
+}
+
+// Put stores a character, replacing the one with the same name.
+func (r *Roster) Put(character *Character) {
+	r.Delete(character.Name)
+	r.Characters[character.Name] = character
+}
+
+// Delete removes a character, returning whether it existed.
+func (r *Roster) Delete(name string) bool {
+	character := r.Find(name)
+	if character == nil {
+		return false
+	}
+	delete(r.Characters, character.Name)
+	return true
+}
+
+// Names returns the names of the characters, sorted.
+func (r *Roster) Names() []string {
+	return slices.Sorted(maps.Keys(r.Characters))
+}
+
+// Property returns the value at a character.field path, like "bob.str_mod".
+func (r *Roster) Property(path string) (string, bool) {
+	name, field, found := strings.Cut(path, ".")
+	if !found {
+		value, exists := r.Notes[path]
+		return value, exists
+	}
+	character := r.Find(name)
+	if character == nil {
+		return "", false
+	}
+	return character.Get(field)
+}
+
+// String renders every character sheet and the notes.
+func (r *Roster) String() string {
+	var sections []string
+	for _, name := range r.Names() {
+		sections = append(sections, r.Characters[name].String())
+	}
+	if len(r.Notes) > 0 {
+		lines := []string{"Notes:"}
+		for _, key := range slices.Sorted(maps.Keys(r.Notes)) {
+			lines = append(lines, fmt.Sprintf("- %s: %s", key, r.Notes[key]))
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+// Empty tells whether the roster has no characters and no notes.
+func (r *Roster) Empty() bool {
+	return len(r.Characters) == 0 && len(r.Notes) == 0
+}
+
+// Clone returns a deep copy of the roster.
+func (r *Roster) Clone() *Roster {
+	clone := &Roster{
+		Version:    r.Version,
+		Characters: make(map[string]*Character, len(r.Characters)),
+		Notes:      maps.Clone(r.Notes),
+	}
+	for name, character := range r.Characters {
+		clone.Characters[name] = character.Clone()
+	}
+	return clone
+}
+
+// Decode reads a stored roster, migrating the free-form chat data of older
+// versions, which mapped "character.property" paths to strings. It tells
+// whether the data was migrated.
+func Decode(data []byte) (*Roster, bool, error) {
+	roster := NewRoster()
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return roster, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false, fmt.Errorf("failed to decode chat data: %w", err)
+	}
+	if _, versioned := fields["version"]; versioned {
+		if err := json.Unmarshal(data, roster); err != nil {
+			return nil, false, fmt.Errorf("failed to decode characters: %w", err)
+		}
+		if roster.Characters == nil {
+			roster.Characters = make(map[string]*Character)
+		}
+		return roster, false, nil
+	}
+
+	var old map[string]string
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, false, fmt.Errorf("failed to decode old chat data: %w", err)
+	}
+	return Migrate(old), true, nil
+}
+
+// oldItem is an entry of the lists stored as JSON by older versions.
+type oldItem struct {
+	Value    string `json:"value"`
+	Quantity int    `json:"quantity"`
+}
+
+// Migrate converts the free-form chat data of older versions. Values that
+// don't fit the sheet are kept as properties, with a "_note" suffix when the
+// field exists on the sheet.
+func Migrate(old map[string]string) *Roster {
+	roster := NewRoster()
+	for _, path := range slices.Sorted(maps.Keys(old)) {
+		value := old[path]
+		name, field, found := strings.Cut(path, ".")
+		var character *Character
+		if found {
+			character, _ = roster.FindOrCreate(name)
+		}
+		if character == nil {
+			if roster.Notes == nil {
+				roster.Notes = make(map[string]string)
+			}
+			roster.Notes[path] = value
+			continue
+		}
+		migrateField(character, field, value)
+	}
+	return roster
+}
+
+func migrateField(character *Character, field, value string) {
+	var items []oldItem
+	if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &items) == nil {
+		if character.list(Field(field)) == nil && character.items(Field(field)) == nil {
+			var names []string
+			for _, item := range items {
+				names = append(names, fmt.Sprintf("%s (x%d)", item.Value, item.Quantity))
+			}
+			keep(character, field, strings.Join(names, ", "))
+			return
+		}
+		for _, item := range items {
+			if _, err := character.Add(field, item.Value, max(item.Quantity, 1)); err != nil {
+				fmt.Printf("Failed to migrate %s to %s.%s: %v\n", item.Value, character.Name, field, err)
+			}
+		}
+		return
+	}
+
+	if character.Set(field, value) == nil {
+		return
+	}
+	// Keep numbers like the 25 of "25 (touch 12)", with the full text as a note.
+	if match := leadingNumberPattern.FindStringSubmatch(value); match != nil && character.Set(field, match[1]) == nil {
+		keep(character, field+"_note", value)
+		return
+	}
+	keep(character, field, value)
+}
+
+// keep stores a value that doesn't fit the sheet as a property.
+func keep(character *Character, field, value string) {
+	key := Field(field)
+	if character.isField(key) {
+		key += "_note"
+	}
+	if character.Properties == nil {
+		character.Properties = make(map[string]string)
+	}
+	character.Properties[key] = value
+}
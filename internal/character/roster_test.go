@@ -0,0 +1,187 @@
+package character
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMigratesOldChatData(t *testing.T) {
+	old := map[string]string{
+		"bob.hp":        "25",
+		"bob.ac":        "25 (touch 12)",
+		"bob.Strength":  "16",
+		"bob.inventory": `[{"value":"arrow","quantity":3},{"value":"rope","quantity":1}]`,
+		"bob.feats":     "Power Attack, Cleave",
+		"bob.classes":   "fighter 3",
+		"bob.mood":      "grumpy",
+		"alice.hp":      "lots",
+		"campaign":      "Greyhawk",
+	}
+	data, err := json.Marshal(old)
+	if err != nil {
+		t.Fatalf("failed to encode old data: %v", err)
+	}
+
+	roster, migrated, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !migrated {
+		t.Errorf("Decode() migrated = false, want true for old chat data")
+	}
+
+	want := NewRoster()
+	want.Characters["bob"] = &Character{
+		Name:      "bob",
+		Abilities: Abilities{Str: 16},
+		HP:        25,
+		AC:        25,
+		Feats:     []string{"Power Attack", "Cleave"},
+		Inventory: []*Item{{Name: "arrow", Quantity: 3}, {Name: "rope", Quantity: 1}},
+		Properties: map[string]string{
+			// Values that don't fit the sheet are kept next to the field.
+			"ac_note":      "25 (touch 12)",
+			"classes_note": "fighter 3",
+			"mood":         "grumpy",
+		},
+	}
+	want.Characters["alice"] = &Character{Name: "alice", Properties: map[string]string{"hp_note": "lots"}}
+	want.Notes = map[string]string{"campaign": "Greyhawk"}
+	if !reflect.DeepEqual(roster, want) {
+		got, _ := json.Marshal(roster)
+		wanted, _ := json.Marshal(want)
+		t.Errorf("Decode() = %s, want %s", got, wanted)
+	}
+}
+
+func TestDecodeCurrentRoster(t *testing.T) {
+	roster := NewRoster()
+	bob, err := roster.FindOrCreate("bob")
+	if err != nil {
+		t.Fatalf("FindOrCreate() error = %v", err)
+	}
+	bob.HP, bob.MaxHP = 7, 12
+	bob.Inventory = []*Item{{Name: "arrow", Quantity: 2}}
+	data, err := json.Marshal(roster)
+	if err != nil {
+		t.Fatalf("failed to encode roster: %v", err)
+	}
+
+	decoded, migrated, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if migrated {
+		t.Errorf("Decode() migrated = true, want false for a current roster")
+	}
+	if !reflect.DeepEqual(decoded, roster) {
+		t.Errorf("Decode() = %+v, want %+v", decoded, roster)
+	}
+
+	empty, migrated, err := Decode(nil)
+	if err != nil || migrated || !empty.Empty() {
+		t.Errorf("Decode(nil) = %+v, %t, %v, want an empty roster", empty, migrated, err)
+	}
+	if _, _, err := Decode([]byte("{not json")); err == nil {
+		t.Errorf("Decode() of invalid JSON succeeded, want an error")
+	}
+}
+
+func TestRosterProperty(t *testing.T) {
+	roster := NewRoster()
+	roster.Notes = map[string]string{"campaign": "Greyhawk"}
+	bob, err := roster.FindOrCreate("Bob")
+	if err != nil {
+		t.Fatalf("FindOrCreate() error = %v", err)
+	}
+	for field, value := range map[string]string{
+		"str":             "16",
+		"con":             "9",
+		"fort":            "3",
+		"classes.fighter": "3",
+		"classes.rogue":   "1",
+		"skills.climb":    "4",
+		"inventory":       "rope, torch",
+		"macros.attack":   "1d20+@str_mod",
+	} {
+		if err := bob.Set(field, value); err != nil {
+			t.Fatalf("Set(%s, %q) error = %v", field, value, err)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		want   string
+		exists bool
+	}{
+		{"bob.str", "16", true},
+		{"BOB.Strength", "16", true},
+		{"bob.str_mod", "3", true},
+		{"bob.con_mod", "-1", true},
+		{"bob.dex_mod", "0", false},
+		{"bob.fort_total", "2", true},
+		{"bob.level", "4", true},
+		{"bob.classes", "fighter 3, rogue 1", true},
+		{"bob.skills.Climb", "4", true},
+		{"bob.inventory", "rope (x1), torch (x1)", true},
+		{"bob.macros.attack", "1d20+@str_mod", true},
+		{"bob.hp", "0", false},
+		{"bob.unknown", "", false},
+		{"carol.hp", "", false},
+		{"campaign", "Greyhawk", true},
+	}
+	for _, test := range tests {
+		got, exists := roster.Property(test.path)
+		if got != test.want || exists != test.exists {
+			t.Errorf("Property(%q) = %q, %t, want %q, %t", test.path, got, exists, test.want, test.exists)
+		}
+	}
+}
+
+func TestRosterClone(t *testing.T) {
+	roster := NewRoster()
+	roster.Notes = map[string]string{"campaign": "Greyhawk"}
+	bob := &Character{
+		Name:           "bob",
+		Classes:        map[string]int{"fighter": 3},
+		HP:             12,
+		Skills:         map[string]float64{"climb": 4},
+		Feats:          []string{"Cleave"},
+		SpellsKnown:    []string{"light"},
+		SpellsPrepared: []*Item{{Name: "light", Quantity: 1}},
+		Inventory:      []*Item{{Name: "arrow", Quantity: 3}},
+		Properties:     map[string]string{"mood": "grumpy"},
+	}
+	roster.Put(bob)
+	original, err := json.Marshal(roster)
+	if err != nil {
+		t.Fatalf("failed to encode roster: %v", err)
+	}
+
+	clone := roster.Clone()
+	if !reflect.DeepEqual(clone, roster) {
+		t.Fatalf("Clone() = %+v, want %+v", clone, roster)
+	}
+
+	// Change everything reachable from the clone; the roster must not see it.
+	clone.Notes["campaign"] = "Eberron"
+	copied := clone.Characters["bob"]
+	copied.HP = 1
+	copied.Classes["fighter"] = 4
+	copied.Skills["climb"] = 5
+	copied.Feats[0] = "Power Attack"
+	copied.SpellsKnown[0] = "darkness"
+	copied.SpellsPrepared[0].Quantity = 2
+	copied.Inventory[0].Quantity = 1
+	copied.Properties["mood"] = "cheerful"
+	clone.Put(New("carol"))
+
+	after, err := json.Marshal(roster)
+	if err != nil {
+		t.Fatalf("failed to encode roster: %v", err)
+	}
+	if string(after) != string(original) {
+		t.Errorf("changing the clone changed the roster to %s, want %s", after, original)
+	}
+}
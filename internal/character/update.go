@@ -0,0 +1,439 @@
+package character
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxClassLevel is the highest level allowed in a single class.
+	maxClassLevel = 40
+
+	// maxAbilityScore is the highest ability score allowed.
+	maxAbilityScore = 99
+)
+
+var (
+	abilityNames = []string{"str", "dex", "con", "int", "wis", "cha"}
+
+	// aliases maps other names the model or players use to the name of a field.
+	aliases = map[string]string{
+		"strength":        "str",
+		"dexterity":       "dex",
+		"constitution":    "con",
+		"intelligence":    "int",
+		"wisdom":          "wis",
+		"charisma":        "cha",
+		"fortitude":       "fort",
+		"reflex":          "ref",
+		"hit_points":      "hp",
+		"armor_class":     "ac",
+		"base_attack":     "bab",
+		"experience":      "xp",
+		"gp":              "gold",
+		"items":           "inventory",
+		"equipment":       "inventory",
+		"gear":            "inventory",
+		"spells":          "spells_known",
+		"known_spells":    "spells_known",
+		"prepared_spells": "spells_prepared",
+		"prepared":        "spells_prepared",
+		"class":           "classes",
+		"levels":          "classes",
+		"skill":           "skills",
+		"feat":            "feats",
+	}
+
+	propertyPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// Field normalizes a field name, like "Strength" or "skills.Climb", to the
+// name used by Get and Set, like "str" or "skills.climb".
+func Field(field string) string {
+	field = strings.ToLower(strings.TrimSpace(field))
+	name, key, found := strings.Cut(field, ".")
+	if alias, exists := aliases[name]; exists {
+		name = alias
+	}
+	if found {
+		return name + "." + strings.TrimSpace(key)
+	}
+	return name
+}
+
+// ability returns the score of an ability by name, or nil if it is not one.
+func (c *Character) ability(name string) *int {
+	switch name {
+	case "str":
+		return &c.Abilities.Str
+	case "dex":
+		return &c.Abilities.Dex
+	case "con":
+		return &c.Abilities.Con
+	case "int":
+		return &c.Abilities.Int
+	case "wis":
+		return &c.Abilities.Wis
+	case "cha":
+		return &c.Abilities.Cha
+	}
+	return nil
+}
+
+// number returns the whole number stored in a field, like hp or a base save,
+// or nil if the field is not one.
+func (c *Character) number(name string) *int {
+	switch name {
+	case "hp":
+		return &c.HP
+	case "max_hp":
+		return &c.MaxHP
+	case "ac":
+		return &c.AC
+	case "bab":
+		return &c.BAB
+	case "xp":
+		return &c.XP
+	case "fort":
+		return &c.Saves.Fort
+	case "ref":
+		return &c.Saves.Ref
+	case "will":
+		return &c.Saves.Will
+	}
+	return c.ability(name)
+}
+
+// list returns the list of names stored in a field, or nil if it is not one.
+func (c *Character) list(name string) *[]string {
+	switch name {
+	case "feats":
+		return &c.Feats
+	case "spells_known":
+		return &c.SpellsKnown
+	}
+	return nil
+}
+
+// items returns the list of items stored in a field, or nil if it is not one.
+func (c *Character) items(name string) *[]*Item {
+	switch name {
+	case "inventory":
+		return &c.Inventory
+	case "spells_prepared":
+		return &c.SpellsPrepared
+	}
+	return nil
+}
+
+// isField tells whether a normalized field is part of the sheet or derived
+// from it, rather than a property.
+func (c *Character) isField(field string) bool {
+	name, _, _ := strings.Cut(field, ".")
+	switch name {
+	case "classes", "skills", "gold", "level", "fort_total", "ref_total", "will_total":
+		return true
+	}
+	if ability, found := strings.CutSuffix(field, "_mod"); found && c.ability(ability) != nil {
+		return true
+	}
+	return c.number(field) != nil || c.list(field) != nil || c.items(field) != nil
+}
+
+// Get returns the value of a field, like "hp" or "skills.climb", a derived
+// value, like "str_mod", "fort_total", "level" or "initiative", or a property.
+func (c *Character) Get(field string) (string, bool) {
+	field = Field(field)
+	name, key, keyed := strings.Cut(field, ".")
+
+	switch {
+	case keyed && name == "classes":
+		level, exists := c.Classes[key]
+		return strconv.Itoa(level), exists
+	case keyed && name == "skills":
+		ranks, exists := c.Skills[key]
+		return formatNumber(ranks), exists
+	case name == "classes" && len(c.Classes) > 0:
+		var classes []string
+		for _, class := range slices.Sorted(maps.Keys(c.Classes)) {
+			classes = append(classes, fmt.Sprintf("%s %d", class, c.Classes[class]))
+		}
+		return strings.Join(classes, ", "), true
+	case name == "skills" && len(c.Skills) > 0:
+		var skills []string
+		for _, skill := range slices.Sorted(maps.Keys(c.Skills)) {
+			skills = append(skills, fmt.Sprintf("%s %s", skill, formatNumber(c.Skills[skill])))
+		}
+		return strings.Join(skills, ", "), true
+	case keyed:
+		value, exists := c.Properties[field]
+		return value, exists
+	}
+
+	if number := c.number(field); number != nil {
+		// Unknown numbers are 0, except for hit points of a character that has some.
+		return strconv.Itoa(*number), *number != 0 || (field == "hp" && c.MaxHP > 0)
+	}
+	if list := c.list(field); list != nil {
+		return strings.Join(*list, ", "), len(*list) > 0
+	}
+	if items := c.items(field); items != nil {
+		return formatItems(*items), len(*items) > 0
+	}
+	if value, exists := c.Properties[field]; exists {
+		return value, true
+	}
+
+	switch field {
+	case "gold":
+		return formatNumber(c.Gold), c.Gold > 0
+	case "level":
+		return strconv.Itoa(c.Level()), true
+	case "initiative":
+		return strconv.Itoa(c.Initiative()), true
+	case "fort_total":
+		return strconv.Itoa(c.Fort()), true
+	case "ref_total":
+		return strconv.Itoa(c.Ref()), true
+	case "will_total":
+		return strconv.Itoa(c.Will()), true
+	}
+	if ability, found := strings.CutSuffix(field, "_mod"); found {
+		if score := c.ability(ability); score != nil {
+			return strconv.Itoa(Modifier(*score)), *score != 0
+		}
+	}
+	return "", false
+}
+
+// Set validates and stores the value of a field. Lists take names separated
+// by commas and replace the whole list. Fields that are not part of the sheet
+// are stored as properties.
+func (c *Character) Set(field, value string) error {
+	field = Field(field)
+	value = strings.TrimSpace(value)
+	name, key, keyed := strings.Cut(field, ".")
+
+	switch {
+	case keyed && name == "classes":
+		level, err := parseInt(field, value, 0, maxClassLevel)
+		if err != nil {
+			return err
+		}
+		if level == 0 {
+			delete(c.Classes, key)
+			return nil
+		}
+		if c.Classes == nil {
+			c.Classes = make(map[string]int)
+		}
+		c.Classes[key] = level
+		return nil
+	case keyed && name == "skills":
+		ranks, err := strconv.ParseFloat(value, 64)
+		if err != nil || ranks < 0 {
+			return fmt.Errorf("%s must be a number of ranks, not %q", field, value)
+		}
+		if ranks == 0 {
+			delete(c.Skills, key)
+			return nil
+		}
+		if c.Skills == nil {
+			c.Skills = make(map[string]float64)
+		}
+		c.Skills[key] = ranks
+		return nil
+	case name == "classes" || name == "skills":
+		return fmt.Errorf("set each of the %s on its own, like %s.%s", name, name, map[string]string{"classes": "fighter", "skills": "climb"}[name])
+	}
+
+	if score := c.ability(field); score != nil {
+		number, err := parseInt(field, value, 1, maxAbilityScore)
+		if err != nil {
+			return err
+		}
+		*score = number
+		return nil
+	}
+	if number := c.number(field); number != nil {
+		minimum := 0
+		if field == "hp" {
+			minimum = -1000
+		}
+		parsed, err := parseInt(field, value, minimum, 1_000_000_000)
+		if err != nil {
+			return err
+		}
+		*number = parsed
+		return nil
+	}
+	if list := c.list(field); list != nil {
+		*list = splitList(value)
+		return nil
+	}
+	if items := c.items(field); items != nil {
+		*items = nil
+		for _, name := range splitList(value) {
+			*items = append(*items, &Item{Name: name, Quantity: 1})
+		}
+		return nil
+	}
+
+	switch field {
+	case "gold":
+		gold, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "gp")), 64)
+		if err != nil || gold < 0 {
+			return fmt.Errorf("gold must be a number of gold pieces, not %q", value)
+		}
+		c.Gold = gold
+		return nil
+	case "level", "fort_total", "ref_total", "will_total":
+		return fmt.Errorf("%s is calculated from the rest of the sheet and can't be set", field)
+	case "initiative":
+		if _, err := parseInt(field, value, -100, 100); err != nil {
+			return err
+		}
+	}
+	if strings.HasSuffix(field, "_mod") && c.ability(strings.TrimSuffix(field, "_mod")) != nil {
+		return fmt.Errorf("%s is calculated from the ability score and can't be set", field)
+	}
+
+	if !propertyPattern.MatchString(strings.ReplaceAll(field, ".", "_")) {
+		return fmt.Errorf("%q is not a valid property name, use lower case letters, digits and _", field)
+	}
+	if value == "" {
+		return fmt.Errorf("the value of %s is empty", field)
+	}
+	if c.Properties == nil {
+		c.Properties = make(map[string]string)
+	}
+	c.Properties[field] = value
+	return nil
+}
+
+// Unset clears a field, removing it when it is a property, a class or a skill.
+func (c *Character) Unset(field string) error {
+	field = Field(field)
+	name, key, keyed := strings.Cut(field, ".")
+
+	switch {
+	case keyed && name == "classes":
+		delete(c.Classes, key)
+	case keyed && name == "skills":
+		delete(c.Skills, key)
+	case name == "classes":
+		c.Classes = nil
+	case name == "skills":
+		c.Skills = nil
+	case c.number(field) != nil:
+		*c.number(field) = 0
+	case c.list(field) != nil:
+		*c.list(field) = nil
+	case c.items(field) != nil:
+		*c.items(field) = nil
+	case field == "gold":
+		c.Gold = 0
+	default:
+		if _, exists := c.Properties[field]; !exists {
+			return fmt.Errorf("%s.%s does not exist", c.Name, field)
+		}
+		delete(c.Properties, field)
+	}
+	return nil
+}
+
+// Add adds quantity of an entry to a list, like an item to the inventory or a
+// feat to the feats, and describes the change.
+func (c *Character) Add(field, value string, quantity int) (string, error) {
+	field = Field(field)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("the value to add to %s is empty", field)
+	}
+
+	if list := c.list(field); list != nil {
+		if slices.ContainsFunc(*list, func(entry string) bool { return strings.EqualFold(entry, value) }) {
+			return "", fmt.Errorf("%s already has %s in %s", c.Name, value, field)
+		}
+		*list = append(*list, value)
+		return fmt.Sprintf("Added %s to %s.%s", value, c.Name, field), nil
+	}
+
+	items := c.items(field)
+	if items == nil {
+		return "", fmt.Errorf("%s is not a list, add to one of inventory, spells_prepared, feats or spells_known", field)
+	}
+	if quantity < 1 {
+		return "", fmt.Errorf("the quantity to add must be at least 1")
+	}
+	if item := findItem(*items, value); item != nil {
+		item.Quantity += quantity
+		return fmt.Sprintf("Incremented quantity of %s to %d in %s.%s", item.Name, item.Quantity, c.Name, field), nil
+	}
+	*items = append(*items, &Item{Name: value, Quantity: quantity})
+	return fmt.Sprintf("Added %s to %s.%s with quantity %d", value, c.Name, field, quantity), nil
+}
+
+// Remove removes quantity of an entry from a list and describes the change.
+func (c *Character) Remove(field, value string, quantity int) (string, error) {
+	field = Field(field)
+	value = strings.TrimSpace(value)
+
+	if list := c.list(field); list != nil {
+		index := slices.IndexFunc(*list, func(entry string) bool { return strings.EqualFold(entry, value) })
+		if index < 0 {
+			return "", fmt.Errorf("%s not found in %s.%s", value, c.Name, field)
+		}
+		*list = slices.Delete(*list, index, index+1)
+		return fmt.Sprintf("Removed %s from %s.%s", value, c.Name, field), nil
+	}
+
+	items := c.items(field)
+	if items == nil {
+		return "", fmt.Errorf("%s is not a list, remove from one of inventory, spells_prepared, feats or spells_known", field)
+	}
+	item := findItem(*items, value)
+	if item == nil {
+		return "", fmt.Errorf("%s not found in %s.%s", value, c.Name, field)
+	}
+	if item.Quantity > quantity {
+		item.Quantity -= quantity
+		return fmt.Sprintf("Decremented %d of %s in %s.%s. New total is %d", quantity, item.Name, c.Name, field, item.Quantity), nil
+	}
+	*items = slices.DeleteFunc(*items, func(entry *Item) bool { return entry == item })
+	return fmt.Sprintf("Removed %s from %s.%s", item.Name, c.Name, field), nil
+}
+
+func findItem(items []*Item, name string) *Item {
+	for _, item := range items {
+		if strings.EqualFold(item.Name, name) {
+			return item
+		}
+	}
+	return nil
+}
+
+func parseInt(field, value string, minimum, maximum int) (int, error) {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a whole number, not %q", field, value)
+	}
+	if number < minimum || number > maximum {
+		return 0, fmt.Errorf("%s must be between %d and %d, not %d", field, minimum, maximum, number)
+	}
+	return number, nil
+}
+
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,110 @@
+package character
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetAndGet(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		get   string
+		want  string
+	}{
+		{"Strength", "16", "str", "16"},
+		{"str", "16", "str_mod", "3"},
+		{"hp", "-5", "hp", "-5"},
+		{"armor_class", "18", "ac", "18"},
+		{"classes.Fighter", "3", "classes.fighter", "3"},
+		{"classes.fighter", "3", "level", "3"},
+		{"skills.climb", "2.5", "skills.climb", "2.5"},
+		{"feats", "Power Attack, Cleave", "feats", "Power Attack, Cleave"},
+		{"equipment", "rope, torch", "inventory", "rope (x1), torch (x1)"},
+		{"gold", "12.5 gp", "gold", "12.5"},
+		{"initiative", "3", "initiative", "3"},
+		{"dex", "14", "initiative", "2"},
+		{"macros.attack", "1d20+@str_mod", "macros.attack", "1d20+@str_mod"},
+		{"Mood", "grumpy", "mood", "grumpy"},
+	}
+
+	for _, test := range tests {
+		character := New("bob")
+		if err := character.Set(test.field, test.value); err != nil {
+			t.Errorf("Set(%s, %q) error = %v", test.field, test.value, err)
+			continue
+		}
+		got, exists := character.Get(test.get)
+		if !exists || got != test.want {
+			t.Errorf("after Set(%s, %q), Get(%s) = %q, %t, want %q", test.field, test.value, test.get, got, exists, test.want)
+		}
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		want  string
+	}{
+		{"str", "0", "str must be between 1 and 99"},
+		{"str", "strong", "str must be a whole number"},
+		{"hp", "-1001", "hp must be between -1000"},
+		{"classes", "fighter", "set each of the classes on its own"},
+		{"classes.fighter", "41", "classes.fighter must be between 0 and 40"},
+		{"skills.climb", "-1", "skills.climb must be a number of ranks"},
+		{"gold", "lots", "gold must be a number of gold pieces"},
+		{"level", "4", "level is calculated"},
+		{"str_mod", "3", "str_mod is calculated"},
+		{"initiative", "fast", "initiative must be a whole number"},
+		{"favorite color", "blue", "is not a valid property name"},
+		{"mood", "", "the value of mood is empty"},
+	}
+
+	for _, test := range tests {
+		err := New("bob").Set(test.field, test.value)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Set(%s, %q) error = %v, want it to contain %q", test.field, test.value, err, test.want)
+		}
+	}
+}
+
+func TestAddAndRemove(t *testing.T) {
+	character := New("bob")
+	steps := []struct {
+		add      bool
+		field    string
+		value    string
+		quantity int
+		want     string
+	}{
+		{true, "inventory", "arrow", 3, "Added arrow to bob.inventory with quantity 3"},
+		{true, "items", "Arrow", 2, "Incremented quantity of arrow to 5 in bob.inventory"},
+		{false, "inventory", "arrow", 4, "Decremented 4 of arrow in bob.inventory. New total is 1"},
+		{false, "inventory", "arrow", 1, "Removed arrow from bob.inventory"},
+		{true, "feats", "Cleave", 1, "Added Cleave to bob.feats"},
+		{false, "feat", "cleave", 1, "Removed cleave from bob.feats"},
+	}
+	for _, step := range steps {
+		var got string
+		var err error
+		if step.add {
+			got, err = character.Add(step.field, step.value, step.quantity)
+		} else {
+			got, err = character.Remove(step.field, step.value, step.quantity)
+		}
+		if err != nil || got != step.want {
+			t.Errorf("%s %s %d: got %q, %v, want %q", step.field, step.value, step.quantity, got, err, step.want)
+		}
+	}
+	if len(character.Inventory) != 0 || len(character.Feats) != 0 {
+		t.Errorf("inventory = %v, feats = %v, want both empty", character.Inventory, character.Feats)
+	}
+
+	if _, err := character.Add("hp", "arrow", 1); err == nil {
+		t.Errorf("Add() to hp succeeded, want an error")
+	}
+	if _, err := character.Remove("inventory", "rope", 1); err == nil {
+		t.Errorf("Remove() of a missing item succeeded, want an error")
+	}
+}
@@ -0,0 +1,106 @@
+package chathistory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+const (
+	// MaxSize is the maximum number of messages kept per chat.
+	MaxSize = 600
+)
+
+// Message is a message sent by a user to a chat.
+type Message struct {
+	UserID    int64
+	UserName  string
+	Text      string
+	Timestamp time.Time
+}
+
+func (m *Message) String() string {
+	return fmt.Sprintf("[%s - %s]: `%s`", m.Timestamp.Format(time.RFC3339), m.UserName, m.Text)
+}
+
+// History keeps the messages of each chat that were not addressed to the bot,
+// so they can be sent to the model as context along with the next one that is.
+type History struct {
+	storage *storage.Client
+	botName string
+	lock    sync.Mutex
+	chats   map[int64][]*Message
+}
+
+// New creates a History for the bot called botName, loading the messages
+// kept before.
+func New(storageClient *storage.Client, botName string) (*History, error) {
+	h := &History{
+		storage: storageClient,
+		botName: botName,
+		chats:   make(map[int64][]*Message),
+	}
+
+	err := h.storage.LoadChatHistory(&h.chats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat history: %w", err)
+	}
+	return h, nil
+}
+
+// Addressed tells whether a message is meant for the bot: every message of a
+// private chat is, and in groups those mentioning the bot or replying to it.
+func (h *History) Addressed(text string, private, replyToBot bool) bool {
+	hasBotName := strings.Contains(strings.ToLower(text), strings.ToLower(h.botName))
+	return private || hasBotName || replyToBot
+}
+
+// Prompt returns the text to send to the model for msg, preceded by the
+// messages of the chat kept since the last prompt, when msg is addressed to
+// the bot. Otherwise msg is kept for later and Prompt returns false.
+func (h *History) Prompt(chatID int64, msg *Message, private, replyToBot bool) (string, bool) {
+	if !h.Addressed(msg.Text, private, replyToBot) {
+		h.add(chatID, msg)
+		return "", false
+	}
+	return h.take(chatID) + "\n" + msg.String(), true
+}
+
+func (h *History) add(chatID int64, msg *Message) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.chats[chatID] == nil {
+		h.chats[chatID] = make([]*Message, 0)
+	}
+	h.chats[chatID] = append(h.chats[chatID], msg)
+	if len(h.chats[chatID]) > MaxSize {
+		h.chats[chatID] = h.chats[chatID][1:]
+	}
+	h.storage.SaveChatHistoryAsync(h.copy())
+}
+
+// take returns the pending history of a chat and clears it in a single step,
+// so messages arriving meanwhile are neither lost nor repeated.
+func (h *History) take(chatID int64) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	historyLines := make([]string, len(h.chats[chatID]))
+	for i, msg := range h.chats[chatID] {
+		historyLines[i] = msg.String()
+	}
+	h.chats[chatID] = make([]*Message, 0)
+	h.storage.SaveChatHistoryAsync(h.copy())
+	return strings.Join(historyLines, "\n")
+}
+
+func (h *History) copy() map[int64][]*Message {
+	history := make(map[int64][]*Message, len(h.chats))
+	for chatID, messages := range h.chats {
+		history[chatID] = make([]*Message, len(messages))
+		copy(history[chatID], messages)
+	}
+	return history
+}
@@ -0,0 +1,596 @@
+package combat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/diceroller"
+	"github.com/gtrindade/ultra-kiew/internal/mysql"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+const (
+	// EncounterFile is the name of the file where a chat's encounter is stored.
+	EncounterFile = "encounter-%d.json"
+
+	// maxMonsters is the maximum number of monsters added at once.
+	maxMonsters = 20
+
+	// deadHP is the hit points at which a combatant dies.
+	deadHP = -10
+)
+
+// Monsters looks up monster stat blocks.
+type Monsters interface {
+	GetMonstersByName(name string) ([]*mysql.Monster, error)
+}
+
+// Characters looks up the characters stored for a chat and their properties, like "bob.hp".
+type Characters interface {
+	CharacterExists(chatID int64, name string) (bool, error)
+	CharacterProperty(chatID int64, path string) (string, bool)
+}
+
+// Encounter is a fight in a chat.
+type Encounter struct {
+	StartedAt time.Time `json:"started_at"`
+	// Round is the current round, starting at 1.
+	Round int `json:"round"`
+	// Turn is the index in Combatants of whose turn it is.
+	Turn int `json:"turn"`
+	// Combatants are sorted by initiative, highest first.
+	Combatants []*Combatant `json:"combatants"`
+}
+
+// Combatant is a character or monster taking part in an encounter.
+type Combatant struct {
+	Name       string `json:"name"`
+	Initiative int    `json:"initiative"`
+	// Bonus is the initiative modifier, which breaks ties.
+	Bonus int `json:"bonus"`
+	HP    int `json:"hp"`
+	// MaxHP is 0 when the hit points of the combatant are unknown.
+	MaxHP      int          `json:"max_hp"`
+	AC         string       `json:"ac,omitempty"`
+	Monster    bool         `json:"monster,omitempty"`
+	Conditions []*Condition `json:"conditions,omitempty"`
+}
+
+// Condition is an effect on a combatant, like "prone" or "hasted".
+type Condition struct {
+	Name string `json:"name"`
+	// Rounds is the number of rounds left, 0 for conditions lasting until removed.
+	Rounds int `json:"rounds,omitempty"`
+}
+
+// Tracker runs the encounters of every chat.
+type Tracker struct {
+	storage    *storage.Client
+	dice       *diceroller.Client
+	monsters   Monsters
+	characters Characters
+	lock       sync.Mutex
+	encounters map[int64]*Encounter
+}
+
+// NewTracker creates a Tracker rolling initiative with dice, adding monsters
+// from monsters and characters from the chat data in characters. monsters may
+// be nil when there is no rules database.
+func NewTracker(storageClient *storage.Client, dice *diceroller.Client, monsters Monsters, characters Characters) *Tracker {
+	return &Tracker{
+		storage:    storageClient,
+		dice:       dice,
+		monsters:   monsters,
+		characters: characters,
+		encounters: make(map[int64]*Encounter),
+	}
+}
+
+// getEncounter returns the encounter of a chat, loading it from storage on
+// first use, or nil if there is none. An encounter that can't be read is
+// reported instead of being treated as missing, so it isn't overwritten by a
+// new one. The caller must hold t.lock.
+func (t *Tracker) getEncounter(chatID int64) (*Encounter, error) {
+	encounter, exists := t.encounters[chatID]
+	if exists {
+		return encounter, nil
+	}
+
+	encounter = &Encounter{}
+	err := t.storage.LoadFromDB(fmt.Sprintf(EncounterFile, chatID), encounter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encounter of chat %d: %w", chatID, err)
+	}
+	if encounter.Round == 0 {
+		encounter = nil
+	}
+	t.encounters[chatID] = encounter
+	return encounter, nil
+}
+
+// activeEncounter returns the encounter of a chat, or an error if there is none.
+// The caller must hold t.lock.
+func (t *Tracker) activeEncounter(chatID int64) (*Encounter, error) {
+	encounter, err := t.getEncounter(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if encounter == nil {
+		return nil, fmt.Errorf("there is no encounter in this chat, start one first")
+	}
+	return encounter, nil
+}
+
+// save persists the encounter of a chat. The caller must hold t.lock.
+func (t *Tracker) save(chatID int64, encounter *Encounter) {
+	err := t.storage.SaveToDB(fmt.Sprintf(EncounterFile, chatID), encounter)
+	if err != nil {
+		fmt.Printf("Failed to save encounter of chat %d: %v\n", chatID, err)
+	}
+}
+
+// Active tells whether a chat has an encounter running.
+func (t *Tracker) Active(chatID int64) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.getEncounter(chatID)
+	if err != nil {
+		fmt.Printf("Failed to check the encounter of chat %d: %v\n", chatID, err)
+		return false
+	}
+	return encounter != nil
+}
+
+// Start starts an encounter in a chat.
+func (t *Tracker) Start(chatID int64) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.getEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+	if encounter != nil {
+		return "", fmt.Errorf("an encounter is already running, stop it first")
+	}
+	encounter = &Encounter{StartedAt: time.Now(), Round: 1}
+	t.encounters[chatID] = encounter
+	t.save(chatID, encounter)
+	return "Roll for initiative! Add characters and monsters to the encounter.", nil
+}
+
+// Stop ends the encounter of a chat.
+func (t *Tracker) Stop(chatID int64) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.activeEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+	t.encounters[chatID] = nil
+	err = t.storage.DeleteFromDB(fmt.Sprintf(EncounterFile, chatID))
+	if err != nil {
+		fmt.Printf("Failed to delete encounter of chat %d: %v\n", chatID, err)
+	}
+	return fmt.Sprintf("The encounter ended after %s.", roundCount(encounter.Round)), nil
+}
+
+// Status describes the encounter of a chat.
+func (t *Tracker) Status(chatID int64) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.activeEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+	return encounter.String(), nil
+}
+
+// AddCharacter adds a character to the encounter of the chat of ctx, taking
+// its initiative modifier, hit points and armor class from its character
+// sheet. If initiative is nil, it is rolled.
+func (t *Tracker) AddCharacter(ctx context.Context, chatID int64, name string, initiative *int) (string, error) {
+	exists, err := t.characters.CharacterExists(chatID, name)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("no character sheet found for %s, add the character to the chat data first", name)
+	}
+
+	combatant := &Combatant{Name: name}
+	combatant.Bonus = t.characterNumber(chatID, name, "initiative", "init")
+	combatant.MaxHP = t.characterNumber(chatID, name, "max_hp", "hp")
+	combatant.HP = t.characterNumber(chatID, name, "hp", "max_hp")
+	if ac, exists := t.characters.CharacterProperty(chatID, name+".ac"); exists {
+		combatant.AC = ac
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.activeEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+	if encounter.find(name) != nil {
+		return "", fmt.Errorf("%s is already in the encounter", name)
+	}
+
+	rolled, err := t.rollInitiative(ctx, combatant, initiative)
+	if err != nil {
+		return "", err
+	}
+	encounter.add(combatant)
+	t.save(chatID, encounter)
+	return fmt.Sprintf("%s joins the encounter with initiative %s.", name, rolled), nil
+}
+
+// characterNumber returns the first of the given properties of a character
+// holding a whole number, or 0.
+func (t *Tracker) characterNumber(chatID int64, name string, properties ...string) int {
+	for _, property := range properties {
+		value, exists := t.characters.CharacterProperty(chatID, name+"."+property)
+		if !exists {
+			continue
+		}
+		if number, ok := leadingNumber(value); ok {
+			return number
+		}
+	}
+	return 0
+}
+
+// AddMonsters adds count monsters found by name to the encounter, rolling
+// initiative for each of them.
+func (t *Tracker) AddMonsters(ctx context.Context, chatID int64, name string, count int) (string, error) {
+	if count < 1 || count > maxMonsters {
+		return "", fmt.Errorf("can only add between 1 and %d monsters at once", maxMonsters)
+	}
+
+	if t.monsters == nil {
+		return "", fmt.Errorf("monsters are not available without the rules database")
+	}
+	monsters, err := t.monsters.GetMonstersByName(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get monsters from database: %w", err)
+	}
+	monster := pickMonster(monsters, name)
+	if monster == nil {
+		return "", fmt.Errorf("no monster found with the name %q", name)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.activeEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, combatantName := range encounter.monsterNames(monster.Name, count) {
+		combatant := newMonster(combatantName, monster)
+		rolled, err := t.rollInitiative(ctx, combatant, nil)
+		if err != nil {
+			return "", err
+		}
+		encounter.add(combatant)
+		lines = append(lines, fmt.Sprintf("%s joins the encounter with initiative %s, %d HP.", combatantName, rolled, combatant.HP))
+	}
+	t.save(chatID, encounter)
+	return strings.Join(lines, "\n"), nil
+}
+
+// rollInitiative sets the initiative of a combatant, rolling it unless it is
+// given, and returns how it was obtained.
+func (t *Tracker) rollInitiative(ctx context.Context, combatant *Combatant, initiative *int) (string, error) {
+	if initiative != nil {
+		combatant.Initiative = *initiative
+		return fmt.Sprint(*initiative), nil
+	}
+
+	result, err := t.dice.Roll(ctx, fmt.Sprintf("1d20%+d [%s initiative]", combatant.Bonus, combatant.Name))
+	if err != nil {
+		return "", fmt.Errorf("failed to roll initiative for %s: %w", combatant.Name, err)
+	}
+	combatant.Initiative = result.Rolls[0].Total
+	return result.String(), nil
+}
+
+// Remove takes a combatant out of the encounter.
+func (t *Tracker) Remove(chatID int64, name string) (string, error) {
+	return t.update(chatID, name, func(encounter *Encounter, combatant *Combatant) string {
+		encounter.remove(combatant)
+		return fmt.Sprintf("%s leaves the encounter.", combatant.Name)
+	})
+}
+
+// Next ends the current turn, ticking down the conditions of the combatant
+// whose turn ended, and starts the next one.
+func (t *Tracker) Next(chatID int64) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.activeEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+	if len(encounter.Combatants) == 0 {
+		return "", fmt.Errorf("nobody is in the encounter yet")
+	}
+
+	var lines []string
+	current := encounter.Combatants[encounter.Turn]
+	for _, expired := range current.tick() {
+		lines = append(lines, fmt.Sprintf("%s is no longer %s.", current.Name, expired))
+	}
+
+	encounter.Turn++
+	if encounter.Turn >= len(encounter.Combatants) {
+		encounter.Turn = 0
+		encounter.Round++
+		lines = append(lines, fmt.Sprintf("Round %d begins.", encounter.Round))
+	}
+	t.save(chatID, encounter)
+
+	lines = append(lines, "", encounter.String())
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// Damage removes hit points from a combatant. Negative amounts heal.
+func (t *Tracker) Damage(chatID int64, name string, amount int) (string, error) {
+	return t.updateErr(chatID, name, func(encounter *Encounter, combatant *Combatant) (string, error) {
+		if combatant.MaxHP == 0 {
+			return "", fmt.Errorf("the hit points of %s are unknown, set them first", combatant.Name)
+		}
+		combatant.HP = min(combatant.HP-amount, combatant.MaxHP)
+		verb := fmt.Sprintf("takes %d damage", amount)
+		if amount < 0 {
+			verb = fmt.Sprintf("heals %d", -amount)
+		}
+		return fmt.Sprintf("%s %s: %s.", combatant.Name, verb, combatant.health()), nil
+	})
+}
+
+// SetHP sets the hit points of a combatant. A maxHP of 0 keeps the current maximum.
+func (t *Tracker) SetHP(chatID int64, name string, hp, maxHP int) (string, error) {
+	return t.update(chatID, name, func(encounter *Encounter, combatant *Combatant) string {
+		if maxHP > 0 {
+			combatant.MaxHP = maxHP
+		}
+		if combatant.MaxHP == 0 {
+			combatant.MaxHP = hp
+		}
+		combatant.HP = hp
+		return fmt.Sprintf("%s: %s.", combatant.Name, combatant.health())
+	})
+}
+
+// SetInitiative changes the initiative of a combatant, keeping the current turn.
+func (t *Tracker) SetInitiative(chatID int64, name string, initiative int) (string, error) {
+	return t.update(chatID, name, func(encounter *Encounter, combatant *Combatant) string {
+		encounter.remove(combatant)
+		combatant.Initiative = initiative
+		encounter.add(combatant)
+		return fmt.Sprintf("%s now has initiative %d.", combatant.Name, initiative)
+	})
+}
+
+// AddCondition adds a condition to a combatant, lasting rounds rounds, or until
+// removed if rounds is 0.
+func (t *Tracker) AddCondition(chatID int64, name, condition string, rounds int) (string, error) {
+	condition = strings.ToLower(strings.TrimSpace(condition))
+	if condition == "" {
+		return "", fmt.Errorf("the condition is missing")
+	}
+	return t.update(chatID, name, func(encounter *Encounter, combatant *Combatant) string {
+		combatant.removeCondition(condition)
+		combatant.Conditions = append(combatant.Conditions, &Condition{Name: condition, Rounds: max(rounds, 0)})
+		if rounds > 0 {
+			return fmt.Sprintf("%s is %s for %s.", combatant.Name, condition, roundCount(rounds))
+		}
+		return fmt.Sprintf("%s is %s.", combatant.Name, condition)
+	})
+}
+
+// RemoveCondition removes a condition from a combatant.
+func (t *Tracker) RemoveCondition(chatID int64, name, condition string) (string, error) {
+	condition = strings.ToLower(strings.TrimSpace(condition))
+	return t.updateErr(chatID, name, func(encounter *Encounter, combatant *Combatant) (string, error) {
+		if !combatant.removeCondition(condition) {
+			return "", fmt.Errorf("%s is not %s", combatant.Name, condition)
+		}
+		return fmt.Sprintf("%s is no longer %s.", combatant.Name, condition), nil
+	})
+}
+
+func (t *Tracker) update(chatID int64, name string, change func(*Encounter, *Combatant) string) (string, error) {
+	return t.updateErr(chatID, name, func(encounter *Encounter, combatant *Combatant) (string, error) {
+		return change(encounter, combatant), nil
+	})
+}
+
+// updateErr applies change to a combatant of the encounter of a chat and saves it.
+func (t *Tracker) updateErr(chatID int64, name string, change func(*Encounter, *Combatant) (string, error)) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	encounter, err := t.activeEncounter(chatID)
+	if err != nil {
+		return "", err
+	}
+	combatant := encounter.find(name)
+	if combatant == nil {
+		return "", fmt.Errorf("%s is not in the encounter", name)
+	}
+
+	message, err := change(encounter, combatant)
+	if err != nil {
+		return "", err
+	}
+	t.save(chatID, encounter)
+	return message, nil
+}
+
+// find returns the combatant with the given name, ignoring case.
+func (e *Encounter) find(name string) *Combatant {
+	for _, combatant := range e.Combatants {
+		if strings.EqualFold(combatant.Name, strings.TrimSpace(name)) {
+			return combatant
+		}
+	}
+	return nil
+}
+
+// add inserts a combatant in initiative order, keeping the current turn. Until
+// the first turn ends, the turn stays with the highest initiative.
+func (e *Encounter) add(combatant *Combatant) {
+	var current *Combatant
+	if len(e.Combatants) > 0 && (e.Round > 1 || e.Turn > 0) {
+		current = e.Combatants[e.Turn]
+	}
+
+	e.Combatants = append(e.Combatants, combatant)
+	sort.SliceStable(e.Combatants, func(i, j int) bool {
+		a, b := e.Combatants[i], e.Combatants[j]
+		if a.Initiative != b.Initiative {
+			return a.Initiative > b.Initiative
+		}
+		return a.Bonus > b.Bonus
+	})
+
+	e.Turn = 0
+	for i, c := range e.Combatants {
+		if c == current {
+			e.Turn = i
+		}
+	}
+}
+
+// remove takes a combatant out, keeping the current turn when possible.
+func (e *Encounter) remove(combatant *Combatant) {
+	for i, c := range e.Combatants {
+		if c != combatant {
+			continue
+		}
+		e.Combatants = append(e.Combatants[:i], e.Combatants[i+1:]...)
+		if i < e.Turn {
+			e.Turn--
+		}
+		if e.Turn >= len(e.Combatants) {
+			e.Turn = 0
+		}
+		return
+	}
+}
+
+// monsterNames returns count names for a new kind of monster, numbering them
+// after the ones already in the encounter.
+func (e *Encounter) monsterNames(name string, count int) []string {
+	if count == 1 && e.find(name) == nil {
+		return []string{name}
+	}
+	var names []string
+	for n := 1; len(names) < count; n++ {
+		candidate := fmt.Sprintf("%s %d", name, n)
+		if e.find(candidate) == nil {
+			names = append(names, candidate)
+		}
+	}
+	return names
+}
+
+// String renders the initiative order, marking whose turn it is.
+func (e *Encounter) String() string {
+	lines := []string{fmt.Sprintf("Round %d", e.Round)}
+	if len(e.Combatants) == 0 {
+		return lines[0] + ": nobody is in the encounter yet."
+	}
+	for i, combatant := range e.Combatants {
+		marker := "  "
+		if i == e.Turn {
+			marker = "▶ "
+		}
+		lines = append(lines, marker+combatant.String())
+	}
+	lines = append(lines, fmt.Sprintf("It's %s's turn.", e.Combatants[e.Turn].Name))
+	return strings.Join(lines, "\n")
+}
+
+// String renders the combatant like "17 Goblin 1: 3/5 HP, AC 15, prone (2 rounds)".
+func (c *Combatant) String() string {
+	details := []string{c.health()}
+	if c.AC != "" {
+		details = append(details, "AC "+c.AC)
+	}
+	for _, condition := range c.Conditions {
+		if condition.Rounds > 0 {
+			details = append(details, fmt.Sprintf("%s (%s)", condition.Name, roundCount(condition.Rounds)))
+		} else {
+			details = append(details, condition.Name)
+		}
+	}
+	return fmt.Sprintf("%d %s: %s", c.Initiative, c.Name, strings.Join(details, ", "))
+}
+
+// health describes the hit points of the combatant, using the D&D 3.5 states
+// for 0 and negative hit points.
+func (c *Combatant) health() string {
+	if c.MaxHP == 0 {
+		return "HP unknown"
+	}
+	hp := fmt.Sprintf("%d/%d HP", c.HP, c.MaxHP)
+	switch {
+	case c.HP <= deadHP:
+		return hp + " (dead)"
+	case c.HP < 0:
+		return hp + " (dying)"
+	case c.HP == 0:
+		return hp + " (disabled)"
+	}
+	return hp
+}
+
+// tick counts down the conditions of the combatant at the end of its turn,
+// returning the ones that expired.
+func (c *Combatant) tick() []string {
+	var expired []string
+	remaining := c.Conditions[:0]
+	for _, condition := range c.Conditions {
+		if condition.Rounds > 0 {
+			condition.Rounds--
+			if condition.Rounds == 0 {
+				expired = append(expired, condition.Name)
+				continue
+			}
+		}
+		remaining = append(remaining, condition)
+	}
+	c.Conditions = remaining
+	return expired
+}
+
+func (c *Combatant) removeCondition(name string) bool {
+	for i, condition := range c.Conditions {
+		if strings.EqualFold(condition.Name, name) {
+			c.Conditions = append(c.Conditions[:i], c.Conditions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func roundCount(rounds int) string {
+	if rounds == 1 {
+		return "1 round"
+	}
+	return fmt.Sprintf("%d rounds", rounds)
+}
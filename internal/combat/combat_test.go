@@ -0,0 +1,143 @@
+package combat
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/gtrindade/ultra-kiew/internal/diceroller"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+const chatID = 1
+
+// sheets fakes the character sheets of a chat, keyed by lowercase "name.property".
+type sheets map[string]string
+
+func (s sheets) CharacterExists(chatID int64, name string) (bool, error) {
+	for path := range s {
+		if strings.HasPrefix(path, strings.ToLower(name)+".") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s sheets) CharacterProperty(chatID int64, path string) (string, bool) {
+	value, exists := s[strings.ToLower(path)]
+	return value, exists
+}
+
+func newTestTracker(t *testing.T, store storage.Store) *Tracker {
+	t.Helper()
+	storageClient := storage.NewClient(store)
+	t.Cleanup(func() {
+		if err := storageClient.Close(); err != nil {
+			t.Errorf("failed to close storage: %v", err)
+		}
+	})
+	characters := sheets{"bob.hp": "12", "bob.ac": "16", "alice.hp": "8"}
+	return NewTracker(storageClient, diceroller.NewClient(storageClient, rand.NewPCG(1, 2)), nil, characters)
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	tracker := newTestTracker(t, storage.NewFileStore(t.TempDir()))
+	initiative := func(value int) *int { return &value }
+
+	steps := []struct {
+		name    string
+		run     func() (string, error)
+		want    []string
+		wantErr string
+	}{
+		{"status before start", func() (string, error) { return tracker.Status(chatID) }, nil, "there is no encounter"},
+		{"start", func() (string, error) { return tracker.Start(chatID) }, []string{"Roll for initiative!"}, ""},
+		{"start again", func() (string, error) { return tracker.Start(chatID) }, nil, "already running"},
+		{"add without a sheet", func() (string, error) { return tracker.AddCharacter(ctx, chatID, "carol", initiative(10)) }, nil, "no character sheet found for carol"},
+		{"add bob", func() (string, error) { return tracker.AddCharacter(ctx, chatID, "bob", initiative(12)) }, []string{"bob joins the encounter with initiative 12."}, ""},
+		{"add alice", func() (string, error) { return tracker.AddCharacter(ctx, chatID, "alice", initiative(18)) }, []string{"alice joins the encounter with initiative 18."}, ""},
+		{"add bob again", func() (string, error) { return tracker.AddCharacter(ctx, chatID, "Bob", nil) }, nil, "already in the encounter"},
+		{"status", func() (string, error) { return tracker.Status(chatID) }, []string{"Round 1", "▶ 18 alice: 8/8 HP", "  12 bob: 12/12 HP, AC 16", "It's alice's turn."}, ""},
+		{"set hp", func() (string, error) { return tracker.SetHP(chatID, "bob", 5, 0) }, []string{"bob: 5/12 HP."}, ""},
+		{"set hp and max", func() (string, error) { return tracker.SetHP(chatID, "alice", 9, 10) }, []string{"alice: 9/10 HP."}, ""},
+		{"damage", func() (string, error) { return tracker.Damage(chatID, "bob", 6) }, []string{"bob takes 6 damage: -1/12 HP (dying)."}, ""},
+		{"condition", func() (string, error) { return tracker.AddCondition(chatID, "alice", "Prone", 1) }, []string{"alice is prone for 1 round."}, ""},
+		{"lasting condition", func() (string, error) { return tracker.AddCondition(chatID, "bob", "blinded", 0) }, []string{"bob is blinded."}, ""},
+		{"next ticks conditions", func() (string, error) { return tracker.Next(chatID) }, []string{"alice is no longer prone.", "It's bob's turn."}, ""},
+		{"next wraps the round", func() (string, error) { return tracker.Next(chatID) }, []string{"Round 2 begins.", "blinded", "It's alice's turn."}, ""},
+		{"unknown combatant", func() (string, error) { return tracker.SetHP(chatID, "carol", 5, 0) }, nil, "carol is not in the encounter"},
+		{"stop", func() (string, error) { return tracker.Stop(chatID) }, []string{"The encounter ended after 2 rounds."}, ""},
+		{"next after stop", func() (string, error) { return tracker.Next(chatID) }, nil, "there is no encounter"},
+	}
+
+	for _, step := range steps {
+		got, err := step.run()
+		if step.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), step.wantErr) {
+				t.Fatalf("%s: error = %v, want it to contain %q", step.name, err, step.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+		for _, want := range step.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: got %q, want it to contain %q", step.name, got, want)
+			}
+		}
+	}
+}
+
+func TestTrackerAddsCharacterToLaterTurns(t *testing.T) {
+	ctx := context.Background()
+	tracker := newTestTracker(t, storage.NewFileStore(t.TempDir()))
+	initiative := func(value int) *int { return &value }
+
+	for _, step := range []func() (string, error){
+		func() (string, error) { return tracker.Start(chatID) },
+		func() (string, error) { return tracker.AddCharacter(ctx, chatID, "bob", initiative(12)) },
+		func() (string, error) { return tracker.Next(chatID) },
+		// Alice joins ahead of bob in the order, but it stays bob's turn.
+		func() (string, error) { return tracker.AddCharacter(ctx, chatID, "alice", initiative(18)) },
+	} {
+		if _, err := step(); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+	}
+
+	status, err := tracker.Status(chatID)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !strings.Contains(status, "It's bob's turn.") {
+		t.Errorf("Status() = %q, want it to still be bob's turn", status)
+	}
+}
+
+func TestTrackerKeepsUnreadableEncounter(t *testing.T) {
+	store := storage.NewFileStore(t.TempDir())
+	key := storage.DBPath + "/encounter-1.json"
+	unreadable := []byte("{not json")
+	if err := store.Put(key, unreadable); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	tracker := newTestTracker(t, store)
+
+	if _, err := tracker.Start(chatID); err == nil || !strings.Contains(err.Error(), "failed to load encounter") {
+		t.Errorf("Start() error = %v, want the load error", err)
+	}
+	if tracker.Active(chatID) {
+		t.Errorf("Active() = true, want false for an unreadable encounter")
+	}
+
+	value, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if string(value) != string(unreadable) {
+		t.Errorf("encounter = %q, want it left untouched as %q", value, unreadable)
+	}
+}
@@ -0,0 +1,61 @@
+package combat
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gtrindade/ultra-kiew/internal/mysql"
+)
+
+var (
+	leadingNumberPattern = regexp.MustCompile(`^\s*([+-]?\d+)`)
+	averageHPPattern     = regexp.MustCompile(`\((\d+)\s*hp\)`)
+	parenthesesPattern   = regexp.MustCompile(`\s*\([^)]*\)`)
+)
+
+// leadingNumber parses the number a stat block entry starts with, like the 5
+// in "+5 (+1 Dex, +4 Improved Initiative)".
+func leadingNumber(text string) (int, bool) {
+	match := leadingNumberPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	number, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+// pickMonster returns the monster named exactly name, or the first match.
+func pickMonster(monsters []*mysql.Monster, name string) *mysql.Monster {
+	for _, monster := range monsters {
+		if strings.EqualFold(monster.Name, name) {
+			return monster
+		}
+	}
+	if len(monsters) == 0 {
+		return nil
+	}
+	return monsters[0]
+}
+
+// newMonster creates a combatant from a stat block, with its average hit points.
+func newMonster(name string, monster *mysql.Monster) *Combatant {
+	combatant := &Combatant{Name: name, Monster: true}
+	if monster.Initiative != nil {
+		combatant.Bonus, _ = leadingNumber(*monster.Initiative)
+	}
+	if monster.HitDice != nil {
+		if match := averageHPPattern.FindStringSubmatch(*monster.HitDice); match != nil {
+			combatant.MaxHP, _ = strconv.Atoi(match[1])
+			combatant.HP = combatant.MaxHP
+		}
+	}
+	if monster.ArmorClass != nil {
+		// "16 (-1 size, +7 natural), touch 9, flat-footed 16" becomes "16, touch 9, flat-footed 16".
+		combatant.AC = strings.TrimSpace(parenthesesPattern.ReplaceAllString(*monster.ArmorClass, ""))
+	}
+	return combatant
+}
@@ -0,0 +1,190 @@
+package combat
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+	"google.golang.org/genai"
+)
+
+const (
+	// CombatToolName is the name of the tool that runs encounters.
+	CombatToolName = "combat"
+
+	actionStart           = "start"
+	actionStop            = "stop"
+	actionStatus          = "status"
+	actionAdd             = "add"
+	actionAddMonster      = "add_monster"
+	actionRemove          = "remove"
+	actionNext            = "next"
+	actionDamage          = "damage"
+	actionHeal            = "heal"
+	actionSetHP           = "set_hp"
+	actionSetInitiative   = "set_initiative"
+	actionAddCondition    = "add_condition"
+	actionRemoveCondition = "remove_condition"
+)
+
+var validActions = []string{
+	actionStart, actionStop, actionStatus, actionAdd, actionAddMonster, actionRemove, actionNext,
+	actionDamage, actionHeal, actionSetHP, actionSetInitiative, actionAddCondition, actionRemoveCondition,
+}
+
+// Handle runs a combat action requested by the model in the chat of ctx.
+func (t *Tracker) Handle(ctx context.Context, args map[string]any) (string, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 {
+		return "", fmt.Errorf("encounters are only available inside a chat")
+	}
+
+	action, ok := args["action"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid argument: action is missing or not a string")
+	}
+	name, _ := args["name"].(string)
+	if name == "" && needsName(action) {
+		return "", fmt.Errorf("invalid argument: name is required when action is %q", action)
+	}
+	amount, hasAmount := intArg(args, "amount")
+	if !hasAmount && needsAmount(action) {
+		return "", fmt.Errorf("invalid argument: amount is required when action is %q", action)
+	}
+
+	switch action {
+	case actionStart:
+		return t.Start(chatID)
+	case actionStop:
+		return t.Stop(chatID)
+	case actionStatus:
+		return t.Status(chatID)
+	case actionAdd:
+		var initiative *int
+		if value, ok := intArg(args, "initiative"); ok {
+			initiative = &value
+		}
+		return t.AddCharacter(ctx, chatID, name, initiative)
+	case actionAddMonster:
+		count, ok := intArg(args, "count")
+		if !ok {
+			count = 1
+		}
+		return t.AddMonsters(ctx, chatID, name, count)
+	case actionRemove:
+		return t.Remove(chatID, name)
+	case actionNext:
+		return t.Next(chatID)
+	case actionDamage:
+		return t.Damage(chatID, name, amount)
+	case actionHeal:
+		return t.Damage(chatID, name, -amount)
+	case actionSetHP:
+		maxHP, _ := intArg(args, "max_hp")
+		return t.SetHP(chatID, name, amount, maxHP)
+	case actionSetInitiative:
+		return t.SetInitiative(chatID, name, amount)
+	case actionAddCondition:
+		condition, _ := args["condition"].(string)
+		rounds, _ := intArg(args, "rounds")
+		return t.AddCondition(chatID, name, condition, rounds)
+	case actionRemoveCondition:
+		condition, _ := args["condition"].(string)
+		return t.RemoveCondition(chatID, name, condition)
+	default:
+		return "", fmt.Errorf("unknown action: %s, must be one of %v", action, validActions)
+	}
+}
+
+func needsName(action string) bool {
+	switch action {
+	case actionStart, actionStop, actionStatus, actionNext:
+		return false
+	}
+	return true
+}
+
+func needsAmount(action string) bool {
+	switch action {
+	case actionDamage, actionHeal, actionSetHP, actionSetInitiative:
+		return true
+	}
+	return false
+}
+
+func intArg(args map[string]any, key string) (int, bool) {
+	switch value := args[key].(type) {
+	case float64:
+		return int(value), true
+	case int:
+		return value, true
+	}
+	return 0, false
+}
+
+// GetTool returns the combat tool.
+func (t *Tracker) GetTool() *tools.Tool {
+	return &tools.Tool{
+		Declaration: &genai.FunctionDeclaration{
+			Name: CombatToolName,
+			Description: `Runs the combat encounter of the chat: initiative order, turns, rounds, hit points and conditions.
+
+			Actions:
+			- start: starts an encounter; stop: ends it; status: shows the initiative order and whose turn it is
+			- add: adds a player character, taking its initiative modifier, hp and ac from chat_data and rolling initiative unless given
+			- add_monster: adds count monsters from the SRD by name, rolling their initiative and using their average hit points
+			- remove: takes a combatant out of the encounter
+			- next: ends the current turn and starts the next one, advancing the round when everyone acted
+			- damage and heal: changes the hit points of a combatant by amount; set_hp sets them to amount, and max_hp if given
+			- set_initiative: sets the initiative of a combatant to amount
+			- add_condition and remove_condition: tracks conditions like prone or hasted, optionally lasting a number of rounds that count down at the end of the combatant's turns`,
+			Parameters: &genai.Schema{
+				Type: "object",
+				Properties: map[string]*genai.Schema{
+					"action": {
+						Type:        "string",
+						Description: "The action to perform",
+						Enum:        validActions,
+					},
+					"name": {
+						Type:        "string",
+						Description: "The combatant, or the monster to look up for add_monster",
+					},
+					"amount": {
+						Type:        "integer",
+						Description: "Damage, healing, hit points or initiative, depending on the action",
+					},
+					"max_hp": {
+						Type:        "integer",
+						Description: "Maximum hit points for set_hp",
+					},
+					"initiative": {
+						Type:        "integer",
+						Description: "Initiative already rolled by the player, for add",
+					},
+					"count": {
+						Type:        "integer",
+						Description: "Number of monsters to add, defaults to 1",
+					},
+					"condition": {
+						Type:        "string",
+						Description: "The condition to add or remove",
+					},
+					"rounds": {
+						Type:        "integer",
+						Description: "How many rounds the condition lasts, leave empty for conditions lasting until removed",
+					},
+				},
+				Required: []string{"action"},
+			},
+		},
+		Handler: t.Handle,
+		ActionRoles: map[string]auth.Role{
+			actionStart:      auth.RoleGM,
+			actionStop:       auth.RoleGM,
+			actionAddMonster: auth.RoleGM,
+		},
+		DefaultEnabled: true,
+	}
+}
@@ -19,17 +19,67 @@ type DBConfig struct {
 	Name     string `yaml:"name"`
 }
 
+// CompactionConfig controls when a chat's model history is summarized into campaign memory.
+type CompactionConfig struct {
+	MaxMessages int `yaml:"max_messages"`
+	MaxTokens   int `yaml:"max_tokens"`
+	KeepRecent  int `yaml:"keep_recent"`
+}
+
+// RolesConfig assigns bot roles to Telegram user IDs.
+type RolesConfig struct {
+	// Owners can do anything, in every chat.
+	Owners []int64 `yaml:"owners"`
+	// GameMasters maps a chat ID to the IDs of the users who run the game there.
+	GameMasters map[int64][]int64 `yaml:"game_masters"`
+}
+
+// StorageConfig selects where the bot keeps its state.
+type StorageConfig struct {
+	// Backend is "file", the default, to keep every value in its own file, or
+	// "bolt" to keep them all in an embedded database.
+	Backend string `yaml:"backend"`
+	// Path is the database file of the bolt backend, data/state.db by default.
+	Path string `yaml:"path"`
+	// EncryptionKey is a base64 AES key that enables encrypting the stored
+	// state. The ENCRYPTION_KEY environment variable overrides it.
+	EncryptionKey string `yaml:"encryption_key"`
+	// OldEncryptionKeys can still decrypt the state while rotating keys.
+	OldEncryptionKeys []string `yaml:"old_encryption_keys"`
+}
+
+// BackupConfig controls the snapshots of the bot state.
+type BackupConfig struct {
+	// Directory is where snapshots are written, backups by default.
+	Directory string `yaml:"directory"`
+	// Interval is how often a snapshot is taken, like "6h". It defaults to
+	// a day, and "0" disables scheduled snapshots.
+	Interval string `yaml:"interval"`
+	// Keep is how many snapshots are kept, 7 by default.
+	Keep int `yaml:"keep"`
+}
+
 type Config struct {
-	TelegramBotToken string         `yaml:"telegram_bot_token"`
-	GeminiAPIKey     string         `yaml:"gemini_api_key"`
-	BotName          string         `yaml:"bot_name"`
-	DNDTools         *DBConfig      `yaml:"dnd_tools"`
-	SRD              *DBConfig      `yaml:"srd"`
-	FoundryVTT       *FoundryConfig `yaml:"foundry_vtt"`
+	TelegramBotToken string            `yaml:"telegram_bot_token"`
+	GeminiAPIKey     string            `yaml:"gemini_api_key"`
+	BotName          string            `yaml:"bot_name"`
+	ReplyFormat      string            `yaml:"reply_format"`
+	DisableStreaming bool              `yaml:"disable_streaming"`
+	DNDTools         *DBConfig         `yaml:"dnd_tools"`
+	SRD              *DBConfig         `yaml:"srd"`
+	FoundryVTT       *FoundryConfig    `yaml:"foundry_vtt"`
+	Compaction       *CompactionConfig `yaml:"compaction"`
+	Roles            *RolesConfig      `yaml:"roles"`
+	Storage          *StorageConfig    `yaml:"storage"`
+	Backup           *BackupConfig     `yaml:"backup"`
 }
 
 const (
 	configFilePath = "config.yaml"
+
+	// EncryptionKeyEnv is the environment variable overriding the storage
+	// encryption key.
+	EncryptionKeyEnv = "ENCRYPTION_KEY"
 )
 
 // LoadFromFile loads the configuration from config.yaml file
@@ -45,5 +95,12 @@ func LoadFromFile() (*Config, error) {
 		return nil, err
 	}
 
+	if key := os.Getenv(EncryptionKeyEnv); key != "" {
+		if config.Storage == nil {
+			config.Storage = &StorageConfig{}
+		}
+		config.Storage.EncryptionKey = key
+	}
+
 	return &config, nil
 }
@@ -1,9 +1,14 @@
 package diceroller
 
 import (
+	"context"
 	"fmt"
+	"math/rand/v2"
+	"sync"
 
-	"github.com/justinian/dice"
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
 	"google.golang.org/genai"
 )
 
@@ -12,41 +17,117 @@ const (
 	RollDice = "roll_dice"
 )
 
-func Roll(prompt string) (string, error) {
-	result, _, err := dice.Roll(prompt)
+// Client rolls dice and records every roll in the log of the chat it was made in.
+type Client struct {
+	storage    *storage.Client
+	whisperer  Whisperer
+	properties Properties
+
+	// lock guards rng, which is not safe for concurrent use, and the log appends.
+	lock sync.Mutex
+	rng  *rand.Rand
+}
+
+// NewClient creates a Client drawing random numbers from source. A nil source
+// uses a randomly seeded generator; pass a seeded one, e.g. rand.NewPCG(1, 2),
+// to get the same rolls every time.
+func NewClient(storageClient *storage.Client, source rand.Source) *Client {
+	if source == nil {
+		source = rand.NewPCG(rand.Uint64(), rand.Uint64())
+	}
+	return &Client{
+		storage: storageClient,
+		rng:     rand.New(source),
+	}
+}
+
+// Roll parses and rolls a dice expression like "1d20+5 [str] +2 [bless]" for
+// the caller in ctx, recording it in the roll log of the caller's chat.
+func (c *Client) Roll(ctx context.Context, prompt string) (*Result, error) {
+	return c.roll(ctx, prompt, false)
+}
+
+func (c *Client) roll(ctx context.Context, prompt string, secret bool) (*Result, error) {
+	expr, err := Parse(prompt)
 	if err != nil {
-		return "", fmt.Errorf("failed to roll dice: %w", err)
+		return nil, fmt.Errorf("failed to roll dice: %w", err)
 	}
-	return result.String(), nil
+
+	// Rolls are recorded under the lock so the log keeps the order they were made in.
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := expr.Roll(c.rng)
+	err = c.record(auth.IdentityFromContext(ctx), result, secret)
+	if err != nil {
+		fmt.Printf("Failed to record roll %q: %v\n", prompt, err)
+	}
+	return result, nil
 }
 
-func RollWithArgs(args map[string]any) (string, error) {
+func (c *Client) RollWithArgs(ctx context.Context, args map[string]any) (string, error) {
 	prompt, ok := args["prompt"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: prompt is required")
 	}
 
-	return Roll(prompt)
+	if secret, _ := args["secret"].(bool); secret {
+		announcement, err := c.SecretRoll(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		return announcement + " The result was sent privately to the GM: don't guess or make up the result.", nil
+	}
+
+	if IsMacroName(prompt) {
+		macro, err := c.RollMacro(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		return macro.String(), nil
+	}
+
+	result, err := c.RollExpanded(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
 }
 
-func GetToolConfig() *genai.Tool {
-	return &genai.Tool{
-		FunctionDeclarations: []*genai.FunctionDeclaration{
-			{
-				Name:        RollDice,
-				Description: "Rolls a dice. Make sure to always provide the dice result and the total in a very concise way.",
-				Parameters: &genai.Schema{
-					Type: "object",
-					Properties: map[string]*genai.Schema{
-						"prompt": {
-							Type:        "string",
-							Description: "The prompt to roll the dice",
-							Example:     "1d20+4",
-						},
+// GetTool returns the roll_dice tool.
+func (c *Client) GetTool() *tools.Tool {
+	return &tools.Tool{
+		Declaration: &genai.FunctionDeclaration{
+			Name: RollDice,
+			Description: `Rolls dice. Make sure to always provide the dice result and the total in a very concise way, and to mention natural 20s and 1s.
+
+			Expressions are terms joined by + or -, each a number or dice like 2d6. Dice accept modifiers:
+			- k3 or kh3 keeps the 3 highest dice, kl1 keeps the lowest (2d20kh1 is advantage, 2d20kl1 disadvantage)
+			- d1 or dl1 drops the lowest die, dh1 drops the highest
+			- ! explodes dice that roll their maximum, !5 explodes on 5 or more
+			- r2 rerolls, once, dice that roll 2 or less
+			Terms can be labeled with square brackets, e.g. 1d20+5 [str] +2 [bless], and "6x 4d6k3" repeats a roll 6 times.
+			Dropped dice are shown between tildes.
+			Characters can have macros saved with chat_data, like bob.attack set to "1d20+7; 1d8+4": to roll Bob's attack, pass the path bob.attack as the prompt.
+			Expressions can reference numeric character properties with @, like 1d20 + @bob.str_mod.
+			Set secret for hidden rolls the players shouldn't see, like the GM's perception checks: the result is sent privately to the GM.`,
+			Parameters: &genai.Schema{
+				Type: "object",
+				Properties: map[string]*genai.Schema{
+					"prompt": {
+						Type:        "string",
+						Description: "The dice expression to roll",
+						Example:     "1d20+4 [str]",
+					},
+					"secret": {
+						Type:        "boolean",
+						Description: "Send the result privately to the GM instead of showing it in the chat",
 					},
-					Required: []string{"prompt"},
 				},
+				Required: []string{"prompt"},
 			},
 		},
+		Handler:        c.RollWithArgs,
+		DefaultEnabled: true,
 	}
 }
@@ -0,0 +1,349 @@
+package diceroller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxDice is the maximum number of dice a single term can roll.
+	MaxDice = 100
+	// MaxSides is the maximum number of sides of a die.
+	MaxSides = 1000
+	// MaxRepeats is the maximum number of times an expression can be repeated.
+	MaxRepeats = 20
+	// MaxExplosions is the maximum number of extra dice exploding dice can add to a term.
+	MaxExplosions = 100
+)
+
+// Expression is a parsed dice expression like "6x 4d6k3" or "1d20+5 [str] +2 [bless]".
+type Expression struct {
+	// Text is the expression as written by the user.
+	Text string
+	// Repeat is the number of times the expression is rolled.
+	Repeat int
+	// Terms are added together to get the total.
+	Terms []*Term
+}
+
+// Term is a group of dice or a constant in an expression.
+type Term struct {
+	// Negative is set for terms subtracted from the total.
+	Negative bool
+	// Count is the number of dice rolled, 0 for constants.
+	Count int
+	// Sides is the number of sides of the dice, 0 for constants.
+	Sides int
+	// Constant is the value of a term without dice.
+	Constant int
+	// Keep selects the dice that count towards the subtotal, nil to keep all of them.
+	Keep *Selection
+	// Explode is the value at or above which a die adds another die, 0 to never explode.
+	Explode int
+	// Reroll is the value at or below which a die is rolled again once, 0 to never reroll.
+	Reroll int
+	// Label describes the term, e.g. "str" in "+5 [str]".
+	Label string
+}
+
+// Selection keeps or drops the highest or lowest dice of a term.
+type Selection struct {
+	// Drop is set when the selected dice are discarded instead of kept.
+	Drop bool
+	// Lowest is set when the lowest dice are selected instead of the highest.
+	Lowest bool
+	// Count is the number of dice selected.
+	Count int
+}
+
+// IsDice tells whether the term rolls dice.
+func (t *Term) IsDice() bool {
+	return t.Sides > 0
+}
+
+// String renders the term without its sign and label, e.g. "4d6k3".
+func (t *Term) String() string {
+	if !t.IsDice() {
+		return strconv.Itoa(t.Constant)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%dd%d", t.Count, t.Sides)
+	if t.Reroll > 0 {
+		fmt.Fprintf(&sb, "r%d", t.Reroll)
+	}
+	if t.Explode > 0 {
+		sb.WriteString("!")
+		if t.Explode != t.Sides {
+			sb.WriteString(strconv.Itoa(t.Explode))
+		}
+	}
+	if t.Keep != nil {
+		mode := "k"
+		if t.Keep.Drop {
+			mode = "d"
+		}
+		side := "h"
+		if t.Keep.Lowest {
+			side = "l"
+		}
+		fmt.Fprintf(&sb, "%s%s%d", mode, side, t.Keep.Count)
+	}
+	return sb.String()
+}
+
+// Parse parses a dice expression.
+//
+// Terms are joined by + or - and are either constants or dice in the form
+// NdS, where N defaults to 1 and S may be % for 100. Dice accept these
+// modifiers, in any order:
+//   - kN or khN keeps the N highest dice, klN keeps the N lowest
+//   - dN or dlN drops the N lowest dice, dhN drops the N highest
+//   - ! explodes dice that roll their maximum, !N explodes dice rolling N or more
+//   - rN rerolls, once, dice rolling N or less, r<N rerolls dice rolling less than N
+//
+// Any term may be followed by a label in square brackets, and the whole
+// expression may be prefixed by "Nx " to roll it N times.
+func Parse(text string) (*Expression, error) {
+	p := &parser{input: strings.TrimSpace(text)}
+	if p.input == "" {
+		return nil, fmt.Errorf("empty dice expression")
+	}
+
+	expr := &Expression{Text: p.input, Repeat: 1}
+	if repeat, ok := p.repeat(); ok {
+		if repeat < 1 || repeat > MaxRepeats {
+			return nil, fmt.Errorf("can only repeat a roll between 1 and %d times", MaxRepeats)
+		}
+		expr.Repeat = repeat
+	}
+
+	for {
+		p.skipSpaces()
+		if p.done() {
+			break
+		}
+
+		negative := false
+		switch p.peek() {
+		case '+':
+			p.pos++
+		case '-':
+			p.pos++
+			negative = true
+		default:
+			if len(expr.Terms) > 0 {
+				return nil, p.errorf("expected + or -")
+			}
+		}
+
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		term.Negative = negative
+		expr.Terms = append(expr.Terms, term)
+	}
+
+	if len(expr.Terms) == 0 {
+		return nil, fmt.Errorf("dice expression %q has no terms", text)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+// peek returns the next byte of the input, lowercased.
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	c := p.input[p.pos]
+	if c >= 'A' && c <= 'Z' {
+		c += 'a' - 'A'
+	}
+	return c
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid dice expression at position %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// number reads an unsigned integer, reporting false if there is none.
+func (p *parser) number() (int, bool, error) {
+	start := p.pos
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if start == p.pos {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(p.input[start:p.pos])
+	if err != nil {
+		return 0, false, p.errorf("number %s is too large", p.input[start:p.pos])
+	}
+	return n, true, nil
+}
+
+// repeat reads a "Nx" prefix, leaving the parser untouched when there is none.
+func (p *parser) repeat() (int, bool) {
+	start := p.pos
+	n, ok, err := p.number()
+	if err == nil && ok && p.peek() == 'x' {
+		p.pos++
+		return n, true
+	}
+	p.pos = start
+	return 0, false
+}
+
+func (p *parser) term() (*Term, error) {
+	p.skipSpaces()
+	n, hasNumber, err := p.number()
+	if err != nil {
+		return nil, err
+	}
+
+	term := &Term{}
+	if p.peek() != 'd' {
+		if !hasNumber {
+			return nil, p.errorf("expected a number or dice")
+		}
+		term.Constant = n
+		return term, p.label(term)
+	}
+
+	p.pos++
+	term.Count = 1
+	if hasNumber {
+		term.Count = n
+	}
+	if p.peek() == '%' {
+		p.pos++
+		term.Sides = 100
+	} else {
+		sides, ok, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, p.errorf("expected the number of sides")
+		}
+		term.Sides = sides
+	}
+	if term.Count < 1 || term.Count > MaxDice {
+		return nil, fmt.Errorf("can only roll between 1 and %d dice at once", MaxDice)
+	}
+	if term.Sides < 2 || term.Sides > MaxSides {
+		return nil, fmt.Errorf("dice must have between 2 and %d sides", MaxSides)
+	}
+
+	err = p.modifiers(term)
+	if err != nil {
+		return nil, err
+	}
+	return term, p.label(term)
+}
+
+func (p *parser) modifiers(term *Term) error {
+	for !p.done() {
+		switch p.peek() {
+		case 'k', 'd':
+			if term.Keep != nil {
+				return p.errorf("only one keep or drop modifier is allowed")
+			}
+			selection := &Selection{Drop: p.peek() == 'd'}
+			p.pos++
+			switch p.peek() {
+			case 'h':
+				p.pos++
+			case 'l':
+				p.pos++
+				selection.Lowest = true
+			default:
+				// Plain "k" keeps the highest dice and plain "d" drops the lowest.
+				selection.Lowest = selection.Drop
+			}
+			count, ok, err := p.number()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				count = 1
+			}
+			if !selection.Drop && (count < 1 || count > term.Count) {
+				return fmt.Errorf("can only keep between 1 and %d of %d dice", term.Count, term.Count)
+			}
+			if selection.Drop && (count < 1 || count >= term.Count) {
+				return fmt.Errorf("can only drop between 1 and %d of %d dice", term.Count-1, term.Count)
+			}
+			selection.Count = count
+			term.Keep = selection
+		case '!':
+			p.pos++
+			threshold, ok, err := p.number()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				threshold = term.Sides
+			}
+			if threshold < 2 || threshold > term.Sides {
+				return fmt.Errorf("exploding dice need a threshold between 2 and %d", term.Sides)
+			}
+			term.Explode = threshold
+		case 'r':
+			p.pos++
+			below := p.peek() == '<'
+			if below {
+				p.pos++
+			}
+			threshold, ok, err := p.number()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return p.errorf("expected the reroll threshold")
+			}
+			if below {
+				threshold--
+			}
+			if threshold < 1 || threshold >= term.Sides {
+				return fmt.Errorf("rerolls need a threshold between 1 and %d", term.Sides-1)
+			}
+			term.Reroll = threshold
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// label reads an optional "[label]" after a term.
+func (p *parser) label(term *Term) error {
+	p.skipSpaces()
+	if p.peek() != '[' {
+		return nil
+	}
+	end := strings.IndexByte(p.input[p.pos:], ']')
+	if end < 0 {
+		return p.errorf("unterminated label")
+	}
+	term.Label = strings.TrimSpace(p.input[p.pos+1 : p.pos+end])
+	p.pos += end + 1
+	return nil
+}
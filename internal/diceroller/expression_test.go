@@ -0,0 +1,107 @@
+package diceroller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		repeat int
+		terms  []*Term
+	}{
+		{"1d20+5", 1, []*Term{{Count: 1, Sides: 20}, {Constant: 5}}},
+		{"d%", 1, []*Term{{Count: 1, Sides: 100}}},
+		{"-1d4", 1, []*Term{{Negative: true, Count: 1, Sides: 4}}},
+		{"1d20 - 2 [penalty] + 3", 1, []*Term{
+			{Count: 1, Sides: 20},
+			{Negative: true, Constant: 2, Label: "penalty"},
+			{Constant: 3},
+		}},
+		{"1d20+5 [str] +2 [bless]", 1, []*Term{
+			{Count: 1, Sides: 20},
+			{Constant: 5, Label: "str"},
+			{Constant: 2, Label: "bless"},
+		}},
+		{"6x 4d6k3", 6, []*Term{{Count: 4, Sides: 6, Keep: &Selection{Count: 3}}}},
+		{"4d6kh3", 1, []*Term{{Count: 4, Sides: 6, Keep: &Selection{Count: 3}}}},
+		{"2d20kl1", 1, []*Term{{Count: 2, Sides: 20, Keep: &Selection{Lowest: true, Count: 1}}}},
+		{"2d20k", 1, []*Term{{Count: 2, Sides: 20, Keep: &Selection{Count: 1}}}},
+		{"4d6d1", 1, []*Term{{Count: 4, Sides: 6, Keep: &Selection{Drop: true, Lowest: true, Count: 1}}}},
+		{"4d6dh1", 1, []*Term{{Count: 4, Sides: 6, Keep: &Selection{Drop: true, Count: 1}}}},
+		{"2D6K1", 1, []*Term{{Count: 2, Sides: 6, Keep: &Selection{Count: 1}}}},
+		{"2d6!", 1, []*Term{{Count: 2, Sides: 6, Explode: 6}}},
+		{"3d10!9", 1, []*Term{{Count: 3, Sides: 10, Explode: 9}}},
+		{"1d20r1", 1, []*Term{{Count: 1, Sides: 20, Reroll: 1}}},
+		{"1d6r<3", 1, []*Term{{Count: 1, Sides: 6, Reroll: 2}}},
+		{"4d6r1!k3", 1, []*Term{{Count: 4, Sides: 6, Reroll: 1, Explode: 6, Keep: &Selection{Count: 3}}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			expr, err := Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			if expr.Repeat != test.repeat {
+				t.Errorf("Repeat = %d, want %d", expr.Repeat, test.repeat)
+			}
+			if !reflect.DeepEqual(expr.Terms, test.terms) {
+				t.Errorf("Terms = %s, want %s", formatTerms(expr.Terms), formatTerms(test.terms))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "empty dice expression"},
+		{"1d20 5", "position 6: expected + or -"},
+		{"1d", "position 3: expected the number of sides"},
+		{"1d20+", "position 6: expected a number or dice"},
+		{"1d20r", "position 6: expected the reroll threshold"},
+		{"1d20 [str", "position 6: unterminated label"},
+		{"4d6k2k1", "only one keep or drop modifier is allowed"},
+		{"4d6k5", "can only keep between 1 and 4 of 4 dice"},
+		{"4d6k0", "can only keep between 1 and 4 of 4 dice"},
+		{"4d6d4", "can only drop between 1 and 3 of 4 dice"},
+		{"21x 1d20", "can only repeat a roll between 1 and 20 times"},
+		{"101d6", "can only roll between 1 and 100 dice at once"},
+		{"1d1", "dice must have between 2 and 1000 sides"},
+		{"1d6!7", "exploding dice need a threshold between 2 and 6"},
+		{"1d6r6", "rerolls need a threshold between 1 and 5"},
+		{"99999999999999999999d6", "number 99999999999999999999 is too large"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := Parse(test.input)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want an error containing %q", test.input, test.want)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", test.input, err, test.want)
+			}
+		})
+	}
+}
+
+func formatTerms(terms []*Term) string {
+	var parts []string
+	for _, term := range terms {
+		text := term.String()
+		if term.Negative {
+			text = "-" + text
+		}
+		if term.Label != "" {
+			text += " [" + term.Label + "]"
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,139 @@
+package diceroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+)
+
+const (
+	// RollLogFile is the name of the append-only file holding a chat's rolls, one JSON entry per line.
+	RollLogFile = "roll-log-%d.jsonl"
+)
+
+// LogEntry is a roll recorded in a chat's roll log.
+type LogEntry struct {
+	Time       time.Time     `json:"time"`
+	UserID     int64         `json:"user_id"`
+	UserName   string        `json:"user_name"`
+	Expression string        `json:"expression"`
+	Rolls      []*LoggedRoll `json:"rolls"`
+	// Secret is set for rolls whose result was only sent to the GM.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// LoggedRoll is a single repetition of a logged roll.
+type LoggedRoll struct {
+	Breakdown string `json:"breakdown"`
+	Dice      []*Die `json:"dice"`
+	Total     int    `json:"total"`
+	Natural20 bool   `json:"natural20,omitempty"`
+	Natural1  bool   `json:"natural1,omitempty"`
+}
+
+// String renders the entry like "2025-01-02 20:15 bob: 1d20+5 → 1d20 [17] + 5 = 22".
+// The results of secret rolls are left out.
+func (e *LogEntry) String() string {
+	name := e.UserName
+	if name == "" {
+		name = "someone"
+	}
+	text := fmt.Sprintf("%s %s: %s →", e.Time.Format("2006-01-02 15:04"), name, e.Expression)
+	if e.Secret {
+		return text + " secret roll, sent to the GM"
+	}
+
+	results := make([]string, 0, len(e.Rolls))
+	for _, roll := range e.Rolls {
+		result := fmt.Sprintf("%s = %d", roll.Breakdown, roll.Total)
+		switch {
+		case roll.Natural20:
+			result += " (natural 20!)"
+		case roll.Natural1:
+			result += " (natural 1!)"
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 1 {
+		return text + " " + results[0]
+	}
+	for _, result := range results {
+		text += "\n  " + result
+	}
+	return text
+}
+
+// record appends a roll to the log of the chat of identity. Rolls made outside of a chat are not logged.
+func (c *Client) record(identity auth.Identity, result *Result, secret bool) error {
+	if identity.ChatID == 0 {
+		return nil
+	}
+
+	entry := &LogEntry{
+		Time:       time.Now(),
+		UserID:     identity.UserID,
+		UserName:   identity.UserName,
+		Expression: result.Expression.Text,
+		Secret:     secret,
+	}
+	for _, roll := range result.Rolls {
+		logged := &LoggedRoll{
+			Breakdown: roll.Breakdown(),
+			Total:     roll.Total,
+			Natural20: roll.Natural20,
+			Natural1:  roll.Natural1,
+		}
+		for _, term := range roll.Terms {
+			logged.Dice = append(logged.Dice, term.Dice...)
+		}
+		entry.Rolls = append(entry.Rolls, logged)
+	}
+
+	return c.storage.AppendToDB(fmt.Sprintf(RollLogFile, identity.ChatID), entry)
+}
+
+// Log returns every roll recorded in a chat, oldest first.
+func (c *Client) Log(chatID int64) ([]*LogEntry, error) {
+	var entries []*LogEntry
+	err := c.storage.LoadLinesFromDB(fmt.Sprintf(RollLogFile, chatID), func(line []byte) error {
+		entry := &LogEntry{}
+		if err := json.Unmarshal(line, entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roll log: %w", err)
+	}
+	return entries, nil
+}
+
+// RecentRolls returns a page of a chat's rolls, newest first, along with the
+// number of pages. Pages start at 1.
+func (c *Client) RecentRolls(chatID int64, page, pageSize int) ([]*LogEntry, int, error) {
+	if pageSize < 1 {
+		return nil, 0, fmt.Errorf("the page size must be at least 1, got %d", pageSize)
+	}
+
+	entries, err := c.Log(chatID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pages := (len(entries) + pageSize - 1) / pageSize
+	if page < 1 || page > pages {
+		return nil, pages, nil
+	}
+
+	end := len(entries) - (page-1)*pageSize
+	start := max(end-pageSize, 0)
+	recent := make([]*LogEntry, 0, end-start)
+	for i := end - 1; i >= start; i-- {
+		recent = append(recent, entries[i])
+	}
+	return recent, pages, nil
+}
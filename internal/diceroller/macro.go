@@ -0,0 +1,201 @@
+package diceroller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+)
+
+const (
+	// macroSeparator separates the expressions of a macro, as in "1d20+7; 1d8+4".
+	macroSeparator = ";"
+)
+
+var (
+	macroNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\.[A-Za-z0-9_]+$`)
+	referencePattern = regexp.MustCompile(`@([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z0-9_]+)?)`)
+)
+
+// Properties looks up the character properties stored for a chat, such as
+// "bob.attack" or "bob.str_mod".
+type Properties interface {
+	CharacterProperty(chatID int64, path string) (string, bool)
+}
+
+// SetProperties sets where macros and @references are looked up.
+func (c *Client) SetProperties(properties Properties) {
+	c.properties = properties
+}
+
+// IsMacroName tells whether text names a macro, like "bob.attack", rather than being a dice expression.
+func IsMacroName(text string) bool {
+	return macroNamePattern.MatchString(strings.TrimSpace(text))
+}
+
+// MacroRoll is the result of rolling a named macro.
+type MacroRoll struct {
+	// Name is the macro path, like "bob.attack".
+	Name string
+	// Results holds one result per expression of the macro.
+	Results []*Result
+}
+
+// String renders the macro name followed by each of its results.
+func (m *MacroRoll) String() string {
+	lines := []string{m.Name + ":"}
+	for _, result := range m.Results {
+		lines = append(lines, result.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RollMacro rolls every expression of the macro stored at name, like
+// "bob.attack", in the chat of the caller in ctx.
+func (c *Client) RollMacro(ctx context.Context, name string) (*MacroRoll, error) {
+	return c.rollMacro(ctx, name, false)
+}
+
+func (c *Client) rollMacro(ctx context.Context, name string, secret bool) (*MacroRoll, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 || c.properties == nil {
+		return nil, fmt.Errorf("macros are only available inside a chat")
+	}
+
+	name = strings.TrimSpace(name)
+	macro, exists := c.properties.CharacterProperty(chatID, name)
+	if !exists {
+		return nil, fmt.Errorf("there is no macro called %s, save one with e.g. %s = 1d20+5", name, name)
+	}
+
+	roll := &MacroRoll{Name: name}
+	character, _, _ := strings.Cut(name, ".")
+	for _, expression := range SplitMacro(macro) {
+		expanded, err := ExpandReferences(expression, character, func(path string) (string, bool) {
+			return c.properties.CharacterProperty(chatID, path)
+		})
+		if err != nil {
+			return nil, err
+		}
+		result, err := c.roll(ctx, expanded, secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to roll %s: %w", name, err)
+		}
+		roll.Results = append(roll.Results, result)
+	}
+	if len(roll.Results) == 0 {
+		return nil, fmt.Errorf("%s is empty", name)
+	}
+	return roll, nil
+}
+
+// RollExpanded rolls a dice expression after replacing its @references with
+// the character properties of the chat of the caller in ctx.
+func (c *Client) RollExpanded(ctx context.Context, prompt string) (*Result, error) {
+	expanded, err := c.expand(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return c.Roll(ctx, expanded)
+}
+
+// expand replaces the @references of prompt with the character properties of
+// the chat of the caller in ctx.
+func (c *Client) expand(ctx context.Context, prompt string) (string, error) {
+	if !strings.Contains(prompt, "@") {
+		return prompt, nil
+	}
+
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 || c.properties == nil {
+		return "", fmt.Errorf("@references are only available inside a chat")
+	}
+	return ExpandReferences(prompt, "", func(path string) (string, bool) {
+		return c.properties.CharacterProperty(chatID, path)
+	})
+}
+
+// SplitMacro returns the non-empty expressions of a macro.
+func SplitMacro(macro string) []string {
+	var expressions []string
+	for _, expression := range strings.Split(macro, macroSeparator) {
+		if expression = strings.TrimSpace(expression); expression != "" {
+			expressions = append(expressions, expression)
+		}
+	}
+	return expressions
+}
+
+// ValidateMacro checks that every expression of a macro parses, treating
+// @references as numbers.
+func ValidateMacro(macro string) error {
+	expressions := SplitMacro(macro)
+	if len(expressions) == 0 {
+		return fmt.Errorf("the macro has no dice expressions")
+	}
+	for _, expression := range expressions {
+		expanded, err := ExpandReferences(expression, "character", func(string) (string, bool) {
+			return "0", true
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := Parse(expanded); err != nil {
+			return fmt.Errorf("invalid expression %q: %w", expression, err)
+		}
+	}
+	return nil
+}
+
+// ExpandReferences replaces the @references of an expression with the numeric
+// properties lookup returns for them. A reference without a character, like
+// @str_mod, refers to a property of character. Negative values flip the sign
+// before them, so "1d20 + @str_mod" with a -1 modifier becomes "1d20 - 1".
+func ExpandReferences(expression, character string, lookup func(path string) (string, bool)) (string, error) {
+	var sb strings.Builder
+	last := 0
+	for _, match := range referencePattern.FindAllStringSubmatchIndex(expression, -1) {
+		path := expression[match[2]:match[3]]
+		if !strings.Contains(path, ".") {
+			if character == "" {
+				return "", fmt.Errorf("@%s needs a character, like @bob.%s", path, path)
+			}
+			path = character + "." + path
+		}
+
+		raw, exists := lookup(path)
+		if !exists {
+			return "", fmt.Errorf("%s is not set", path)
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return "", fmt.Errorf("%s is %q, which is not a whole number", path, raw)
+		}
+
+		// The value replaces the reference as is, so "2d@die" becomes "2d6".
+		before := expression[last:match[0]]
+		if value < 0 {
+			value = -value
+			operator := strings.TrimRight(before, " ")
+			spaces := before[len(operator):]
+			switch {
+			case strings.HasSuffix(operator, "+"):
+				before = strings.TrimSuffix(operator, "+") + "-" + spaces
+			case strings.HasSuffix(operator, "-"):
+				before = strings.TrimSuffix(operator, "-") + "+" + spaces
+			case strings.TrimSpace(sb.String()+operator) == "":
+				before += "-"
+			default:
+				return "", fmt.Errorf("@%s must follow + or -", path)
+			}
+		}
+		sb.WriteString(before)
+		sb.WriteString(strconv.Itoa(value))
+		last = match[1]
+	}
+	sb.WriteString(expression[last:])
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,61 @@
+package diceroller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandReferences(t *testing.T) {
+	properties := map[string]string{
+		"bob.str_mod": "3",
+		"bob.dex_mod": "-1",
+		"bob.die":     "6",
+		"bob.name":    "Bob",
+	}
+	lookup := func(path string) (string, bool) {
+		value, exists := properties[path]
+		return value, exists
+	}
+
+	tests := []struct {
+		expression string
+		character  string
+		want       string
+	}{
+		{"1d20 + @bob.str_mod", "", "1d20 + 3"},
+		{"1d20+@bob.str_mod", "", "1d20+3"},
+		{"1d20 + @str_mod", "bob", "1d20 + 3"},
+		{"2d@bob.die", "", "2d6"},
+		{"1d20 + @bob.dex_mod", "", "1d20 - 1"},
+		{"1d20-@bob.dex_mod", "", "1d20+1"},
+		{"@bob.dex_mod + 1d20", "", "-1 + 1d20"},
+		{"1d8 [@bob.str_mod]", "", "1d8 [3]"},
+	}
+	for _, test := range tests {
+		got, err := ExpandReferences(test.expression, test.character, lookup)
+		if err != nil {
+			t.Errorf("ExpandReferences(%q) error = %v", test.expression, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ExpandReferences(%q) = %q, want %q", test.expression, got, test.want)
+		}
+	}
+
+	errorTests := []struct {
+		expression string
+		character  string
+		want       string
+	}{
+		{"1d20 + @str_mod", "", "@str_mod needs a character"},
+		{"1d20 + @bob.wis_mod", "", "bob.wis_mod is not set"},
+		{"1d20 + @bob.name", "", "not a whole number"},
+		{"2d@bob.dex_mod", "", "must follow + or -"},
+	}
+	for _, test := range errorTests {
+		_, err := ExpandReferences(test.expression, test.character, lookup)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ExpandReferences(%q) error = %v, want it to contain %q", test.expression, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,497 @@
+package diceroller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+	"google.golang.org/genai"
+)
+
+const (
+	// DiceOdds is the name of the function that computes the odds of a dice expression.
+	DiceOdds = "dice_odds"
+
+	// maxOddsWork bounds the number of operations spent computing a distribution.
+	maxOddsWork = 50_000_000
+
+	// explosionCutoff is the probability below which further explosions are ignored.
+	explosionCutoff = 1e-12
+
+	// maxListedTotals is the largest number of totals listed one by one.
+	maxListedTotals = 40
+)
+
+// Comparisons supported by Distribution.Chance.
+const (
+	AtLeast = "at_least"
+	Greater = "greater"
+	AtMost  = "at_most"
+	Less    = "less"
+	Exactly = "exactly"
+)
+
+var (
+	validComparisons = []string{AtLeast, Greater, AtMost, Less, Exactly}
+
+	comparisonNames = map[string]string{
+		AtLeast: "of at least",
+		Greater: "greater than",
+		AtMost:  "of at most",
+		Less:    "less than",
+		Exactly: "of exactly",
+	}
+)
+
+// Distribution is the exact probability distribution of the total of an expression.
+type Distribution struct {
+	// Min is the lowest possible total.
+	Min int
+	// Probabilities holds the chance of each total, Probabilities[i] being the chance of Min+i.
+	Probabilities []float64
+}
+
+// Max returns the highest possible total.
+func (d *Distribution) Max() int {
+	return d.Min + len(d.Probabilities) - 1
+}
+
+// Mean returns the expected total.
+func (d *Distribution) Mean() float64 {
+	var mean float64
+	for i, p := range d.Probabilities {
+		mean += float64(d.Min+i) * p
+	}
+	return mean
+}
+
+// Variance returns the variance of the total.
+func (d *Distribution) Variance() float64 {
+	mean := d.Mean()
+	var variance float64
+	for i, p := range d.Probabilities {
+		diff := float64(d.Min+i) - mean
+		variance += diff * diff * p
+	}
+	return variance
+}
+
+// Chance returns the probability of the total comparing to target as requested,
+// e.g. Chance(AtLeast, 10) is the chance of rolling 10 or more.
+func (d *Distribution) Chance(comparison string, target int) float64 {
+	var chance float64
+	for i, p := range d.Probabilities {
+		if compare(comparison, d.Min+i, target) {
+			chance += p
+		}
+	}
+	return chance
+}
+
+func compare(comparison string, total, target int) bool {
+	switch comparison {
+	case Greater:
+		return total > target
+	case AtMost:
+		return total <= target
+	case Less:
+		return total < target
+	case Exactly:
+		return total == target
+	default:
+		return total >= target
+	}
+}
+
+// Odds computes the exact distribution of a single roll of a dice expression.
+// Repeated expressions are rolled independently, so their repetition count is
+// ignored. Exploding dice are followed until further explosions are
+// negligible, and cannot be combined with keep or drop modifiers.
+func Odds(prompt string) (*Distribution, error) {
+	expr, err := Parse(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute odds: %w", err)
+	}
+	return expr.distribution(nil)
+}
+
+// distribution returns the distribution of the sum of the terms of e, except skip.
+func (e *Expression) distribution(skip *Term) (*Distribution, error) {
+	total := point(0)
+	for _, term := range e.Terms {
+		if term == skip {
+			continue
+		}
+		dist, err := term.distribution()
+		if err != nil {
+			return nil, err
+		}
+		if term.Negative {
+			dist = dist.negate()
+		}
+		total, err = convolve(total, dist)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
+
+func (t *Term) distribution() (*Distribution, error) {
+	if !t.IsDice() {
+		return point(t.Constant), nil
+	}
+
+	die, err := t.dieDistribution()
+	if err != nil {
+		return nil, err
+	}
+	if t.Keep == nil {
+		return repeatDie(die, t.Count)
+	}
+	if t.Explode > 0 {
+		return nil, fmt.Errorf("cannot compute odds of exploding dice with keep or drop modifiers")
+	}
+
+	keep, lowest := t.Keep.Count, t.Keep.Lowest
+	if t.Keep.Drop {
+		keep = t.Count - t.Keep.Count
+		lowest = !lowest
+	}
+	keep = max(min(keep, t.Count), 0)
+	return keepDice(die, t.Count, keep, lowest)
+}
+
+// dieDistribution returns the distribution of a single die of the term, after
+// rerolls and explosions.
+func (t *Term) dieDistribution() (*Distribution, error) {
+	face := 1 / float64(t.Sides)
+	die := &Distribution{Min: 1, Probabilities: make([]float64, t.Sides)}
+	for value := 1; value <= t.Sides; value++ {
+		if value > t.Reroll {
+			die.Probabilities[value-1] += face
+		}
+	}
+	if t.Reroll > 0 {
+		// A rerolled die keeps its second result, whatever it is.
+		rerolled := float64(t.Reroll) * face
+		for value := 1; value <= t.Sides; value++ {
+			die.Probabilities[value-1] += rerolled * face
+		}
+	}
+	if t.Explode == 0 {
+		return die, nil
+	}
+
+	// An exploding die is the face rolled plus, at or above the threshold,
+	// another exploding die. Unroll it one die at a time, carrying the totals
+	// of the faces that exploded so far, until their chance is negligible.
+	split := t.Explode - die.Min
+	stop := &Distribution{Min: die.Min, Probabilities: die.Probabilities[:split]}
+	explode := &Distribution{Min: t.Explode, Probabilities: die.Probabilities[split:]}
+	result := &Distribution{Min: die.Min}
+	exploded := point(0)
+	work := 0
+	for depth := 0; ; depth++ {
+		work += len(exploded.Probabilities) * len(die.Probabilities)
+		if work > maxOddsWork {
+			return nil, fmt.Errorf("the expression is too large to compute its odds")
+		}
+		if depth == MaxExplosions {
+			// The last die rolled cannot explode any further.
+			stop = die
+		}
+		settled, err := convolve(exploded, stop)
+		if err != nil {
+			return nil, err
+		}
+		result.add(settled)
+		if depth == MaxExplosions {
+			return result, nil
+		}
+
+		exploded, err = convolve(exploded, explode)
+		if err != nil {
+			return nil, err
+		}
+		var chance float64
+		for _, p := range exploded.Probabilities {
+			chance += p
+		}
+		if chance <= explosionCutoff {
+			return result, nil
+		}
+	}
+}
+
+// add adds the chances of other to d, which must not start above it.
+func (d *Distribution) add(other *Distribution) {
+	for i, p := range other.Probabilities {
+		index := other.Min - d.Min + i
+		for len(d.Probabilities) <= index {
+			d.Probabilities = append(d.Probabilities, 0)
+		}
+		d.Probabilities[index] += p
+	}
+}
+
+func point(value int) *Distribution {
+	return &Distribution{Min: value, Probabilities: []float64{1}}
+}
+
+func (d *Distribution) negate() *Distribution {
+	negated := &Distribution{Min: -d.Max(), Probabilities: make([]float64, len(d.Probabilities))}
+	for i, p := range d.Probabilities {
+		negated.Probabilities[len(d.Probabilities)-1-i] = p
+	}
+	return negated
+}
+
+func convolve(a, b *Distribution) (*Distribution, error) {
+	if len(a.Probabilities)*len(b.Probabilities) > maxOddsWork {
+		return nil, fmt.Errorf("the expression is too large to compute its odds")
+	}
+	result := &Distribution{Min: a.Min + b.Min, Probabilities: make([]float64, len(a.Probabilities)+len(b.Probabilities)-1)}
+	for i, pa := range a.Probabilities {
+		if pa == 0 {
+			continue
+		}
+		for j, pb := range b.Probabilities {
+			result.Probabilities[i+j] += pa * pb
+		}
+	}
+	return result, nil
+}
+
+func repeatDie(die *Distribution, count int) (*Distribution, error) {
+	total := point(0)
+	for range count {
+		var err error
+		total, err = convolve(total, die)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return total, nil
+}
+
+// keepDice returns the distribution of the sum of the keep highest (or lowest)
+// of count dice. Faces are visited from the best to the worst, deciding how
+// many dice show each one: the first keep dice placed are the ones kept.
+func keepDice(die *Distribution, count, keep int, lowest bool) (*Distribution, error) {
+	faces := len(die.Probabilities)
+	maxSum := keep * die.Max()
+	if faces*count*count*(maxSum+1) > maxOddsWork {
+		return nil, fmt.Errorf("the expression is too large to compute its odds")
+	}
+
+	binomial := make([][]float64, count+1)
+	for n := range binomial {
+		binomial[n] = make([]float64, n+1)
+		binomial[n][0], binomial[n][n] = 1, 1
+		for k := 1; k < n; k++ {
+			binomial[n][k] = binomial[n-1][k-1] + binomial[n-1][k]
+		}
+	}
+
+	// states[placed][sum] is the chance of having placed that many dice with
+	// that sum of kept values, once the faces visited so far are decided.
+	states := make([][]float64, count+1)
+	for i := range states {
+		states[i] = make([]float64, maxSum+1)
+	}
+	states[0][0] = 1
+
+	for step := range faces {
+		i := faces - 1 - step
+		if lowest {
+			i = step
+		}
+		value, p := die.Min+i, die.Probabilities[i]
+
+		next := make([][]float64, count+1)
+		for j := range next {
+			next[j] = make([]float64, maxSum+1)
+		}
+		for placed, sums := range states {
+			for sum, chance := range sums {
+				if chance == 0 {
+					continue
+				}
+				factor := 1.0
+				for c := 0; placed+c <= count; c++ {
+					kept := max(min(c, keep-placed), 0)
+					next[placed+c][sum+kept*value] += chance * binomial[count-placed][c] * factor
+					factor *= p
+				}
+			}
+		}
+		states = next
+	}
+
+	result := &Distribution{Min: 0, Probabilities: states[count]}
+	return result.trim(), nil
+}
+
+// trim removes impossible totals from both ends of the distribution.
+func (d *Distribution) trim() *Distribution {
+	start, end := 0, len(d.Probabilities)
+	for start < end-1 && d.Probabilities[start] == 0 {
+		start++
+	}
+	for end > start+1 && d.Probabilities[end-1] == 0 {
+		end--
+	}
+	return &Distribution{Min: d.Min + start, Probabilities: d.Probabilities[start:end]}
+}
+
+// AttackChance returns the chance of a roll of prompt comparing to target as
+// requested, where a natural 20 always succeeds and a natural 1 always fails,
+// as with attack rolls. The expression must have a lone d20.
+func AttackChance(prompt, comparison string, target int) (float64, error) {
+	expr, err := Parse(prompt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute odds: %w", err)
+	}
+
+	var d20 *Term
+	for _, term := range expr.Terms {
+		if term.Sides == 20 && term.Explode == 0 && !term.Negative && term.keptDice() == 1 {
+			d20 = term
+			break
+		}
+	}
+	if d20 == nil {
+		return 0, fmt.Errorf("natural 20s and 1s only apply to expressions with a single d20, like 1d20+7 or 2d20kh1+7")
+	}
+
+	faces, err := d20.distribution()
+	if err != nil {
+		return 0, err
+	}
+	rest, err := expr.distribution(d20)
+	if err != nil {
+		return 0, err
+	}
+
+	var chance float64
+	for i, p := range faces.Probabilities {
+		switch face := faces.Min + i; face {
+		case 20:
+			chance += p
+		case 1:
+		default:
+			chance += p * rest.Chance(comparison, target-face)
+		}
+	}
+	return chance, nil
+}
+
+// keptDice returns the number of dice counted by the term.
+func (t *Term) keptDice() int {
+	if t.Keep == nil {
+		return t.Count
+	}
+	if t.Keep.Drop {
+		return max(t.Count-t.Keep.Count, 0)
+	}
+	return min(t.Keep.Count, t.Count)
+}
+
+// String renders the mean, spread and, for narrow distributions, the chance of every total.
+func (d *Distribution) String() string {
+	lines := []string{
+		fmt.Sprintf("Range: %d to %d", d.Min, d.Max()),
+		fmt.Sprintf("Mean: %.2f", d.Mean()),
+		fmt.Sprintf("Variance: %.2f (standard deviation %.2f)", d.Variance(), math.Sqrt(d.Variance())),
+	}
+	if len(d.Probabilities) <= maxListedTotals {
+		totals := make([]string, 0, len(d.Probabilities))
+		for i, p := range d.Probabilities {
+			totals = append(totals, fmt.Sprintf("%d: %s", d.Min+i, percent(p)))
+		}
+		lines = append(lines, "Totals: "+strings.Join(totals, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func percent(p float64) string {
+	return fmt.Sprintf("%.2f%%", p*100)
+}
+
+func (c *Client) OddsWithArgs(ctx context.Context, args map[string]any) (string, error) {
+	prompt, ok := args["prompt"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid argument: prompt is required")
+	}
+
+	dist, err := Odds(prompt)
+	if err != nil {
+		return "", err
+	}
+	text := dist.String()
+
+	target, ok := args["target"].(float64)
+	if !ok {
+		return text, nil
+	}
+	comparison, ok := args["comparison"].(string)
+	if !ok || comparison == "" {
+		comparison = AtLeast
+	}
+	description, ok := comparisonNames[comparison]
+	if !ok {
+		return "", fmt.Errorf("invalid comparison: %s, must be one of %v", comparison, validComparisons)
+	}
+	chance := dist.Chance(comparison, int(target))
+	text += fmt.Sprintf("\nChance of a total %s %d: %s", description, int(target), percent(chance))
+
+	if attack, _ := args["attack"].(bool); attack {
+		chance, err = AttackChance(prompt, comparison, int(target))
+		if err != nil {
+			return "", err
+		}
+		text += fmt.Sprintf("\nChance counting natural 20s as hits and natural 1s as misses: %s", percent(chance))
+	}
+	return text, nil
+}
+
+// GetOddsTool returns the dice_odds tool.
+func (c *Client) GetOddsTool() *tools.Tool {
+	return &tools.Tool{
+		Declaration: &genai.FunctionDeclaration{
+			Name: DiceOdds,
+			Description: `Computes the exact probability distribution of a dice expression, without rolling it: its range, mean, variance and the chance of each total.
+			Always use it instead of estimating odds, e.g. the chance 2d6+3 beats 10, the expected damage of an attack or the chance to hit AC 18 with +7.
+			Expressions use the same syntax as roll_dice. For the expected damage of several attacks, add the means of each one.`,
+			Parameters: &genai.Schema{
+				Type: "object",
+				Properties: map[string]*genai.Schema{
+					"prompt": {
+						Type:        "string",
+						Description: "The dice expression",
+						Example:     "1d20+7",
+					},
+					"target": {
+						Type:        "integer",
+						Description: "Optional number to compare the total against, e.g. an AC or a DC",
+					},
+					"comparison": {
+						Type:        "string",
+						Description: "How the total compares to the target, defaults to at_least (meets or beats, as when hitting an AC or making a DC)",
+						Enum:        validComparisons,
+					},
+					"attack": {
+						Type:        "boolean",
+						Description: "Set for attack rolls, where a natural 20 always hits and a natural 1 always misses",
+					},
+				},
+				Required: []string{"prompt"},
+			},
+		},
+		Handler:        c.OddsWithArgs,
+		DefaultEnabled: true,
+	}
+}
@@ -0,0 +1,166 @@
+package diceroller
+
+import (
+	"math"
+	"testing"
+)
+
+const tolerance = 1e-9
+
+// enumerate returns the exact distribution of a single term by rolling every
+// combination of faces, without rerolls or explosions.
+func enumerate(t *testing.T, input string) *Distribution {
+	t.Helper()
+	expr, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", input, err)
+	}
+	term := expr.Terms[0]
+
+	counts := make(map[int]int)
+	outcomes := 0
+	values := make([]int, term.Count)
+	for {
+		i := 0
+		result := term.roll(func(n int) int {
+			i++
+			return values[i-1]
+		})
+		counts[result.Subtotal]++
+		outcomes++
+
+		// Move to the next combination, like an odometer.
+		position := 0
+		for position < len(values) {
+			values[position]++
+			if values[position] < term.Sides {
+				break
+			}
+			values[position] = 0
+			position++
+		}
+		if position == len(values) {
+			break
+		}
+	}
+
+	low, high := math.MaxInt, math.MinInt
+	for total := range counts {
+		low, high = min(low, total), max(high, total)
+	}
+	dist := &Distribution{Min: low, Probabilities: make([]float64, high-low+1)}
+	for total, count := range counts {
+		dist.Probabilities[total-low] = float64(count) / float64(outcomes)
+	}
+	return dist
+}
+
+func assertDistribution(t *testing.T, got, want *Distribution) {
+	t.Helper()
+	if got.Min != want.Min || got.Max() != want.Max() {
+		t.Fatalf("range = %d..%d, want %d..%d", got.Min, got.Max(), want.Min, want.Max())
+	}
+	for i := range want.Probabilities {
+		if math.Abs(got.Probabilities[i]-want.Probabilities[i]) > tolerance {
+			t.Errorf("P(%d) = %v, want %v", want.Min+i, got.Probabilities[i], want.Probabilities[i])
+		}
+	}
+}
+
+func TestOddsMatchesEnumeration(t *testing.T) {
+	for _, input := range []string{"3d6", "4d6k3", "4d6kl2", "4d6d1", "5d4dh2", "2d20kh1", "2d20kl1", "3d8k1"} {
+		t.Run(input, func(t *testing.T) {
+			got, err := Odds(input)
+			if err != nil {
+				t.Fatalf("Odds(%q) error = %v", input, err)
+			}
+			assertDistribution(t, got, enumerate(t, input))
+		})
+	}
+}
+
+func TestOdds(t *testing.T) {
+	tests := []struct {
+		input      string
+		comparison string
+		target     int
+		want       float64
+	}{
+		{"1d20+5", AtLeast, 15, 11.0 / 20},
+		{"1d20+5", Exactly, 25, 1.0 / 20},
+		{"2d6", Exactly, 7, 6.0 / 36},
+		{"2d6", Greater, 12, 0},
+		{"1d6-1d6", Exactly, 0, 6.0 / 36},
+		{"2d20kh1", AtLeast, 20, 39.0 / 400},
+		{"2d20kl1", AtLeast, 20, 1.0 / 400},
+		{"1d6r<3", AtMost, 2, 2.0 / 6 * 2.0 / 6},
+		// The chance of a total stays that of the first die until it explodes.
+		{"1d6!", Exactly, 5, 1.0 / 6},
+		{"1d6!", Exactly, 7, 1.0 / 36},
+		{"1d6!", Exactly, 6, 0},
+		// A lower threshold adds the face that exploded, not the die's sides.
+		{"1d6!5", Exactly, 4, 1.0 / 6},
+		{"1d6!5", Exactly, 5, 0},
+		{"1d6!5", Exactly, 6, 1.0 / 36},
+		{"1d6!5", Exactly, 7, 2.0 / 36},
+		{"1d4!3", Exactly, 3, 0},
+		{"1d4!3", Exactly, 4, 1.0 / 16},
+		{"1d4!3", Exactly, 5, 2.0 / 16},
+	}
+
+	for _, test := range tests {
+		dist, err := Odds(test.input)
+		if err != nil {
+			t.Fatalf("Odds(%q) error = %v", test.input, err)
+		}
+		if got := dist.Chance(test.comparison, test.target); math.Abs(got-test.want) > tolerance {
+			t.Errorf("Odds(%q) chance %s %d = %v, want %v", test.input, test.comparison, test.target, got, test.want)
+		}
+	}
+}
+
+func TestOddsSumToOne(t *testing.T) {
+	for _, input := range []string{"4d6k3", "10d10kh3", "3d6!", "2d8r2+1d4-3"} {
+		dist, err := Odds(input)
+		if err != nil {
+			t.Fatalf("Odds(%q) error = %v", input, err)
+		}
+		var total float64
+		for _, p := range dist.Probabilities {
+			total += p
+		}
+		// Explosions are cut off once their chance is negligible.
+		if math.Abs(total-1) > 1e-6 {
+			t.Errorf("Odds(%q) probabilities sum to %v, want 1", input, total)
+		}
+	}
+}
+
+func TestOddsMean(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"1d20+5", 15.5},
+		{"3d6", 10.5},
+		{"4d6k3", 15869.0 / 1296},
+		{"1d6!", 4.2},
+		{"1d6!5", 5.25},
+		{"1d4!3", 5},
+	}
+	for _, test := range tests {
+		dist, err := Odds(test.input)
+		if err != nil {
+			t.Fatalf("Odds(%q) error = %v", test.input, err)
+		}
+		if got := dist.Mean(); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("Odds(%q) mean = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestOddsRejectsExplodingKeep(t *testing.T) {
+	if _, err := Odds("4d6!k3"); err == nil {
+		t.Errorf("Odds(4d6!k3) succeeded, want an error")
+	}
+}
@@ -0,0 +1,237 @@
+package diceroller
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Result is the outcome of rolling an expression, once per repetition.
+type Result struct {
+	// Expression is the expression that was rolled.
+	Expression *Expression
+	// Rolls holds one entry per repetition of the expression.
+	Rolls []*RollResult
+}
+
+// RollResult is a single evaluation of an expression.
+type RollResult struct {
+	// Terms holds the outcome of each term of the expression.
+	Terms []*TermResult
+	// Total is the sum of every term.
+	Total int
+	// Natural20 is set when a d20 rolled alone came up 20.
+	Natural20 bool
+	// Natural1 is set when a d20 rolled alone came up 1.
+	Natural1 bool
+}
+
+// TermResult is the outcome of a single term.
+type TermResult struct {
+	// Term is the term that was rolled.
+	Term *Term
+	// Dice are the dice rolled for the term, in the order they were rolled.
+	Dice []*Die
+	// Subtotal is the value of the term, before applying its sign.
+	Subtotal int
+}
+
+// Die is a single die rolled for a term.
+type Die struct {
+	// Sides is the number of sides of the die.
+	Sides int `json:"sides"`
+	// Value is the face the die landed on.
+	Value int `json:"value"`
+	// Rerolled holds the value discarded by a reroll, or 0 if the die was not rerolled.
+	Rerolled int `json:"rerolled,omitempty"`
+	// Exploded is set when the die added another die to the term.
+	Exploded bool `json:"exploded,omitempty"`
+	// Dropped is set when a keep or drop modifier discarded the die.
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+// Roll rolls the expression with random numbers drawn from rng.
+func (e *Expression) Roll(rng *rand.Rand) *Result {
+	return e.roll(rng.IntN)
+}
+
+// roll rolls the expression, getting random numbers in [0, n) from intN.
+func (e *Expression) roll(intN func(n int) int) *Result {
+	result := &Result{Expression: e}
+	for range e.Repeat {
+		result.Rolls = append(result.Rolls, e.rollOnce(intN))
+	}
+	return result
+}
+
+func (e *Expression) rollOnce(intN func(n int) int) *RollResult {
+	result := &RollResult{}
+	for _, term := range e.Terms {
+		termResult := term.roll(intN)
+		result.Terms = append(result.Terms, termResult)
+		if term.Negative {
+			result.Total -= termResult.Subtotal
+		} else {
+			result.Total += termResult.Subtotal
+		}
+
+		if natural, ok := termResult.natural(); ok && term.Sides == 20 {
+			result.Natural20 = result.Natural20 || natural == 20
+			result.Natural1 = result.Natural1 || natural == 1
+		}
+	}
+	return result
+}
+
+func (t *Term) roll(intN func(n int) int) *TermResult {
+	result := &TermResult{Term: t}
+	if !t.IsDice() {
+		result.Subtotal = t.Constant
+		return result
+	}
+
+	explosions := 0
+	for i := 0; i < t.Count; i++ {
+		die := &Die{Sides: t.Sides, Value: intN(t.Sides) + 1}
+		if t.Reroll > 0 && die.Value <= t.Reroll {
+			die.Rerolled = die.Value
+			die.Value = intN(t.Sides) + 1
+		}
+		result.Dice = append(result.Dice, die)
+
+		if t.Explode > 0 && die.Value >= t.Explode && explosions < MaxExplosions {
+			die.Exploded = true
+			explosions++
+			// The extra die is rolled as part of the same loop.
+			i--
+		}
+	}
+
+	t.selectDice(result.Dice)
+	for _, die := range result.Dice {
+		if !die.Dropped {
+			result.Subtotal += die.Value
+		}
+	}
+	return result
+}
+
+// selectDice marks the dice discarded by the keep or drop modifier.
+func (t *Term) selectDice(dice []*Die) {
+	if t.Keep == nil {
+		return
+	}
+
+	sorted := make([]*Die, len(dice))
+	copy(sorted, dice)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if t.Keep.Lowest {
+			return sorted[i].Value < sorted[j].Value
+		}
+		return sorted[i].Value > sorted[j].Value
+	})
+
+	// sorted starts with the selected dice.
+	count := min(t.Keep.Count, len(sorted))
+	for i, die := range sorted {
+		selected := i < count
+		die.Dropped = selected == t.Keep.Drop
+	}
+}
+
+// natural returns the value of the only die counted by the term, if there is exactly one.
+func (r *TermResult) natural() (int, bool) {
+	value, kept := 0, 0
+	for _, die := range r.Dice {
+		if !die.Dropped {
+			value = die.Value
+			kept++
+		}
+	}
+	return value, kept == 1
+}
+
+// String renders every roll of the result, one per line.
+func (r *Result) String() string {
+	if len(r.Rolls) == 1 {
+		return r.Rolls[0].String()
+	}
+
+	lines := []string{r.Expression.Text + ":"}
+	for i, roll := range r.Rolls {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, roll))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// String renders the roll like "1d20 [17] + 5 (str) = 22".
+func (r *RollResult) String() string {
+	text := fmt.Sprintf("%s = %d", r.Breakdown(), r.Total)
+	if flag := r.Flag(); flag != "" {
+		text += " " + flag
+	}
+	return text
+}
+
+// Breakdown renders every term of the roll with its dice, without the total.
+func (r *RollResult) Breakdown() string {
+	var sb strings.Builder
+	for i, term := range r.Terms {
+		switch {
+		case i == 0 && term.Term.Negative:
+			sb.WriteString("-")
+		case i > 0 && term.Term.Negative:
+			sb.WriteString(" - ")
+		case i > 0:
+			sb.WriteString(" + ")
+		}
+		sb.WriteString(term.String())
+	}
+	return sb.String()
+}
+
+// Flag describes a natural 20 or 1, or returns an empty string.
+func (r *RollResult) Flag() string {
+	switch {
+	case r.Natural20:
+		return "(natural 20!)"
+	case r.Natural1:
+		return "(natural 1!)"
+	}
+	return ""
+}
+
+// String renders the term like "4d6k3 [5, 4, 3, ~1~] (str)". Dropped dice are
+// struck through, exploded dice marked with ! and rerolls shown as old→new.
+func (r *TermResult) String() string {
+	var sb strings.Builder
+	sb.WriteString(r.Term.String())
+	if r.Term.IsDice() {
+		dice := make([]string, 0, len(r.Dice))
+		for _, die := range r.Dice {
+			dice = append(dice, die.String())
+		}
+		sb.WriteString(" [" + strings.Join(dice, ", ") + "]")
+	}
+	if r.Term.Label != "" {
+		sb.WriteString(" (" + r.Term.Label + ")")
+	}
+	return sb.String()
+}
+
+// String renders the die value with its reroll, explosion and drop markers.
+func (d *Die) String() string {
+	text := strconv.Itoa(d.Value)
+	if d.Rerolled > 0 {
+		text = strconv.Itoa(d.Rerolled) + "→" + text
+	}
+	if d.Exploded {
+		text += "!"
+	}
+	if d.Dropped {
+		text = "~" + text + "~"
+	}
+	return text
+}
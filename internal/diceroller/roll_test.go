@@ -0,0 +1,193 @@
+package diceroller
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+// faces returns an intN drawing the given faces in order.
+func faces(t *testing.T, values ...int) func(n int) int {
+	t.Helper()
+	return func(n int) int {
+		if len(values) == 0 {
+			t.Fatalf("rolled more dice than scripted")
+		}
+		value := values[0]
+		values = values[1:]
+		if value < 1 || value > n {
+			t.Fatalf("scripted face %d is not on a d%d", value, n)
+		}
+		return value - 1
+	}
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	storageClient := storage.NewClient(storage.NewFileStore(t.TempDir()))
+	t.Cleanup(func() {
+		if err := storageClient.Close(); err != nil {
+			t.Errorf("failed to close storage: %v", err)
+		}
+	})
+	return NewClient(storageClient, rand.NewPCG(1, 2))
+}
+
+func TestExpressionRoll(t *testing.T) {
+	tests := []struct {
+		input     string
+		faces     []int
+		total     int
+		dropped   []bool
+		natural20 bool
+		natural1  bool
+	}{
+		{input: "1d20+5", faces: []int{20}, total: 25, dropped: []bool{false}, natural20: true},
+		{input: "1d20-1", faces: []int{1}, total: 0, dropped: []bool{false}, natural1: true},
+		{input: "4d6k3", faces: []int{1, 5, 3, 6}, total: 14, dropped: []bool{true, false, false, false}},
+		{input: "4d6d1", faces: []int{1, 5, 3, 6}, total: 14, dropped: []bool{true, false, false, false}},
+		{input: "4d6dh1", faces: []int{1, 5, 3, 6}, total: 9, dropped: []bool{false, false, false, true}},
+		{input: "2d20kh1", faces: []int{20, 3}, total: 20, dropped: []bool{false, true}, natural20: true},
+		{input: "2d20kl1", faces: []int{20, 3}, total: 3, dropped: []bool{true, false}},
+		{input: "2d6!", faces: []int{6, 2, 4}, total: 12, dropped: []bool{false, false, false}},
+		{input: "1d20r1", faces: []int{1, 15}, total: 15, dropped: []bool{false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			expr, err := Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			roll := expr.roll(faces(t, test.faces...)).Rolls[0]
+			if roll.Total != test.total {
+				t.Errorf("Total = %d, want %d", roll.Total, test.total)
+			}
+			if roll.Natural20 != test.natural20 || roll.Natural1 != test.natural1 {
+				t.Errorf("Natural20, Natural1 = %t, %t, want %t, %t", roll.Natural20, roll.Natural1, test.natural20, test.natural1)
+			}
+
+			dice := roll.Terms[0].Dice
+			if len(dice) != len(test.dropped) {
+				t.Fatalf("rolled %d dice, want %d", len(dice), len(test.dropped))
+			}
+			for i, die := range dice {
+				if die.Dropped != test.dropped[i] {
+					t.Errorf("die %d (%d) Dropped = %t, want %t", i, die.Value, die.Dropped, test.dropped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExpressionRollRerollAndExplode(t *testing.T) {
+	expr, err := Parse("2d6r1!")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	// The first die is rerolled into a 6, which explodes into a 3.
+	dice := expr.roll(faces(t, 1, 6, 3, 4)).Rolls[0].Terms[0].Dice
+	want := []Die{
+		{Sides: 6, Value: 6, Rerolled: 1, Exploded: true},
+		{Sides: 6, Value: 3},
+		{Sides: 6, Value: 4},
+	}
+	if len(dice) != len(want) {
+		t.Fatalf("rolled %d dice, want %d", len(dice), len(want))
+	}
+	for i, die := range dice {
+		if *die != want[i] {
+			t.Errorf("die %d = %+v, want %+v", i, *die, want[i])
+		}
+	}
+}
+
+func TestRollIsDeterministicWithSeed(t *testing.T) {
+	ctx := context.Background()
+	first, second := newTestClient(t), newTestClient(t)
+
+	for _, prompt := range []string{"6x 4d6k3", "1d20+5", "3d10!", "8d6r1"} {
+		a, err := first.Roll(ctx, prompt)
+		if err != nil {
+			t.Fatalf("Roll(%q) error = %v", prompt, err)
+		}
+		b, err := second.Roll(ctx, prompt)
+		if err != nil {
+			t.Fatalf("Roll(%q) error = %v", prompt, err)
+		}
+		if a.String() != b.String() {
+			t.Errorf("Roll(%q) with the same seed = %q and %q", prompt, a, b)
+		}
+	}
+}
+
+func TestRollStaysInRange(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	result, err := client.Roll(ctx, "20x 4d6k3")
+	if err != nil {
+		t.Fatalf("Roll() error = %v", err)
+	}
+	for _, roll := range result.Rolls {
+		if roll.Total < 3 || roll.Total > 18 {
+			t.Errorf("4d6k3 rolled %d, want between 3 and 18", roll.Total)
+		}
+	}
+}
+
+func TestRecentRolls(t *testing.T) {
+	const chatID = 5
+	client := newTestClient(t)
+	ctx := auth.WithIdentity(context.Background(), auth.Identity{ChatID: chatID, UserID: 1, UserName: "alice"})
+
+	prompts := []string{"1d4", "1d6", "1d8", "1d10", "1d12"}
+	for _, prompt := range prompts {
+		if _, err := client.Roll(ctx, prompt); err != nil {
+			t.Fatalf("Roll(%q) error = %v", prompt, err)
+		}
+	}
+
+	tests := []struct {
+		page int
+		want []string
+	}{
+		{1, []string{"1d12", "1d10"}},
+		{2, []string{"1d8", "1d6"}},
+		{3, []string{"1d4"}},
+		{4, nil},
+		{0, nil},
+	}
+	for _, test := range tests {
+		entries, pages, err := client.RecentRolls(chatID, test.page, 2)
+		if err != nil {
+			t.Fatalf("RecentRolls(page %d) error = %v", test.page, err)
+		}
+		if pages != 3 {
+			t.Errorf("RecentRolls(page %d) pages = %d, want 3", test.page, pages)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Expression)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("RecentRolls(page %d) = %v, want %v", test.page, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("RecentRolls(page %d) = %v, want %v", test.page, got, test.want)
+				break
+			}
+		}
+	}
+
+	for _, pageSize := range []int{0, -1} {
+		if _, _, err := client.RecentRolls(chatID, 1, pageSize); err == nil {
+			t.Errorf("RecentRolls(page size %d) succeeded, want an error", pageSize)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package diceroller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+)
+
+// Whisperer privately delivers messages to the game masters of a chat.
+type Whisperer interface {
+	Whisper(ctx context.Context, chatID int64, text string) error
+}
+
+// SetWhisperer sets where secret rolls are delivered.
+func (c *Client) SetWhisperer(whisperer Whisperer) {
+	c.whisperer = whisperer
+}
+
+// SecretRoll rolls a dice expression or a macro, like "bob.attack", for the
+// caller in ctx and sends the result privately to the game masters of the
+// caller's chat. It returns the announcement to show in the chat instead of
+// the result.
+func (c *Client) SecretRoll(ctx context.Context, prompt string) (string, error) {
+	identity := auth.IdentityFromContext(ctx)
+	if identity.ChatID == 0 {
+		return "", fmt.Errorf("secret rolls are only available inside a chat")
+	}
+	if c.whisperer == nil {
+		return "", fmt.Errorf("secret rolls are not available here, there is no way to message the GM")
+	}
+
+	var text string
+	if IsMacroName(prompt) {
+		roll, err := c.rollMacro(ctx, prompt, true)
+		if err != nil {
+			return "", err
+		}
+		text = roll.String()
+	} else {
+		expanded, err := c.expand(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		result, err := c.roll(ctx, expanded, true)
+		if err != nil {
+			return "", err
+		}
+		text = fmt.Sprintf("%s:\n%s", result.Expression.Text, result)
+	}
+
+	roller := identity.UserName
+	if roller == "" {
+		roller = "someone"
+	}
+	err := c.whisperer.Whisper(ctx, identity.ChatID, fmt.Sprintf("Secret roll by %s, %s", roller, text))
+	if err != nil {
+		return "", fmt.Errorf("failed to send the secret roll to the GM: %w", err)
+	}
+
+	if identity.Role.Allows(auth.RoleGM) {
+		return "The GM rolled something.", nil
+	}
+	return fmt.Sprintf("%s rolled something for the GM.", roller), nil
+}
@@ -0,0 +1,356 @@
+package diceroller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+	"google.golang.org/genai"
+)
+
+const (
+	// DiceStats is the name of the function that reports dice statistics.
+	DiceStats = "dice_stats"
+
+	// minExpectedPerFace is the number of rolls each face must expect before
+	// the chi-square test is meaningful.
+	minExpectedPerFace = 5
+
+	// biasedPValue is the p-value below which a die is reported as suspicious.
+	biasedPValue = 0.01
+)
+
+// Stats summarizes the rolls made in a chat.
+type Stats struct {
+	// Since is the start of the window, zero for all time.
+	Since time.Time
+	// Rolls is the number of logged rolls, counting each repetition.
+	Rolls int
+	// Users holds one entry per user, most active first.
+	Users []*UserStats
+	// Dice holds one entry per kind of die, by number of sides.
+	Dice []*DieStats
+}
+
+// UserStats summarizes the rolls of a single user.
+type UserStats struct {
+	UserID    int64
+	UserName  string
+	Rolls     int
+	Natural20 int
+	Natural1  int
+	// Dice holds the user's distribution of each kind of die, by number of sides.
+	Dice []*DieStats
+}
+
+// DieStats is the distribution of the faces rolled on a kind of die. Every
+// die thrown counts, including dropped dice and values replaced by rerolls.
+type DieStats struct {
+	Sides int
+	// Counts holds how many times each face came up, Counts[0] being face 1.
+	Counts []int
+	// Total is the number of dice thrown.
+	Total int
+	// Sum is the sum of every face thrown.
+	Sum int
+}
+
+// Stats computes the statistics of a chat's rolls made since the given time,
+// or of every roll if since is zero.
+func (c *Client) Stats(chatID int64, since time.Time) (*Stats, error) {
+	entries, err := c.Log(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeStats(entries, since), nil
+}
+
+// ComputeStats computes the statistics of the entries made since the given time.
+// Secret rolls are left out, so the stats don't reveal what the GM saw.
+func ComputeStats(entries []*LogEntry, since time.Time) *Stats {
+	stats := &Stats{Since: since}
+	users := make(map[int64]*UserStats)
+	dice := make(map[int]*DieStats)
+	userDice := make(map[int64]map[int]*DieStats)
+
+	for _, entry := range entries {
+		if entry.Secret || entry.Time.Before(since) {
+			continue
+		}
+
+		user, exists := users[entry.UserID]
+		if !exists {
+			user = &UserStats{UserID: entry.UserID}
+			users[entry.UserID] = user
+			userDice[entry.UserID] = make(map[int]*DieStats)
+		}
+		if entry.UserName != "" {
+			user.UserName = entry.UserName
+		}
+
+		for _, roll := range entry.Rolls {
+			stats.Rolls++
+			user.Rolls++
+			if roll.Natural20 {
+				user.Natural20++
+			}
+			if roll.Natural1 {
+				user.Natural1++
+			}
+			for _, die := range roll.Dice {
+				addDie(dice, die.Sides, die.Value)
+				addDie(userDice[entry.UserID], die.Sides, die.Value)
+				if die.Rerolled > 0 {
+					addDie(dice, die.Sides, die.Rerolled)
+					addDie(userDice[entry.UserID], die.Sides, die.Rerolled)
+				}
+			}
+		}
+	}
+
+	for userID, user := range users {
+		user.Dice = sortedDice(userDice[userID])
+		stats.Users = append(stats.Users, user)
+	}
+	sort.Slice(stats.Users, func(i, j int) bool {
+		if stats.Users[i].Rolls != stats.Users[j].Rolls {
+			return stats.Users[i].Rolls > stats.Users[j].Rolls
+		}
+		return stats.Users[i].UserID < stats.Users[j].UserID
+	})
+	stats.Dice = sortedDice(dice)
+	return stats
+}
+
+func addDie(dice map[int]*DieStats, sides, value int) {
+	if value < 1 || value > sides {
+		return
+	}
+	stats, exists := dice[sides]
+	if !exists {
+		stats = &DieStats{Sides: sides, Counts: make([]int, sides)}
+		dice[sides] = stats
+	}
+	stats.Counts[value-1]++
+	stats.Total++
+	stats.Sum += value
+}
+
+func sortedDice(dice map[int]*DieStats) []*DieStats {
+	sorted := make([]*DieStats, 0, len(dice))
+	for _, stats := range dice {
+		sorted = append(sorted, stats)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Sides < sorted[j].Sides
+	})
+	return sorted
+}
+
+// Die returns the distribution of the dice with the given number of sides, or nil.
+func (s *UserStats) Die(sides int) *DieStats {
+	for _, stats := range s.Dice {
+		if stats.Sides == sides {
+			return stats
+		}
+	}
+	return nil
+}
+
+// Average returns the average face rolled.
+func (s *DieStats) Average() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Total)
+}
+
+// ChiSquare tests the distribution against a fair die, returning the
+// chi-square statistic and its p-value: the probability of a fair die being at
+// least this uneven. ok is false when there are too few rolls for the test to
+// be meaningful.
+func (s *DieStats) ChiSquare() (statistic, pValue float64, ok bool) {
+	expected := float64(s.Total) / float64(s.Sides)
+	if expected < minExpectedPerFace {
+		return 0, 0, false
+	}
+	for _, count := range s.Counts {
+		diff := float64(count) - expected
+		statistic += diff * diff / expected
+	}
+	degrees := float64(s.Sides - 1)
+	return statistic, upperGamma(degrees/2, statistic/2), true
+}
+
+// upperGamma computes the regularized upper incomplete gamma function Q(a, x),
+// using its series expansion for small x and its continued fraction otherwise.
+func upperGamma(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-14 {
+				break
+			}
+		}
+		return 1 - sum*prefix
+	}
+
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-14 {
+			break
+		}
+	}
+	return prefix * h
+}
+
+// String renders the report shown to the chat.
+func (s *Stats) String() string {
+	window := "all time"
+	if !s.Since.IsZero() {
+		window = "since " + s.Since.Format("2006-01-02 15:04")
+	}
+	if s.Rolls == 0 {
+		return fmt.Sprintf("No rolls were made in this chat (%s).", window)
+	}
+
+	lines := []string{fmt.Sprintf("Dice statistics for %d rolls (%s)", s.Rolls, window), "", "Players:"}
+	for _, user := range s.Users {
+		name := user.UserName
+		if name == "" {
+			name = strconv.FormatInt(user.UserID, 10)
+		}
+		line := fmt.Sprintf("- %s: %d rolls", name, user.Rolls)
+		if d20 := user.Die(20); d20 != nil {
+			line += fmt.Sprintf(", average d20 %.1f over %d, %d natural 20s, %d natural 1s", d20.Average(), d20.Total, user.Natural20, user.Natural1)
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "", "Dice:")
+	for _, die := range s.Dice {
+		lines = append(lines, fmt.Sprintf("- d%d: %d thrown, average %.2f (fair: %.2f)", die.Sides, die.Total, die.Average(), float64(die.Sides+1)/2))
+		if die.Sides <= 20 {
+			faces := make([]string, 0, die.Sides)
+			for face, count := range die.Counts {
+				faces = append(faces, fmt.Sprintf("%d:%d", face+1, count))
+			}
+			lines = append(lines, "  "+strings.Join(faces, " "))
+		}
+		statistic, pValue, ok := die.ChiSquare()
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("  not enough rolls for a fairness check (needs %d)", minExpectedPerFace*die.Sides))
+		case pValue < biasedPValue:
+			lines = append(lines, fmt.Sprintf("  chi-square %.1f, p=%.3f: suspiciously uneven", statistic, pValue))
+		default:
+			lines = append(lines, fmt.Sprintf("  chi-square %.1f, p=%.3f: consistent with a fair die", statistic, pValue))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseWindow parses a time window like "7d", "2w" or "12h". An empty window
+// or "all" means all time and returns zero.
+func ParseWindow(window string) (time.Duration, error) {
+	window = strings.ToLower(strings.TrimSpace(window))
+	if window == "" || window == "all" {
+		return 0, nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if number, found := strings.CutSuffix(window, suffix); found {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid time window %q", window)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid time window %q, use something like 7d, 2w or 12h", window)
+	}
+	return duration, nil
+}
+
+// Since returns the start of a window parsed by ParseWindow, zero for all time.
+func Since(window time.Duration) time.Time {
+	if window == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-window)
+}
+
+func (c *Client) StatsWithArgs(ctx context.Context, args map[string]any) (string, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 {
+		return "", fmt.Errorf("dice statistics are only available inside a chat")
+	}
+
+	window, _ := args["window"].(string)
+	duration, err := ParseWindow(window)
+	if err != nil {
+		return "", err
+	}
+
+	stats, err := c.Stats(chatID, Since(duration))
+	if err != nil {
+		return "", err
+	}
+	return stats.String(), nil
+}
+
+// GetStatsTool returns the dice_stats tool.
+func (c *Client) GetStatsTool() *tools.Tool {
+	return &tools.Tool{
+		Declaration: &genai.FunctionDeclaration{
+			Name:        DiceStats,
+			Description: "Reports statistics of the dice rolled by the bot in this chat: rolls per player, average d20, natural 20s and 1s, the distribution of each die and a chi-square check of whether the dice look fair. Use it to settle complaints about the bot's luck.",
+			Parameters: &genai.Schema{
+				Type: "object",
+				Properties: map[string]*genai.Schema{
+					"window": {
+						Type:        "string",
+						Description: "How far back to look, like 7d, 2w or 12h. Leave empty for all time.",
+						Example:     "30d",
+					},
+				},
+			},
+		},
+		Handler:        c.StatsWithArgs,
+		DefaultEnabled: true,
+	}
+}
@@ -2,25 +2,175 @@ package googlegenai
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"google.golang.org/genai"
 )
 
-func (c *Client) NewChat(ctx context.Context, chatID int64) (*genai.Chat, error) {
-	chat, err := c.client.Chats.Create(ctx, Model, c.aiConfig, nil)
+const (
+	// ChatSessionFile is the name of the file where a chat's model history is stored.
+	ChatSessionFile   = chatSessionPrefix + "%d.json"
+	chatSessionPrefix = "chat-session-"
+
+	// MaxSessionHistory is the maximum number of contents kept in a persisted chat session.
+	MaxSessionHistory = 200
+
+	// MaxSessionAge is how long an idle chat session is kept before it is discarded.
+	MaxSessionAge = 30 * 24 * time.Hour
+)
+
+// chatSession is the persisted form of a chat with the model.
+type chatSession struct {
+	UpdatedAt time.Time        `json:"updated_at"`
+	History   []*genai.Content `json:"history"`
+}
+
+// NewChat starts a fresh chat, discarding any previous history for chatID.
+func (c *Client) NewChat(ctx context.Context, chatID int64) (Chat, error) {
+	return c.newChat(ctx, chatID, nil)
+}
+
+// GetChat returns the chat for chatID, restoring it from storage if it is not in memory.
+func (c *Client) GetChat(ctx context.Context, chatID int64) (Chat, error) {
+	chat, exists := c.loadChat(chatID)
+	if exists {
+		return chat, nil
+	}
+	if chatID == 0 {
+		return c.newChat(ctx, chatID, nil)
+	}
+	return c.newChat(ctx, chatID, c.loadChatSession(chatID))
+}
+
+func (c *Client) newChat(ctx context.Context, chatID int64, history []*genai.Content) (Chat, error) {
+	chat, err := c.provider.NewChat(ctx, c.chatConfig(chatID), history)
 	if err != nil {
 		return nil, err
 	}
 	if chatID != 0 {
-		c.chats[chatID] = chat
+		c.storeChat(chatID, chat)
 	}
 	return chat, nil
 }
 
-func (c *Client) GetChat(ctx context.Context, chatID int64) (*genai.Chat, error) {
+func (c *Client) loadChat(chatID int64) (Chat, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	chat, exists := c.chats[chatID]
+	return chat, exists
+}
+
+func (c *Client) storeChat(chatID int64, chat Chat) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.chats[chatID] = chat
+}
+
+// chatLock returns the mutex that serializes sends to a chat, so concurrent
+// messages never interleave their function-call turns on the same history.
+func (c *Client) chatLock(chatID int64) *sync.Mutex {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	lock, exists := c.chatLocks[chatID]
 	if !exists {
-		return c.NewChat(ctx, chatID)
+		lock = &sync.Mutex{}
+		c.chatLocks[chatID] = lock
 	}
-	return chat, nil
+	return lock
+}
+
+func (c *Client) loadChatSession(chatID int64) []*genai.Content {
+	var session chatSession
+	name := fmt.Sprintf(ChatSessionFile, chatID)
+	err := c.storage.LoadFromDB(name, &session)
+	if err != nil {
+		fmt.Printf("Failed to load chat session for chat %d, starting a new one: %v\n", chatID, err)
+		return nil
+	}
+	if len(session.History) == 0 {
+		return nil
+	}
+	if time.Since(session.UpdatedAt) > MaxSessionAge {
+		fmt.Printf("Chat session for chat %d is older than %s, discarding it\n", chatID, MaxSessionAge)
+		if err := c.storage.DeleteFromDB(name); err != nil {
+			fmt.Printf("Failed to delete stale chat session: %v\n", err)
+		}
+		return nil
+	}
+	return trimHistory(session.History, MaxSessionHistory)
+}
+
+// pruneChatSessions deletes the stored sessions older than MaxSessionAge, so
+// those of chats that never come back don't pile up.
+func (c *Client) pruneChatSessions() {
+	names, err := c.storage.ListDB(chatSessionPrefix)
+	if err != nil {
+		fmt.Printf("Failed to list chat sessions: %v\n", err)
+		return
+	}
+
+	var pruned int
+	for _, name := range names {
+		var chatID int64
+		if _, err := fmt.Sscanf(name, ChatSessionFile, &chatID); err != nil {
+			continue
+		}
+		var session chatSession
+		if err := c.storage.LoadFromDB(name, &session); err != nil {
+			fmt.Printf("Failed to load chat session for chat %d: %v\n", chatID, err)
+			continue
+		}
+		if time.Since(session.UpdatedAt) <= MaxSessionAge {
+			continue
+		}
+		if err := c.storage.DeleteFromDB(name); err != nil {
+			fmt.Printf("Failed to delete stale chat session for chat %d: %v\n", chatID, err)
+			continue
+		}
+		pruned++
+	}
+	if pruned > 0 {
+		fmt.Printf("Deleted %d chat sessions older than %s\n", pruned, MaxSessionAge)
+	}
+}
+
+func (c *Client) saveChatSession(chatID int64, chat Chat) {
+	if chatID == 0 {
+		return
+	}
+	session := chatSession{
+		UpdatedAt: time.Now(),
+		History:   trimHistory(chat.History(), MaxSessionHistory),
+	}
+	c.storage.SaveToDBAsync(fmt.Sprintf(ChatSessionFile, chatID), session)
+}
+
+// trimHistory keeps at most max contents, cutting at the start of a user
+// turn so the history never begins with a dangling function response.
+func trimHistory(history []*genai.Content, max int) []*genai.Content {
+	if len(history) <= max {
+		return history
+	}
+
+	start := len(history) - max
+	for start < len(history) && !isUserTurn(history[start]) {
+		start++
+	}
+	trimmed := make([]*genai.Content, len(history)-start)
+	copy(trimmed, history[start:])
+	return trimmed
+}
+
+func isUserTurn(content *genai.Content) bool {
+	if content == nil || content.Role != genai.RoleUser {
+		return false
+	}
+	for _, part := range content.Parts {
+		if part != nil && part.FunctionResponse != nil {
+			return false
+		}
+	}
+	return true
 }
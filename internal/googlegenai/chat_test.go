@@ -0,0 +1,37 @@
+package googlegenai_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+)
+
+func TestNewClientPrunesStaleChatSessions(t *testing.T) {
+	storageClient := newTestStorage(t)
+	sessions := map[int64]time.Time{
+		1: time.Now().Add(-googlegenai.MaxSessionAge - time.Hour),
+		2: time.Now().Add(-time.Hour),
+	}
+	for chatID, updatedAt := range sessions {
+		session := map[string]any{
+			"updated_at": updatedAt,
+			"history":    []map[string]any{{"role": "user", "parts": []map[string]any{{"text": "hi"}}}},
+		}
+		if err := storageClient.SaveToDB(fmt.Sprintf(googlegenai.ChatSessionFile, chatID), session); err != nil {
+			t.Fatalf("SaveToDB() error = %v", err)
+		}
+	}
+
+	newTestClientWithStorage(t, googlegenai.NewFakeProvider(), storageClient)
+
+	names, err := storageClient.ListDB("chat-session-")
+	if err != nil {
+		t.Fatalf("ListDB() error = %v", err)
+	}
+	want := fmt.Sprintf(googlegenai.ChatSessionFile, 2)
+	if len(names) != 1 || names[0] != want {
+		t.Errorf("chat sessions = %v, want only %s", names, want)
+	}
+}
@@ -1,10 +1,13 @@
 package googlegenai
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/character"
 	"google.golang.org/genai"
 )
 
@@ -14,48 +17,62 @@ const (
 
 	// ChatDataFile is the name of the file where chat data is stored.
 	ChatDataFile = "chat-data-%d.json"
-)
 
-type InventoryItem struct {
-	Value    string `json:"value"`
-	Quantity int    `json:"quantity"`
-}
+	// oldChatDataFile keeps the free-form chat data of a chat as it was before
+	// being migrated to character sheets.
+	oldChatDataFile = "chat-data-%d.v1.json"
+)
 
 var (
-	actionGet    = "get"
-	actionSet    = "set"
-	actionAdd    = "add"
-	actionRemove = "remove"
-	actionDelete = "delete"
-	actionShow   = "show"
-	validActions = []string{actionGet, actionSet, actionAdd, actionRemove, actionDelete, actionShow}
+	actionGet     = "get"
+	actionSet     = "set"
+	actionAdd     = "add"
+	actionRemove  = "remove"
+	actionDelete  = "delete"
+	actionShow    = "show"
+	actionHistory = "history"
+	actionRevert  = "revert"
+	validActions  = []string{actionGet, actionSet, actionAdd, actionRemove, actionDelete, actionShow, actionHistory, actionRevert}
+
+	// actionUndo records the changes made by /undo, which isn't a tool action.
+	actionUndo = "undo"
+
 	// ChatDataTool is the tool for managing chat data.
 	ChatDataTool = &genai.Tool{
 		FunctionDeclarations: []*genai.FunctionDeclaration{
 			{
 				Name: ChatDataToolName,
-				Description: `Universal character data management system that stores and retrieves any property for any character.
-						
+				Description: `Character sheet management system that stores and retrieves the D&D 3.5 characters of the chat.
+
 						Structure:
-						- Data points are accessed using character.property notation
-						- Both character and property are case-sensitive identifiers
-						- No spaces or special characters are allowed in either part
-						- The dot (.) is the only separator between character and property
-						- All properties should always be lower case
-						
+						- Data points are accessed using character.field notation, like bob.hp or bob.skills.climb
+						- Character names can't have spaces or dots, fields are lower case
+
+						Sheet fields:
+						- str, dex, con, int, wis, cha: ability scores
+						- hp, max_hp, ac, bab, xp, gold: whole numbers, except gold which can have decimals
+						- fort, ref, will: base saving throws, before ability modifiers
+						- classes.<class>: level in a class, like bob.classes.fighter = 3; 0 removes the class
+						- skills.<skill>: ranks in a skill, like bob.skills.climb = 4; 0 removes the skill
+						- feats, spells_known: lists of names
+						- inventory, spells_prepared: lists of names with quantities
+						Derived values can be read but not set: str_mod and the other ability modifiers, fort_total, ref_total, will_total, level and initiative (the Dex modifier unless initiative is set).
+						Any other field is a free-form property, like notes or alignment.
+
 						Operations:
-						- get: Retrieves the current value of any property for any character
-						- set: Updates or creates any property for any character with a new value
-						- add: Appends a value to an existing property for a character
-						- remove: Removes a value from a property for a character
-						- delete: Deletes a property or character completely, removing all associated data
-						- show: Prints the current state of all characters and their properties
-
-						Properties can represent any character attribute, statistic, or information.
-						There are no restrictions on property names - any valid identifier can be used.
-						New characters and properties are automatically created when setting values.
-
-						Don't ever need to send the chat ID back to the user.
+						- get: Retrieves a field of a character, or the whole sheet when the path is just the character name
+						- set: Validates and updates a field, creating the character if needed; setting a list replaces it with the comma separated names in value
+						- add: Adds a value to a list: inventory, spells_prepared, feats or spells_known
+						- remove: Removes a value from a list
+						- delete: Clears a field, or asks the user to confirm deleting a whole character when the path is just the character name
+						- show: Prints the sheets of all characters
+						- history: Lists the latest changes with their version numbers, optionally only those to the character in path
+						- revert: Restores the character changed by version to how it was before that change. It is refused while later changes to the character exist, which must be reverted first, newest first
+
+						Every change is recorded and can be reverted, and users can undo the latest one with /undo.
+
+						Roll macros are properties holding dice expressions separated by ;, like bob.attack = 1d20+7; 1d8+4. Roll them with roll_dice, where @bob.str_mod and the other fields can be referenced.
+						The data always belongs to the chat the message came from.
 						`,
 				Parameters: &genai.Schema{
 					Type: "object",
@@ -63,33 +80,35 @@ var (
 						"action": {
 							Type: "string",
 							Description: `Action to perform:
-							- "get": retrieve a value
+							- "get": retrieve a value or a whole character sheet
 							- "set": store a value
-							- "add": will append a value to a property
-							- "remove": will remove a value from a property
-							- "delete": will remove the property or character completely
-							- "show": will print the current state of all characters and their properties
+							- "add": will append a value to a list
+							- "remove": will remove a value from a list
+							- "delete": will clear the field, or ask the user to confirm deleting the character completely
+							- "show": will print the sheets of all characters
+							- "history": will list the latest changes
+							- "revert": will undo the change with the given version
 							`,
 							Enum: validActions,
 						},
-						"chatID": {
-							Type:        "integer",
-							Description: "Chat ID to associate with the data. It will always be available in the format at the end of the message. You can only take the chatID from the end of the message, if there are multiple chatIDs, take the last one.",
-						},
 						"path": {
 							Type:        "string",
-							Description: "Access path in format character.property using valid identifiers without spaces or special characters. Not required for show action.",
+							Description: "Access path in format character.field, or just the character name for get, delete and history. Not required for show, history and revert actions.",
 						},
 						"value": {
 							Type:        "string",
-							Description: "New value to store when using set action (required for set, ignored for get). For add and remove actions, this is the value to append or remove from the property.",
+							Description: "New value to store when using set action (required for set, ignored for get). For add and remove actions, this is the value to append or remove from the list.",
 						},
 						"quantity": {
 							Type:        "integer",
-							Description: "Quantity of the item to add or remove when using add or remove actions (optional, defaults to 1)",
+							Description: "Quantity of the item to add or remove when using add or remove actions on inventory or spells_prepared (optional, defaults to 1)",
+						},
+						"version": {
+							Type:        "integer",
+							Description: "Version of the change to undo, as listed by history (required for revert)",
 						},
 					},
-					Required: []string{"action", "path"},
+					Required: []string{"action"},
 				},
 			},
 		},
@@ -116,32 +135,13 @@ func needsValue(action string) bool {
 
 func needsPath(action string) bool {
 	switch action {
-	case actionShow:
+	case actionShow, actionHistory, actionRevert:
 		return false
 	default:
 		return true
 	}
 }
 
-func formatChatData(data map[string]string) string {
-	var sb strings.Builder
-	sb.WriteString("Current chat data:\n")
-	for key, value := range data {
-		if strings.HasPrefix(value, "[") {
-			var items []InventoryItem
-			if err := json.Unmarshal([]byte(value), &items); err == nil {
-				var itemStrings []string
-				for _, item := range items {
-					itemStrings = append(itemStrings, fmt.Sprintf("%s (x%d)", item.Value, item.Quantity))
-				}
-				value = strings.Join(itemStrings, ", ")
-			}
-		}
-		sb.WriteString(fmt.Sprintf("- %s: %s\n", key, value))
-	}
-	return sb.String()
-}
-
 func getNumber[T ~float64 | ~int | ~int64](value any) (T, error) {
 	var num T
 	if x, ok := value.(float64); ok {
@@ -156,22 +156,48 @@ func getNumber[T ~float64 | ~int | ~int64](value any) (T, error) {
 	return num, nil
 }
 
-func (c *Client) loadChatData(chatID int64) {
-	chatData := make(map[string]string)
-	c.storage.LoadFromDB(fmt.Sprintf(ChatDataFile, chatID), &chatData)
-	c.lock.Lock()
-	c.chatData[chatID] = chatData
-	c.lock.Unlock()
+// getChatData returns the characters of a chat, loading them from storage on
+// first use and migrating the free-form data of older versions. Data that
+// can't be read is left untouched and reported, instead of being replaced by
+// an empty roster on the next save. The caller must hold c.dataLock.
+func (c *Client) getChatData(chatID int64) (*character.Roster, error) {
+	roster, exists := c.chatData[chatID]
+	if exists {
+		return roster, nil
+	}
+
+	name := fmt.Sprintf(ChatDataFile, chatID)
+	var data json.RawMessage
+	err := c.storage.LoadFromDB(name, &data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chat data of chat %d: %w", chatID, err)
+	}
+	roster, migrated, err := character.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode chat data of chat %d: %w", chatID, err)
+	}
+	if migrated {
+		err = c.storage.SaveToDB(fmt.Sprintf(oldChatDataFile, chatID), data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to keep the old chat data of chat %d before migrating it: %w", chatID, err)
+		}
+		fmt.Printf("Migrated chat data of chat %d to character sheets\n", chatID)
+		c.saveChatData(chatID, roster)
+	}
+	c.chatData[chatID] = roster
+	return roster, nil
 }
 
-func (c *Client) saveChatData(chatID int64, data map[string]string) {
-	c.storage.SaveToDBAsync(fmt.Sprintf(ChatDataFile, chatID), data)
+// saveChatData persists a snapshot of the characters, so later changes can't
+// race with the asynchronous write. The caller must hold c.dataLock.
+func (c *Client) saveChatData(chatID int64, roster *character.Roster) {
+	c.storage.SaveToDBAsync(fmt.Sprintf(ChatDataFile, chatID), roster.Clone())
 }
 
-func (c *Client) ChatData(args map[string]any) (string, error) {
-	chatID, err := getNumber[int64](args["chatID"])
-	if err != nil {
-		return "", fmt.Errorf("invalid argument: chatID is missing or not a number")
+func (c *Client) ChatData(ctx context.Context, args map[string]any) (string, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 {
+		return "", fmt.Errorf("chat data is only available inside a chat")
 	}
 
 	action, ok := args["action"].(string)
@@ -197,101 +223,125 @@ func (c *Client) ChatData(args map[string]any) (string, error) {
 		quantity = 1
 	}
 
-	if c.chatData[chatID] == nil {
-		c.loadChatData(chatID)
+	switch action {
+	case actionHistory:
+		return c.History(chatID, strings.TrimSpace(path)), nil
+	case actionRevert:
+		version, err := getNumber[int](args["version"])
+		if err != nil {
+			return "", fmt.Errorf("invalid argument: version is required when action is %q", action)
+		}
+		return c.Revert(ctx, version)
+	}
+
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+	roster, err := c.getChatData(chatID)
+	if err != nil {
+		return "", err
 	}
-	chatData := c.chatData[chatID]
 
 	fmt.Printf("Performing action: %q with path: %s and value: %s\n", action, path, value)
+	name, field, hasField := strings.Cut(strings.TrimSpace(path), ".")
+	if !hasField && (action == actionSet || action == actionAdd || action == actionRemove) {
+		return "", fmt.Errorf("invalid argument: path must be character.field when action is %q", action)
+	}
+
 	switch action {
 	case actionGet:
-		return chatData[path], nil
+		sheet := roster.Find(name)
+		if sheet == nil {
+			return fmt.Sprintf("There is no character called %s", name), nil
+		}
+		if !hasField {
+			return sheet.String(), nil
+		}
+		if value, exists := sheet.Get(field); exists {
+			return value, nil
+		}
+		return fmt.Sprintf("%s is not set", path), nil
 	case actionSet:
-		chatData[path] = value
-		c.saveChatData(chatID, chatData)
-		return fmt.Sprintf("Set %s to %s", path, value), nil
-	case actionAdd:
-		var msg string
-		if existingValue, exists := chatData[path]; exists {
-			var parsedValue []InventoryItem
-			if err := json.Unmarshal([]byte(existingValue), &parsedValue); err != nil {
-				return "", fmt.Errorf("failed to parse existing value for %s: %w", path, err)
-			}
-			added := false
-			for i, v := range parsedValue {
-				if v.Value == value {
-					parsedValue[i].Quantity += quantity
-					msg = fmt.Sprintf("Incremented quantity of %s to %d in %s", value, parsedValue[i].Quantity, path)
-					added = true
-				}
+		return c.mutate(ctx, chatID, roster, action, path, true, func(sheet *character.Character) (string, error) {
+			if err := sheet.Set(field, value); err != nil {
+				return "", err
 			}
-			if !added {
-				parsedValue = append(parsedValue, InventoryItem{Value: value, Quantity: quantity})
-			}
-			finalValue, err := json.Marshal(parsedValue)
-			if err != nil {
-				return "", fmt.Errorf("failed to marshal updated value for %s: %w", path, err)
-			}
-			chatData[path] = string(finalValue)
-		} else {
-			stringValue, err := json.Marshal([]InventoryItem{{Value: value, Quantity: quantity}})
-			if err != nil {
-				return "", fmt.Errorf("failed to marshal new value for %s: %w", path, err)
-			}
-			chatData[path] = string(stringValue)
-		}
-		msg = fmt.Sprintf("Added %s to %s with quantity %d", value, path, quantity)
-		c.saveChatData(chatID, chatData)
-		return msg, nil
+			return fmt.Sprintf("Set %s to %s", path, value), nil
+		})
+	case actionAdd:
+		return c.mutate(ctx, chatID, roster, action, path, true, func(sheet *character.Character) (string, error) {
+			return sheet.Add(field, value, quantity)
+		})
 	case actionRemove:
-		if existingValue, exists := chatData[path]; exists {
-			var parsedValue []InventoryItem
-			if err := json.Unmarshal([]byte(existingValue), &parsedValue); err != nil {
-				return "", fmt.Errorf("failed to parse existing value for %s: %w", path, err)
-			}
-			var msg string
-			for i, v := range parsedValue {
-				if v.Value == value {
-					if v.Quantity > quantity {
-						v.Quantity -= quantity
-						parsedValue[i] = v
-						msg = fmt.Sprintf("Decremented %d of %s. New total is %d", quantity, path, v.Quantity)
-					} else {
-						parsedValue = append(parsedValue[:i], parsedValue[i+1:]...)
-						msg = fmt.Sprintf("Removed %s from %s", value, path)
-					}
-
-					finalValue, err := json.Marshal(parsedValue)
-					if err != nil {
-						return "", fmt.Errorf("failed to marshal updated value for %s: %w", path, err)
-					}
-					chatData[path] = string(finalValue)
-					c.saveChatData(chatID, chatData)
-					return msg, nil
-				}
-			}
-			return fmt.Sprintf("%s not found in %s", value, path), nil
-		}
-		return fmt.Sprintf("%s is empty", path), nil
+		return c.mutate(ctx, chatID, roster, action, path, false, func(sheet *character.Character) (string, error) {
+			return sheet.Remove(field, value, quantity)
+		})
 	case actionDelete:
-		var deleted bool
-		for key := range chatData {
-			if strings.HasPrefix(key, path+".") || key == path {
-				delete(chatData, key)
-				deleted = true
-			}
+		if !hasField {
+			return c.requestDeletion(chatID, roster, name), nil
 		}
-		if !deleted {
-			return fmt.Sprintf("%s does not exist", path), nil
-		}
-		c.saveChatData(chatID, chatData)
-		return fmt.Sprintf("Deleted character %s and all its properties", path), nil
+		return c.mutate(ctx, chatID, roster, action, path, false, func(sheet *character.Character) (string, error) {
+			if err := sheet.Unset(field); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Deleted %s", path), nil
+		})
 	case actionShow:
-		if len(chatData) == 0 {
+		if roster.Empty() {
 			return "No chat data available", nil
 		}
-		return formatChatData(chatData), nil
+		return roster.String(), nil
 	default:
 		return "", fmt.Errorf("unknown action: %s, must be one of %v", action, validActions)
 	}
 }
+
+// CharacterProperty returns the value stored at a character.field path of a
+// chat, including derived values like "bob.str_mod". Character names are
+// matched case-insensitively.
+func (c *Client) CharacterProperty(chatID int64, path string) (string, bool) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	roster, err := c.getChatData(chatID)
+	if err != nil {
+		fmt.Printf("Failed to read %s: %v\n", path, err)
+		return "", false
+	}
+	return roster.Property(path)
+}
+
+// CharacterExists tells whether a chat has a sheet for a character.
+func (c *Client) CharacterExists(chatID int64, name string) (bool, error) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	roster, err := c.getChatData(chatID)
+	if err != nil {
+		return false, err
+	}
+	return roster.Find(name) != nil, nil
+}
+
+// CharacterData returns the sheet of a character, or of every character when
+// character is empty.
+func (c *Client) CharacterData(chatID int64, name string) (string, error) {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	roster, err := c.getChatData(chatID)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		if roster.Empty() {
+			return "No chat data available", nil
+		}
+		return roster.String(), nil
+	}
+
+	sheet := roster.Find(name)
+	if sheet == nil {
+		return fmt.Sprintf("No data found for %s", name), nil
+	}
+	return sheet.String(), nil
+}
@@ -2,16 +2,18 @@ package googlegenai
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
+	"maps"
 	"path"
 	"path/filepath"
 	"sync"
 
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/character"
 	"github.com/gtrindade/ultra-kiew/internal/config"
 	"github.com/gtrindade/ultra-kiew/internal/mysql"
 	"github.com/gtrindade/ultra-kiew/internal/storage"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
 	"google.golang.org/genai"
 )
 
@@ -26,58 +28,50 @@ const (
 	CLEANUP = false
 )
 
-type GenericFunction func(args map[string]any) (string, error)
-
-type ToolConfig struct {
-	Function GenericFunction
-	Tool     *genai.Tool
-}
-
 type Client struct {
-	client      *genai.Client
-	aiConfig    *genai.GenerateContentConfig
-	config      *config.Config
-	dbClient    *mysql.Client
-	chats       map[int64]*genai.Chat
-	toolConfigs map[string]*ToolConfig
-	lock        sync.RWMutex
-	fileCache   map[string][]byte
-	storage     *storage.Client
-	fileMap     FileMap
-	chatData    map[int64]map[string]string
+	provider     Provider
+	aiConfig     *genai.GenerateContentConfig
+	config       *config.Config
+	dbClient     *mysql.Client
+	chats        map[int64]Chat
+	chatLocks    map[int64]*sync.Mutex
+	tools        *tools.Registry
+	toolSettings *tools.Settings
+	lock         sync.RWMutex
+	fileCache    map[string][]byte
+	storage      *storage.Client
+	fileMap      FileMap
+	chatData     map[int64]*character.Roster
+	dataLock     sync.Mutex
+	history      map[int64][]*Change
+	deletions    map[int64][]string
 }
 
-// NewClient creates a new Google GenAI client with the provided API key and backend.
-func NewClient(ctx context.Context, toolConfigs map[string]*ToolConfig, storageClient *storage.Client, dbClient *mysql.Client, config *config.Config) (*Client, error) {
-	if config.GeminiAPIKey == "" {
-		log.Fatal("Missing gemini_api_key in config.yaml")
-	}
-	client, err := genai.NewClient(ctx, &genai.ClientConfig{
-		APIKey:  config.GeminiAPIKey,
-		Backend: genai.BackendGeminiAPI,
-	})
-	if err != nil {
-		return nil, err
-	}
-
+// NewClient creates a new AI client that talks to the model through the given provider.
+func NewClient(ctx context.Context, provider Provider, registry *tools.Registry, toolSettings *tools.Settings, storageClient *storage.Client, dbClient *mysql.Client, config *config.Config) (*Client, error) {
 	c := &Client{
-		chats:       make(map[int64]*genai.Chat),
-		client:      client,
-		toolConfigs: toolConfigs,
-		dbClient:    dbClient,
-		fileCache:   make(map[string][]byte),
-		storage:     storageClient,
-		fileMap:     make(map[string]*genai.File),
-		chatData:    make(map[int64]map[string]string),
-		config:      config,
-	}
-
-	err = c.storage.LoadFromDB(filesFileName, &c.fileMap)
+		chats:        make(map[int64]Chat),
+		chatLocks:    make(map[int64]*sync.Mutex),
+		provider:     provider,
+		tools:        registry,
+		toolSettings: toolSettings,
+		dbClient:     dbClient,
+		fileCache:    make(map[string][]byte),
+		storage:      storageClient,
+		fileMap:      make(map[string]*genai.File),
+		chatData:     make(map[int64]*character.Roster),
+		history:      make(map[int64][]*Change),
+		deletions:    make(map[int64][]string),
+		config:       config,
+	}
+
+	err := c.storage.LoadFromDB(filesFileName, &c.fileMap)
 	if err != nil {
 		return nil, err
 	}
+	c.pruneChatSessions()
 
-	err = c.AddTools(toolConfigs)
+	err = c.AddTools()
 	if err != nil {
 		return nil, err
 	}
@@ -92,57 +86,41 @@ func NewClient(ctx context.Context, toolConfigs map[string]*ToolConfig, storageC
 	return c, nil
 }
 
-func (c *Client) AddTools(toolConfigs map[string]*ToolConfig) error {
-	if c.toolConfigs == nil {
-		c.toolConfigs = make(map[string]*ToolConfig)
-	}
-
-	c.toolConfigs[SpellLookupToolName] = &ToolConfig{
-		Function: c.SpellLookup,
-		Tool:     SpellLookupTool,
-	}
-	c.toolConfigs[FeatLookupToolName] = &ToolConfig{
-		Function: c.FeatLookup,
-		Tool:     FeatLookupTool,
-	}
-	c.toolConfigs[EquipmentLookupToolName] = &ToolConfig{
-		Function: c.EquipmentLookup,
-		Tool:     EquipmentLookupTool,
-	}
-	c.toolConfigs[ItemLookupToolName] = &ToolConfig{
-		Function: c.ItemLookup,
-		Tool:     ItemLookupTool,
-	}
-	c.toolConfigs[SkillLookupToolName] = &ToolConfig{
-		Function: c.SkillLookup,
-		Tool:     SkillLookupTool,
-	}
-	c.toolConfigs[MonsterLookupToolName] = &ToolConfig{
-		Function: c.MonsterLookup,
-		Tool:     MonsterLookupTool,
-	}
-	c.toolConfigs[ChatDataToolName] = &ToolConfig{
-		Function: c.ChatData,
-		Tool:     ChatDataTool,
-	}
-	c.toolConfigs[FoundryVTTToolName] = &ToolConfig{
-		Function: c.FoundryVTT,
-		Tool:     FoundryVTTTool,
-	}
-
-	tools := make([]*genai.Tool, 0, len(toolConfigs))
-	for name, toolConfig := range toolConfigs {
-		if toolConfig == nil || toolConfig.Tool == nil {
-			return errors.New("tool configuration for " + name + " is missing or invalid")
-		}
-		if toolConfig.Function == nil {
-			return errors.New("function for tool " + name + " is not defined")
+// AddTools registers the built-in tools and sets up the base model configuration.
+// The rules lookups are only registered when there is a database client.
+func (c *Client) AddTools() error {
+	var builtins []*tools.Tool
+	if c.dbClient != nil {
+		builtins = append(builtins,
+			&tools.Tool{Declaration: SpellLookupTool.FunctionDeclarations[0], Handler: c.SpellLookup, DefaultEnabled: true},
+			&tools.Tool{Declaration: FeatLookupTool.FunctionDeclarations[0], Handler: c.FeatLookup, DefaultEnabled: true},
+			&tools.Tool{Declaration: EquipmentLookupTool.FunctionDeclarations[0], Handler: c.EquipmentLookup, DefaultEnabled: true},
+			&tools.Tool{Declaration: ItemLookupTool.FunctionDeclarations[0], Handler: c.ItemLookup, DefaultEnabled: true},
+			&tools.Tool{Declaration: SkillLookupTool.FunctionDeclarations[0], Handler: c.SkillLookup, DefaultEnabled: true},
+			&tools.Tool{Declaration: MonsterLookupTool.FunctionDeclarations[0], Handler: c.MonsterLookup, DefaultEnabled: true},
+		)
+	}
+	builtins = append(builtins, []*tools.Tool{
+		{
+			Declaration:    ChatDataTool.FunctionDeclarations[0],
+			Handler:        c.ChatData,
+			ActionRoles:    map[string]auth.Role{actionDelete: auth.RoleGM},
+			DefaultEnabled: true,
+		},
+		{
+			Declaration: FoundryVTTTool.FunctionDeclarations[0],
+			Handler:     c.FoundryVTT,
+			Role:        auth.RoleGM,
+			ActionRoles: map[string]auth.Role{"switch": auth.RoleOwner},
+		},
+	}...)
+	for _, tool := range builtins {
+		if err := c.tools.Register(tool); err != nil {
+			return err
 		}
-		tools = append(tools, toolConfig.Tool)
 	}
 
 	c.aiConfig = &genai.GenerateContentConfig{
-		Tools: tools,
 		SystemInstruction: &genai.Content{
 			Parts: []*genai.Part{
 				genai.NewPartFromText(fmt.Sprintf(`You are a helpful assistant named %q in a group chat. You will receive multiple messages in the format [Timestamp - Username]: `+"`message`"+` that provide conversation context. Your messages do not need to use same format with timestamp and username and quoted, your responses will be sent via telegram API and the time and name of your messages will be added automatically.
@@ -184,7 +162,10 @@ func (c *Client) UploadFiles(ctx context.Context, cleanup bool) error {
 		}
 	}
 
-	c.storage.SaveToDBAsync(filesFileName, c.fileMap)
+	c.lock.RLock()
+	fileMap := maps.Clone(c.fileMap)
+	c.lock.RUnlock()
+	c.storage.SaveToDBAsync(filesFileName, fileMap)
 
 	return nil
 }
@@ -0,0 +1,149 @@
+package googlegenai_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+)
+
+var arrowsPattern = regexp.MustCompile(`arrow \(x(\d+)\)`)
+
+// newTestClient creates a client talking to provider, keeping its state in a
+// temporary directory and without the rules database.
+func newTestClient(t *testing.T, provider googlegenai.Provider) *googlegenai.Client {
+	t.Helper()
+	return newTestClientWithStorage(t, provider, newTestStorage(t))
+}
+
+func newTestStorage(t *testing.T) *storage.Client {
+	t.Helper()
+	storageClient := storage.NewClient(storage.NewFileStore(t.TempDir()))
+	t.Cleanup(func() {
+		if err := storageClient.Close(); err != nil {
+			t.Errorf("failed to close storage: %v", err)
+		}
+	})
+	return storageClient
+}
+
+func newTestClientWithStorage(t *testing.T, provider googlegenai.Provider, storageClient *storage.Client) *googlegenai.Client {
+	t.Helper()
+	registry := tools.NewRegistry()
+	client, err := googlegenai.NewClient(context.Background(), provider, registry, tools.NewSettings(registry, storageClient), storageClient, nil, &config.Config{BotName: "kiew"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func chatContext(chatID int64) context.Context {
+	return auth.WithIdentity(context.Background(), auth.Identity{
+		ChatID:   chatID,
+		UserID:   1,
+		UserName: "alice",
+		Role:     auth.RolePlayer,
+	})
+}
+
+func addArrow() *googlegenai.Response {
+	return googlegenai.FakeFunctionCall("chat_data", map[string]any{
+		"action": "add",
+		"path":   "bob.inventory",
+		"value":  "arrow",
+	})
+}
+
+// arrows returns how many arrows bob has in a chat.
+func arrows(t *testing.T, client *googlegenai.Client, chatID int64) int {
+	t.Helper()
+	sheet, err := client.CharacterData(chatID, "bob")
+	if err != nil {
+		t.Fatalf("CharacterData(%d) error = %v", chatID, err)
+	}
+	match := arrowsPattern.FindStringSubmatch(sheet)
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(match[1])
+	return count
+}
+
+func TestSendMessageConcurrentChats(t *testing.T) {
+	const chats = 8
+	provider := googlegenai.NewFakeProvider()
+	for range chats {
+		provider.Script(addArrow())
+	}
+	client := newTestClient(t, provider)
+
+	var wg sync.WaitGroup
+	for i := range chats {
+		chatID := int64(100 + i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := chatContext(chatID)
+			if _, err := client.SendMessage(ctx, chatID, "give bob an arrow"); err != nil {
+				t.Errorf("SendMessage(%d) error = %v", chatID, err)
+			}
+			client.CharacterProperty(chatID, "bob.hp")
+		}()
+	}
+	wg.Wait()
+
+	// The script is shared, so which chats got the calls varies, but every
+	// call must have been applied exactly once.
+	var total int
+	for i := range chats {
+		total += arrows(t, client, int64(100+i))
+	}
+	if total != chats {
+		t.Errorf("arrows across chats = %d, want %d", total, chats)
+	}
+}
+
+func TestSendMessageConcurrentSameChat(t *testing.T) {
+	const (
+		chatID   = 42
+		messages = 8
+	)
+	provider := googlegenai.NewFakeProvider()
+	for range messages {
+		provider.Script(addArrow())
+	}
+	client := newTestClient(t, provider)
+	ctx := chatContext(chatID)
+
+	var wg sync.WaitGroup
+	for i := range messages {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SendMessage(ctx, chatID, fmt.Sprintf("message %d", i)); err != nil {
+				t.Errorf("SendMessage() error = %v", err)
+			}
+		}()
+		// Tool handlers also run outside of a message, while the chat is busy.
+		go func() {
+			defer wg.Done()
+			_, err := client.ChatData(ctx, map[string]any{"action": "add", "path": "bob.inventory", "value": "arrow"})
+			if err != nil {
+				t.Errorf("ChatData() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := arrows(t, client, chatID), 2*messages; got != want {
+		t.Errorf("arrows = %d, want %d", got, want)
+	}
+}
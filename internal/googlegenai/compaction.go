@@ -0,0 +1,218 @@
+package googlegenai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"google.golang.org/genai"
+)
+
+const (
+	// CampaignMemoryFile is the name of the file where a chat's campaign memory is stored.
+	CampaignMemoryFile = "campaign-memory-%d.json"
+
+	// DefaultMaxMessages is the number of history contents that triggers a compaction.
+	DefaultMaxMessages = 120
+
+	// DefaultMaxTokens is the estimated number of history tokens that triggers a compaction.
+	DefaultMaxTokens = 100000
+
+	// DefaultKeepRecent is the number of most recent contents kept verbatim after a compaction.
+	DefaultKeepRecent = 20
+
+	// charsPerToken is a rough estimate used to measure history size without calling the API.
+	charsPerToken = 4
+
+	summaryInstruction = `You maintain the long-term "campaign memory" of a group chat that plays tabletop RPGs together.
+You will receive the previous campaign memory, if any, followed by a transcript of older conversation turns.
+Write an updated campaign memory that merges both: characters and who plays them, important events, decisions, items, open plot threads, running jokes and anything the group would expect you to remember.
+Be concise, use short bullet points, drop small talk, and write it in the same language used in the chat. Reply with the memory only.`
+)
+
+// CampaignMemory is the rolling summary of a chat's older conversation turns.
+type CampaignMemory struct {
+	Summary   string    `json:"summary"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (c *Client) compactionLimits() config.CompactionConfig {
+	limits := config.CompactionConfig{
+		MaxMessages: DefaultMaxMessages,
+		MaxTokens:   DefaultMaxTokens,
+		KeepRecent:  DefaultKeepRecent,
+	}
+	if c.config.Compaction == nil {
+		return limits
+	}
+	if c.config.Compaction.MaxMessages > 0 {
+		limits.MaxMessages = c.config.Compaction.MaxMessages
+	}
+	if c.config.Compaction.MaxTokens > 0 {
+		limits.MaxTokens = c.config.Compaction.MaxTokens
+	}
+	if c.config.Compaction.KeepRecent > 0 {
+		limits.KeepRecent = c.config.Compaction.KeepRecent
+	}
+	return limits
+}
+
+func (c *Client) loadCampaignMemory(chatID int64) *CampaignMemory {
+	var memory CampaignMemory
+	err := c.storage.LoadFromDB(fmt.Sprintf(CampaignMemoryFile, chatID), &memory)
+	if err != nil {
+		fmt.Printf("Failed to load campaign memory for chat %d: %v\n", chatID, err)
+		return nil
+	}
+	if memory.Summary == "" {
+		return nil
+	}
+	return &memory
+}
+
+// chatConfig returns the model configuration for a chat, with the tools
+// enabled in it and its campaign memory injected.
+func (c *Client) chatConfig(chatID int64) *genai.GenerateContentConfig {
+	chatConfig := *c.aiConfig
+	chatConfig.Tools = c.toolSettings.Declarations(chatID)
+	if chatID == 0 {
+		return &chatConfig
+	}
+	memory := c.loadCampaignMemory(chatID)
+	if memory == nil {
+		return &chatConfig
+	}
+
+	parts := append([]*genai.Part{}, c.aiConfig.SystemInstruction.Parts...)
+	parts = append(parts, genai.NewPartFromText("Campaign memory, a summary of older conversations in this chat:\n"+memory.Summary))
+	chatConfig.SystemInstruction = &genai.Content{Parts: parts}
+	return &chatConfig
+}
+
+// compactIfNeeded summarizes the older part of a chat's history into its
+// campaign memory once the history grows past the configured budget, and
+// returns the chat that should be used from now on.
+func (c *Client) compactIfNeeded(ctx context.Context, chatID int64, chat Chat) (Chat, error) {
+	if chatID == 0 {
+		return chat, nil
+	}
+
+	limits := c.compactionLimits()
+	history := chat.History()
+	if len(history) <= limits.MaxMessages && estimateTokens(history) <= limits.MaxTokens {
+		return chat, nil
+	}
+
+	recent := trimHistory(history, limits.KeepRecent)
+	older := history[:len(history)-len(recent)]
+	if len(older) == 0 {
+		return chat, nil
+	}
+
+	fmt.Printf("Compacting %d of %d history contents for chat %d\n", len(older), len(history), chatID)
+
+	var previous string
+	if memory := c.loadCampaignMemory(chatID); memory != nil {
+		previous = memory.Summary
+	}
+	summary, err := c.summarize(ctx, previous, older)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize chat history: %w", err)
+	}
+
+	memory := &CampaignMemory{
+		Summary:   summary,
+		UpdatedAt: time.Now(),
+	}
+	err = c.storage.SaveToDB(fmt.Sprintf(CampaignMemoryFile, chatID), memory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save campaign memory: %w", err)
+	}
+
+	compacted, err := c.newChat(ctx, chatID, recent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compacted chat: %w", err)
+	}
+	c.saveChatSession(chatID, compacted)
+	return compacted, nil
+}
+
+func (c *Client) summarize(ctx context.Context, previous string, history []*genai.Content) (string, error) {
+	summaryChat, err := c.provider.NewChat(ctx, &genai.GenerateContentConfig{
+		SystemInstruction: &genai.Content{
+			Parts: []*genai.Part{genai.NewPartFromText(summaryInstruction)},
+		},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var prompt strings.Builder
+	if previous != "" {
+		prompt.WriteString("Previous campaign memory:\n")
+		prompt.WriteString(previous)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("Conversation transcript:\n")
+	prompt.WriteString(renderTranscript(history))
+
+	result, err := summaryChat.Send(ctx, genai.NewPartFromText(prompt.String()))
+	if err != nil {
+		return "", err
+	}
+	if result.Text == "" {
+		return "", fmt.Errorf("the model returned an empty summary")
+	}
+	return result.Text, nil
+}
+
+// renderTranscript turns history into plain text, keeping tool traffic short.
+func renderTranscript(history []*genai.Content) string {
+	var sb strings.Builder
+	for _, content := range history {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part == nil {
+				continue
+			}
+			switch {
+			case part.Text != "":
+				sb.WriteString(fmt.Sprintf("%s: %s\n", content.Role, part.Text))
+			case part.FunctionCall != nil:
+				sb.WriteString(fmt.Sprintf("%s called tool %s\n", content.Role, part.FunctionCall.Name))
+			case part.FunctionResponse != nil:
+				sb.WriteString(fmt.Sprintf("tool %s answered: %v\n", part.FunctionResponse.Name, part.FunctionResponse.Response["result"]))
+			}
+		}
+	}
+	return sb.String()
+}
+
+func estimateTokens(history []*genai.Content) int {
+	var chars int
+	for _, content := range history {
+		if content == nil {
+			continue
+		}
+		for _, part := range content.Parts {
+			if part == nil {
+				continue
+			}
+			chars += len(part.Text)
+			if part.FunctionCall != nil {
+				args, _ := json.Marshal(part.FunctionCall.Args)
+				chars += len(args)
+			}
+			if part.FunctionResponse != nil {
+				response, _ := json.Marshal(part.FunctionResponse.Response)
+				chars += len(response)
+			}
+		}
+	}
+	return chars / charsPerToken
+}
@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -36,7 +37,7 @@ var (
 	}
 )
 
-func (c *Client) EquipmentLookup(args map[string]any) (string, error) {
+func (c *Client) EquipmentLookup(ctx context.Context, args map[string]any) (string, error) {
 	equipmentName, ok := args["equipmentName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: equipmentName is required")
@@ -55,7 +56,7 @@ func (c *Client) EquipmentLookup(args map[string]any) (string, error) {
 
 	results := ""
 	for _, item := range equipment {
-		results += formatEquipmentDescription(item)
+		results += FormatEquipmentDescription(item)
 	}
 
 	if results == "" {
@@ -65,7 +66,8 @@ func (c *Client) EquipmentLookup(args map[string]any) (string, error) {
 	return results, nil
 }
 
-func formatEquipmentDescription(item *mysql.Equipment) string {
+// FormatEquipmentDescription renders a piece of equipment as plain text.
+func FormatEquipmentDescription(item *mysql.Equipment) string {
 	var desc strings.Builder
 
 	desc.WriteString(fmt.Sprintf("%s\n\n", item.Name))
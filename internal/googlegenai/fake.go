@@ -0,0 +1,182 @@
+package googlegenai
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// FakeProvider is an offline Provider that replays scripted responses in
+// order, across all of its chats. Once the script runs out it echoes the text
+// it was sent. It is meant for tests and local debugging.
+type FakeProvider struct {
+	lock      sync.Mutex
+	responses []*Response
+	sent      [][]*genai.Part
+	files     map[string]*genai.File
+}
+
+type fakeChat struct {
+	provider *FakeProvider
+	lock     sync.Mutex
+	history  []*genai.Content
+}
+
+// NewFakeProvider creates a FakeProvider that replays the given responses.
+func NewFakeProvider(responses ...*Response) *FakeProvider {
+	return &FakeProvider{
+		responses: responses,
+		files:     make(map[string]*genai.File),
+	}
+}
+
+// FakeText is a scripted response with plain text.
+func FakeText(text string) *Response {
+	return &Response{Text: text}
+}
+
+// FakeFunctionCall is a scripted response asking for a single function call.
+func FakeFunctionCall(name string, args map[string]any) *Response {
+	return &Response{
+		FunctionCalls: []*genai.FunctionCall{{Name: name, Args: args}},
+	}
+}
+
+// Script appends responses to be replayed after the current ones.
+func (p *FakeProvider) Script(responses ...*Response) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.responses = append(p.responses, responses...)
+}
+
+// Sent returns the parts of every turn sent to the provider so far.
+func (p *FakeProvider) Sent() [][]*genai.Part {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	sent := make([][]*genai.Part, len(p.sent))
+	copy(sent, p.sent)
+	return sent
+}
+
+func (p *FakeProvider) next(parts []*genai.Part) *Response {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sent = append(p.sent, parts)
+
+	if len(p.responses) == 0 {
+		var texts []string
+		for _, part := range parts {
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+			if part.FunctionResponse != nil {
+				texts = append(texts, fmt.Sprintf("%s: %v", part.FunctionResponse.Name, part.FunctionResponse.Response["result"]))
+			}
+		}
+		return &Response{Text: strings.Join(texts, "\n")}
+	}
+
+	response := p.responses[0]
+	p.responses = p.responses[1:]
+	return response
+}
+
+func (p *FakeProvider) NewChat(ctx context.Context, config *genai.GenerateContentConfig, history []*genai.Content) (Chat, error) {
+	chat := &fakeChat{provider: p}
+	chat.history = append(chat.history, history...)
+	return chat, nil
+}
+
+func (p *FakeProvider) UploadFile(ctx context.Context, filePath, mimeType string) (*genai.File, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	file := &genai.File{
+		Name:     fmt.Sprintf("files/fake-%d", len(p.files)+1),
+		URI:      "fake://" + filePath,
+		MIMEType: mimeType,
+	}
+	p.files[file.Name] = file
+	return file, nil
+}
+
+func (p *FakeProvider) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	file, ok := p.files[name]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", name)
+	}
+	return file, nil
+}
+
+func (p *FakeProvider) DeleteFile(ctx context.Context, name string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.files, name)
+	return nil
+}
+
+func (p *FakeProvider) ListFiles(ctx context.Context) ([]*genai.File, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	files := make([]*genai.File, 0, len(p.files))
+	for _, file := range p.files {
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (c *fakeChat) Send(ctx context.Context, parts ...*genai.Part) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	response := c.provider.next(parts)
+
+	reply := &genai.Content{Role: genai.RoleModel}
+	for _, call := range response.FunctionCalls {
+		reply.Parts = append(reply.Parts, &genai.Part{FunctionCall: call})
+	}
+	if response.Text != "" {
+		reply.Parts = append(reply.Parts, genai.NewPartFromText(response.Text))
+	}
+
+	c.lock.Lock()
+	c.history = append(c.history, genai.NewContentFromParts(parts, genai.RoleUser), reply)
+	c.lock.Unlock()
+
+	return response, nil
+}
+
+// SendStream replays the next scripted response, yielding its text one word at a time.
+func (c *fakeChat) SendStream(ctx context.Context, parts ...*genai.Part) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		response, err := c.Send(ctx, parts...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		words := strings.SplitAfter(response.Text, " ")
+		for i, word := range words {
+			chunk := &Response{Text: word}
+			if i == len(words)-1 {
+				chunk.FunctionCalls = response.FunctionCalls
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *fakeChat) History() []*genai.Content {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	history := make([]*genai.Content, len(c.history))
+	copy(history, c.history)
+	return history
+}
@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -11,6 +12,9 @@ import (
 const (
 	// FeatLookupToolName is the name of the tool that looks up feat descriptions.
 	FeatLookupToolName = "feat_lookup"
+
+	// MaxFeatsToReturn is the maximum number of feats to return in a single lookup.
+	MaxFeatsToReturn = 3
 )
 
 var (
@@ -36,7 +40,7 @@ var (
 	}
 )
 
-func (c *Client) FeatLookup(args map[string]any) (string, error) {
+func (c *Client) FeatLookup(ctx context.Context, args map[string]any) (string, error) {
 	featName, ok := args["featName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: featName is required")
@@ -44,28 +48,15 @@ func (c *Client) FeatLookup(args map[string]any) (string, error) {
 
 	fmt.Printf("Looking up feat: %q\n", featName)
 
-	feats, err := c.dbClient.GetFeatByName(featName)
+	found, err := c.LookupFeats(featName)
 	if err != nil {
-		return "", fmt.Errorf("failed to get feat from database: %v", err)
-	}
-
-	if len(feats) == 0 {
-		return fmt.Sprintf("No feat found with the name %q", featName), nil
-	}
-
-	results := ""
-	for _, feat := range feats {
-		results += formatFeatDescription(feat)
-	}
-
-	if results == "" {
-		return fmt.Sprintf("No description found for the feat %q", featName), nil
+		return "", err
 	}
-
-	return results, nil
+	return c.offerCandidates(ctx, found), nil
 }
 
-func formatFeatDescription(feat *mysql.Feat) string {
+// FormatFeatDescription renders a feat as plain text.
+func FormatFeatDescription(feat *mysql.Feat) string {
 	var desc strings.Builder
 
 	desc.WriteString(fmt.Sprintf("%s\n\n", feat.Name))
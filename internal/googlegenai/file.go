@@ -19,12 +19,10 @@ type FileMap map[string]*genai.File
 func (c *Client) UploadFile(ctx context.Context, filePath, fileName string) (*genai.File, error) {
 	fmt.Printf("Uploading file: %s\n", fileName)
 
-	file, err := c.client.Files.UploadFromPath(
+	file, err := c.provider.UploadFile(
 		ctx,
 		filepath.Join(storage.BasePath, filePath),
-		&genai.UploadFileConfig{
-			MIMEType: c.GetMimeTypeFromExtension(filePath),
-		},
+		c.GetMimeTypeFromExtension(filePath),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file: %w", err)
@@ -36,7 +34,7 @@ func (c *Client) UploadFile(ctx context.Context, filePath, fileName string) (*ge
 }
 
 func (c *Client) DeleteFile(ctx context.Context, fileName string) error {
-	_, err := c.client.Files.Delete(ctx, fileName, nil)
+	err := c.provider.DeleteFile(ctx, fileName)
 	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
@@ -44,7 +42,7 @@ func (c *Client) DeleteFile(ctx context.Context, fileName string) error {
 }
 
 func (c *Client) GetFile(ctx context.Context, fileID string) (*genai.File, error) {
-	file, err := c.client.Files.Get(ctx, fileID, nil)
+	file, err := c.provider.GetFile(ctx, fileID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file: %w", err)
 	}
@@ -52,22 +50,22 @@ func (c *Client) GetFile(ctx context.Context, fileID string) (*genai.File, error
 }
 
 func (c *Client) ListFiles(ctx context.Context) ([]*genai.File, error) {
-	page, err := c.client.Files.List(ctx, nil)
+	files, err := c.provider.ListFiles(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list files: %w", err)
 	}
 
-	if len(page.Items) == 0 {
+	if len(files) == 0 {
 		fmt.Println("No files found.")
 		return nil, nil
 	}
 
-	fmt.Printf("Found %d files:\n", len(page.Items))
-	for _, file := range page.Items {
+	fmt.Printf("Found %d files:\n", len(files))
+	for _, file := range files {
 		fmt.Printf("- %s (%s)\n", file.Name, file.MIMEType)
 	}
 
-	return page.Items, nil
+	return files, nil
 }
 
 func (c *Client) GetMimeTypeFromExtension(fileName string) string {
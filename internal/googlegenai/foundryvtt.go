@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -48,7 +49,7 @@ var (
 	}
 )
 
-func (c *Client) FoundryVTT(args map[string]any) (string, error) {
+func (c *Client) FoundryVTT(ctx context.Context, args map[string]any) (string, error) {
 	action, ok := args["action"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: action is required")
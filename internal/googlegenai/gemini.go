@@ -0,0 +1,102 @@
+package googlegenai
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"google.golang.org/genai"
+)
+
+// GeminiProvider is the Provider backed by the Gemini API.
+type GeminiProvider struct {
+	client *genai.Client
+	model  string
+}
+
+type geminiChat struct {
+	chat *genai.Chat
+}
+
+// NewGeminiProvider creates a Provider that talks to the Gemini API using Model.
+func NewGeminiProvider(ctx context.Context, apiKey string) (*GeminiProvider, error) {
+	if apiKey == "" {
+		return nil, fmt.Errorf("missing gemini_api_key in config.yaml")
+	}
+	client, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &GeminiProvider{
+		client: client,
+		model:  Model,
+	}, nil
+}
+
+func (p *GeminiProvider) NewChat(ctx context.Context, config *genai.GenerateContentConfig, history []*genai.Content) (Chat, error) {
+	chat, err := p.client.Chats.Create(ctx, p.model, config, history)
+	if err != nil {
+		return nil, err
+	}
+	return &geminiChat{chat: chat}, nil
+}
+
+func (p *GeminiProvider) UploadFile(ctx context.Context, filePath, mimeType string) (*genai.File, error) {
+	return p.client.Files.UploadFromPath(ctx, filePath, &genai.UploadFileConfig{
+		MIMEType: mimeType,
+	})
+}
+
+func (p *GeminiProvider) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return p.client.Files.Get(ctx, name, nil)
+}
+
+func (p *GeminiProvider) DeleteFile(ctx context.Context, name string) error {
+	_, err := p.client.Files.Delete(ctx, name, nil)
+	return err
+}
+
+func (p *GeminiProvider) ListFiles(ctx context.Context) ([]*genai.File, error) {
+	page, err := p.client.Files.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return page.Items, nil
+}
+
+func (c *geminiChat) Send(ctx context.Context, parts ...*genai.Part) (*Response, error) {
+	result, err := c.chat.Send(ctx, parts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{
+		Text:          result.Text(),
+		FunctionCalls: result.FunctionCalls(),
+	}, nil
+}
+
+func (c *geminiChat) SendStream(ctx context.Context, parts ...*genai.Part) iter.Seq2[*Response, error] {
+	return func(yield func(*Response, error) bool) {
+		for chunk, err := range c.chat.SendStream(ctx, parts...) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			response := &Response{
+				Text:          chunk.Text(),
+				FunctionCalls: chunk.FunctionCalls(),
+			}
+			if !yield(response, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *geminiChat) History() []*genai.Content {
+	return c.chat.History(false)
+}
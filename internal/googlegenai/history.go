@@ -0,0 +1,339 @@
+package googlegenai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/character"
+)
+
+const (
+	// ChatDataHistoryFile is the name of the file where the changes to the chat
+	// data of a chat are recorded.
+	ChatDataHistoryFile = "chat-data-history-%d.jsonl"
+
+	// HistoryPageSize is the number of changes shown by the history action.
+	HistoryPageSize = 10
+)
+
+// Change is a recorded change to a character, holding its sheet before and
+// after the change so it can be reverted.
+type Change struct {
+	Version   int       `json:"version"`
+	Time      time.Time `json:"time"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Action    string    `json:"action"`
+	Path      string    `json:"path"`
+	Summary   string    `json:"summary"`
+	Old       string    `json:"old,omitempty"`
+	New       string    `json:"new,omitempty"`
+	Character string    `json:"character"`
+	// Before is nil when the change created the character.
+	Before *character.Character `json:"before,omitempty"`
+	// After is nil when the change deleted the character.
+	After *character.Character `json:"after,omitempty"`
+	// Reverts is the version a revert restored the sheet to before.
+	Reverts int `json:"reverts,omitempty"`
+}
+
+// String renders the change like "#12 2024-05-01 20:15 alice: Set bob.hp to 20 (was 25)".
+func (ch *Change) String() string {
+	user := ch.UserName
+	if user == "" {
+		user = fmt.Sprintf("user %d", ch.UserID)
+	}
+	line := fmt.Sprintf("#%d %s %s: %s", ch.Version, ch.Time.Format("2006-01-02 15:04"), user, ch.Summary)
+	if ch.Action == actionSet && ch.Old != "" {
+		line += fmt.Sprintf(" (was %s)", ch.Old)
+	}
+	return line
+}
+
+// getHistory returns the changes to the chat data of a chat, loading them on
+// first use. The caller must hold c.dataLock.
+func (c *Client) getHistory(chatID int64) []*Change {
+	history, exists := c.history[chatID]
+	if exists {
+		return history
+	}
+
+	err := c.storage.LoadLinesFromDB(fmt.Sprintf(ChatDataHistoryFile, chatID), func(line []byte) error {
+		change := &Change{}
+		if err := json.Unmarshal(line, change); err != nil {
+			return err
+		}
+		history = append(history, change)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Failed to load chat data history of chat %d: %v\n", chatID, err)
+	}
+	c.history[chatID] = history
+	return history
+}
+
+// record appends a change to the history of a chat, filling in its version,
+// time and author. The caller must hold c.dataLock.
+func (c *Client) record(ctx context.Context, chatID int64, change *Change) {
+	identity := auth.IdentityFromContext(ctx)
+	history := c.getHistory(chatID)
+
+	change.Version = len(history) + 1
+	if len(history) > 0 {
+		change.Version = history[len(history)-1].Version + 1
+	}
+	change.Time = time.Now()
+	change.UserID = identity.UserID
+	change.UserName = identity.UserName
+	c.history[chatID] = append(history, change)
+
+	err := c.storage.AppendToDB(fmt.Sprintf(ChatDataHistoryFile, chatID), change)
+	if err != nil {
+		fmt.Printf("Failed to record change to chat data of chat %d: %v\n", chatID, err)
+	}
+}
+
+// mutate applies change to the character called name, creating it first if
+// create is set, then saves the chat data and records the change with the
+// value at path before and after it. The caller must hold c.dataLock.
+func (c *Client) mutate(ctx context.Context, chatID int64, roster *character.Roster, action, path string, create bool, change func(*character.Character) (string, error)) (string, error) {
+	name, field, _ := strings.Cut(path, ".")
+	sheet := roster.Find(name)
+	if sheet == nil && !create {
+		return fmt.Sprintf("There is no character called %s", name), nil
+	}
+
+	var before *character.Character
+	if sheet != nil {
+		before = sheet.Clone()
+	} else {
+		var err error
+		if sheet, err = roster.FindOrCreate(name); err != nil {
+			return "", err
+		}
+	}
+	old, _ := sheet.Get(field)
+
+	summary, err := change(sheet)
+	if err != nil {
+		if before == nil {
+			roster.Delete(sheet.Name)
+		} else {
+			roster.Put(before)
+		}
+		return "", err
+	}
+
+	updated, _ := sheet.Get(field)
+	c.saveChatData(chatID, roster)
+	c.record(ctx, chatID, &Change{
+		Action:    action,
+		Path:      path,
+		Summary:   summary,
+		Old:       old,
+		New:       updated,
+		Character: sheet.Name,
+		Before:    before,
+		After:     sheet.Clone(),
+	})
+	return summary, nil
+}
+
+// requestDeletion asks the user to confirm deleting a whole character, which
+// the model can't do on its own. The caller must hold c.dataLock.
+func (c *Client) requestDeletion(chatID int64, roster *character.Roster, name string) string {
+	sheet := roster.Find(name)
+	if sheet == nil {
+		return fmt.Sprintf("%s does not exist", name)
+	}
+
+	c.lock.Lock()
+	c.deletions[chatID] = append(c.deletions[chatID], sheet.Name)
+	c.lock.Unlock()
+	return fmt.Sprintf("Nothing was deleted yet: deleting the whole sheet of %s needs confirmation, and the user was offered a button to confirm it.", sheet.Name)
+}
+
+// TakeDeletions returns and forgets the names of the characters the model
+// asked to delete in a chat, which the user has to confirm.
+func (c *Client) TakeDeletions(chatID int64) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	names := c.deletions[chatID]
+	delete(c.deletions, chatID)
+	return names
+}
+
+// DeleteCharacter deletes a whole character from the chat of the caller in
+// ctx, as confirmed by the user, recording it so it can be undone. Only game
+// masters can delete characters.
+func (c *Client) DeleteCharacter(ctx context.Context, name string) (string, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 {
+		return "", fmt.Errorf("chat data is only available inside a chat")
+	}
+	if err := auth.Require(ctx, auth.RoleGM, "delete characters"); err != nil {
+		return "", err
+	}
+
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	roster, err := c.getChatData(chatID)
+	if err != nil {
+		return "", err
+	}
+	sheet := roster.Find(name)
+	if sheet == nil {
+		return fmt.Sprintf("%s does not exist", name), nil
+	}
+
+	roster.Delete(sheet.Name)
+	c.saveChatData(chatID, roster)
+	summary := fmt.Sprintf("Deleted character %s and all its properties", sheet.Name)
+	c.record(ctx, chatID, &Change{
+		Action:    actionDelete,
+		Path:      sheet.Name,
+		Summary:   summary,
+		Character: sheet.Name,
+		Before:    sheet,
+	})
+	return summary + ". Use /undo to bring it back.", nil
+}
+
+// History lists the latest changes to the chat data of a chat, newest first,
+// optionally only those to one character.
+func (c *Client) History(chatID int64, name string) string {
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	history := c.getHistory(chatID)
+	reverted := revertedVersions(history)
+
+	var lines []string
+	for i := len(history) - 1; i >= 0 && len(lines) < HistoryPageSize; i-- {
+		change := history[i]
+		if name != "" && !strings.EqualFold(change.Character, name) {
+			continue
+		}
+		line := change.String()
+		if reverted[change.Version] {
+			line += " (undone)"
+		}
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "No changes recorded"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Revert restores the character changed by a version of the chat data to how
+// it was before that change, recording the revert so it can be undone too.
+func (c *Client) Revert(ctx context.Context, version int) (string, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 {
+		return "", fmt.Errorf("chat data is only available inside a chat")
+	}
+
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	for _, change := range c.getHistory(chatID) {
+		if change.Version == version {
+			return c.revert(ctx, chatID, change, actionRevert)
+		}
+	}
+	return "", fmt.Errorf("there is no change #%d", version)
+}
+
+// Undo reverts the latest change to the chat data of the chat of the caller
+// in ctx that was not undone yet. Undoing again goes further back, since the
+// changes made by Undo are skipped.
+func (c *Client) Undo(ctx context.Context) (string, error) {
+	chatID := auth.IdentityFromContext(ctx).ChatID
+	if chatID == 0 {
+		return "", fmt.Errorf("chat data is only available inside a chat")
+	}
+
+	c.dataLock.Lock()
+	defer c.dataLock.Unlock()
+
+	history := c.getHistory(chatID)
+	reverted := revertedVersions(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		change := history[i]
+		if change.Action != actionUndo && !reverted[change.Version] {
+			return c.revert(ctx, chatID, change, actionUndo)
+		}
+	}
+	return "There is nothing to undo", nil
+}
+
+// revert restores the sheet of a character to how it was before change,
+// recording it as action. It refuses when later changes to the character
+// would be lost, and only game masters can revert the creation of a
+// character, which deletes it. The caller must hold c.dataLock.
+func (c *Client) revert(ctx context.Context, chatID int64, change *Change, action string) (string, error) {
+	var later []string
+	history := c.getHistory(chatID)
+	reverted := revertedVersions(history)
+	for _, other := range history {
+		if other.Version > change.Version && other.Reverts == 0 && !reverted[other.Version] && strings.EqualFold(other.Character, change.Character) {
+			later = append(later, fmt.Sprintf("#%d", other.Version))
+		}
+	}
+	if len(later) > 0 {
+		return fmt.Sprintf("Can't undo #%d, it would also undo the later changes to %s: %s. Undo those first.", change.Version, change.Character, strings.Join(later, ", ")), nil
+	}
+	if change.Before == nil {
+		if err := auth.Require(ctx, auth.RoleGM, "undo the creation of "+change.Character); err != nil {
+			return "", err
+		}
+	}
+
+	roster, err := c.getChatData(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	var current *character.Character
+	if sheet := roster.Find(change.Character); sheet != nil {
+		current = sheet.Clone()
+	}
+	if change.Before == nil {
+		roster.Delete(change.Character)
+	} else {
+		roster.Put(change.Before.Clone())
+	}
+	c.saveChatData(chatID, roster)
+
+	summary := fmt.Sprintf("Undid #%d: %s", change.Version, change.Summary)
+	c.record(ctx, chatID, &Change{
+		Action:    action,
+		Path:      change.Character,
+		Summary:   summary,
+		Character: change.Character,
+		Before:    current,
+		After:     change.Before,
+		Reverts:   change.Version,
+	})
+	return summary, nil
+}
+
+// revertedVersions returns the versions of the changes that were reverted.
+func revertedVersions(history []*Change) map[int]bool {
+	reverted := make(map[int]bool)
+	for _, change := range history {
+		if change.Reverts != 0 {
+			reverted[change.Reverts] = true
+		}
+	}
+	return reverted
+}
@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -36,7 +37,7 @@ var (
 	}
 )
 
-func (c *Client) ItemLookup(args map[string]any) (string, error) {
+func (c *Client) ItemLookup(ctx context.Context, args map[string]any) (string, error) {
 	itemName, ok := args["itemName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: itemName is required")
@@ -55,7 +56,7 @@ func (c *Client) ItemLookup(args map[string]any) (string, error) {
 
 	results := ""
 	for _, item := range items {
-		results += formatItemDescription(item)
+		results += FormatItemDescription(item)
 	}
 
 	if results == "" {
@@ -65,7 +66,8 @@ func (c *Client) ItemLookup(args map[string]any) (string, error) {
 	return results, nil
 }
 
-func formatItemDescription(item *mysql.Item) string {
+// FormatItemDescription renders a magic item as plain text.
+func FormatItemDescription(item *mysql.Item) string {
 	var desc strings.Builder
 
 	desc.WriteString(fmt.Sprintf("%s\n\n", item.Name))
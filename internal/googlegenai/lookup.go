@@ -0,0 +1,207 @@
+package googlegenai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gtrindade/ultra-kiew/internal/mysql"
+)
+
+const (
+	// KindSpell, KindFeat and KindMonster are the kinds of entries lookups can offer as candidates.
+	KindSpell   = "spell"
+	KindFeat    = "feat"
+	KindMonster = "monster"
+
+	// MaxCandidates is the maximum number of matches offered to pick from.
+	MaxCandidates = 20
+)
+
+// Candidate is an entry matching an ambiguous lookup, offered to the user to pick.
+type Candidate struct {
+	Kind   string
+	ID     int
+	Name   string
+	Source string
+}
+
+// Label renders the candidate like "Fireball (Player's Handbook v.3.5)".
+func (c *Candidate) Label() string {
+	if c.Source == "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%s (%s)", c.Name, c.Source)
+}
+
+// Lookup is the result of looking up entries by name. When the name matches
+// too many entries, Text asks to be more specific and Candidates holds the
+// first MaxCandidates matches.
+type Lookup struct {
+	Text       string
+	Candidates []*Candidate
+}
+
+// LookupSpells looks up the spells matching name.
+func (c *Client) LookupSpells(name string) (*Lookup, error) {
+	spells, err := c.dbClient.GetSpellByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get spell from database: %w", err)
+	}
+	return lookup(KindSpell, name, spells, MaxSpellsToReturn, func(s *mysql.Spell) *Candidate {
+		return &Candidate{Kind: KindSpell, ID: s.ID, Name: s.Name, Source: s.Source}
+	}, FormatSpellDescription), nil
+}
+
+// LookupFeats looks up the feats matching name.
+func (c *Client) LookupFeats(name string) (*Lookup, error) {
+	feats, err := c.dbClient.GetFeatByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feat from database: %w", err)
+	}
+	return lookup(KindFeat, name, feats, MaxFeatsToReturn, func(f *mysql.Feat) *Candidate {
+		return &Candidate{Kind: KindFeat, ID: f.ID, Name: f.Name, Source: f.Source}
+	}, FormatFeatDescription), nil
+}
+
+// LookupMonsters looks up the monsters matching name.
+func (c *Client) LookupMonsters(name string) (*Lookup, error) {
+	monsters, err := c.dbClient.GetMonstersByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monsters from database: %w", err)
+	}
+	return lookup(KindMonster, name, monsters, MaxMonstersToReturn, func(m *mysql.Monster) *Candidate {
+		source := ""
+		if m.Reference != nil {
+			source = *m.Reference
+		}
+		return &Candidate{Kind: KindMonster, ID: m.ID, Name: m.Name, Source: source}
+	}, FormatMonsterDescription), nil
+}
+
+// lookup renders the results of a lookup, preferring exact name matches and
+// offering candidates when there are more than maxResults results.
+func lookup[T any](kind, name string, results []T, maxResults int, candidate func(T) *Candidate, format func(T) string) *Lookup {
+	if len(results) == 0 {
+		return &Lookup{Text: fmt.Sprintf("No %s found with the name %q", kind, name)}
+	}
+
+	var descriptions []string
+	for _, result := range results {
+		if strings.EqualFold(candidate(result).Name, strings.TrimSpace(name)) {
+			descriptions = append(descriptions, strings.TrimSpace(format(result)))
+		}
+	}
+	if len(descriptions) > 0 {
+		return &Lookup{Text: strings.Join(descriptions, "\n\n")}
+	}
+
+	if len(results) > maxResults {
+		var sb strings.Builder
+		found := &Lookup{}
+		sb.WriteString(fmt.Sprintf("Too many %ss found, here is a list of names:\n", kind))
+		for _, result := range results {
+			match := candidate(result)
+			if match.Source == "" {
+				sb.WriteString(fmt.Sprintf("- %q\n", match.Name))
+			} else {
+				sb.WriteString(fmt.Sprintf("- %q from %s\n", match.Name, match.Source))
+			}
+			if len(found.Candidates) < MaxCandidates {
+				found.Candidates = append(found.Candidates, match)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("\nPlease be more specific, there are %d %ss with similar names.", len(results), kind))
+		found.Text = sb.String()
+		return found
+	}
+
+	for _, result := range results {
+		descriptions = append(descriptions, strings.TrimSpace(format(result)))
+	}
+	return &Lookup{Text: strings.Join(descriptions, "\n\n")}
+}
+
+// Describe renders the entry of the given kind and id, as picked from the
+// candidates of a lookup.
+func (c *Client) Describe(kind string, id int) (string, error) {
+	var description string
+	switch kind {
+	case KindSpell:
+		spell, err := c.dbClient.GetSpellByID(id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get spell from database: %w", err)
+		}
+		if spell != nil {
+			description = FormatSpellDescription(spell)
+		}
+	case KindFeat:
+		feat, err := c.dbClient.GetFeatByID(id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get feat from database: %w", err)
+		}
+		if feat != nil {
+			description = FormatFeatDescription(feat)
+		}
+	case KindMonster:
+		monster, err := c.dbClient.GetMonsterByID(id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get monster from database: %w", err)
+		}
+		if monster != nil {
+			description = FormatMonsterDescription(monster)
+		}
+	default:
+		return "", fmt.Errorf("unknown kind of entry: %s", kind)
+	}
+
+	if description == "" {
+		return "", fmt.Errorf("the %s no longer exists", kind)
+	}
+	return strings.TrimSpace(description), nil
+}
+
+// Candidates collects the candidates offered by the lookups the model makes
+// while answering a single message.
+type Candidates struct {
+	lock       sync.Mutex
+	candidates []*Candidate
+}
+
+type candidatesKey struct{}
+
+// WithCandidates returns a context collecting the candidates offered by the
+// lookups made with it, so replies to concurrent messages of a chat each get
+// their own.
+func WithCandidates(ctx context.Context) (context.Context, *Candidates) {
+	candidates := &Candidates{}
+	return context.WithValue(ctx, candidatesKey{}, candidates), candidates
+}
+
+// Take returns and forgets the collected candidates.
+func (c *Candidates) Take() []*Candidate {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	candidates := c.candidates
+	c.candidates = nil
+	if len(candidates) > MaxCandidates {
+		candidates = candidates[:MaxCandidates]
+	}
+	return candidates
+}
+
+// offerCandidates keeps the candidates of a lookup made by the model in the
+// context of the message, so the chat client can show them alongside the reply.
+func (c *Client) offerCandidates(ctx context.Context, found *Lookup) string {
+	candidates, ok := ctx.Value(candidatesKey{}).(*Candidates)
+	if !ok || len(found.Candidates) == 0 {
+		return found.Text
+	}
+
+	candidates.lock.Lock()
+	candidates.candidates = append(candidates.candidates, found.Candidates...)
+	candidates.lock.Unlock()
+	return found.Text + "\nThe user was also offered buttons to pick one of them."
+}
@@ -0,0 +1,83 @@
+package googlegenai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type entry struct {
+	id     int
+	name   string
+	source string
+}
+
+func lookupEntries(name string, entries []entry) *Lookup {
+	return lookup(KindMonster, name, entries, 1, func(e entry) *Candidate {
+		return &Candidate{Kind: KindMonster, ID: e.id, Name: e.name, Source: e.source}
+	}, func(e entry) string {
+		return e.name
+	})
+}
+
+func TestLookupListsCandidates(t *testing.T) {
+	found := lookupEntries("goblin", []entry{{1, "Goblin Boss", "Monster Manual"}, {2, "Goblin Rider", ""}})
+
+	if !strings.Contains(found.Text, `- "Goblin Boss" from Monster Manual`+"\n") {
+		t.Errorf("Text = %q, want the source of the first match", found.Text)
+	}
+	if !strings.Contains(found.Text, `- "Goblin Rider"`+"\n") {
+		t.Errorf("Text = %q, want the second match without a source", found.Text)
+	}
+	if len(found.Candidates) != 2 || found.Candidates[1].Label() != "Goblin Rider" {
+		t.Errorf("Candidates = %v, want both matches", found.Candidates)
+	}
+}
+
+func TestCandidatesArePerMessage(t *testing.T) {
+	client := &Client{}
+	first, firstCandidates := WithCandidates(context.Background())
+	second, secondCandidates := WithCandidates(context.Background())
+
+	client.offerCandidates(first, lookupEntries("goblin", []entry{{1, "Goblin Boss", ""}, {2, "Goblin Rider", ""}}))
+	client.offerCandidates(second, lookupEntries("wolf", []entry{{3, "Dire Wolf", ""}, {4, "Winter Wolf", ""}}))
+	// Without a collector, like in a command, nothing is kept.
+	text := client.offerCandidates(context.Background(), lookupEntries("orc", []entry{{5, "Orc Captain", ""}, {6, "Orc Shaman", ""}}))
+	if strings.Contains(text, "buttons") {
+		t.Errorf("offerCandidates() without a collector = %q, want no mention of buttons", text)
+	}
+
+	if got := labels(firstCandidates.Take()); got != "Goblin Boss, Goblin Rider" {
+		t.Errorf("first message candidates = %q, want the goblins", got)
+	}
+	if got := labels(secondCandidates.Take()); got != "Dire Wolf, Winter Wolf" {
+		t.Errorf("second message candidates = %q, want the wolves", got)
+	}
+	if got := firstCandidates.Take(); len(got) != 0 {
+		t.Errorf("Take() again = %v, want nothing", got)
+	}
+}
+
+func TestCandidatesAreCapped(t *testing.T) {
+	ctx, candidates := WithCandidates(context.Background())
+	client := &Client{}
+	for i := range 3 {
+		var entries []entry
+		for j := range MaxCandidates {
+			entries = append(entries, entry{i*MaxCandidates + j, fmt.Sprintf("Goblin %d", i*MaxCandidates+j), ""})
+		}
+		client.offerCandidates(ctx, lookupEntries("goblin", entries))
+	}
+	if got := candidates.Take(); len(got) != MaxCandidates {
+		t.Errorf("Take() returned %d candidates, want %d", len(got), MaxCandidates)
+	}
+}
+
+func labels(candidates []*Candidate) string {
+	var labels []string
+	for _, candidate := range candidates {
+		labels = append(labels, candidate.Label())
+	}
+	return strings.Join(labels, ", ")
+}
@@ -3,39 +3,58 @@ package googlegenai
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/gtrindade/ultra-kiew/internal/auth"
 	"google.golang.org/genai"
 )
 
-const MaxFunctionResponseLength = 10000
+const (
+	MaxFunctionResponseLength = 10000
+
+	// ToolTimeout is the deadline given to a single tool call.
+	ToolTimeout = 30 * time.Second
+)
 
 // SendMessageWithParts sends a message with multiple parts to the chat and returns the response text.
 func (c *Client) SendMessageWithParts(ctx context.Context, chatID int64, parts []*genai.Part) (string, error) {
-	var err error
-	chat, exists := c.chats[chatID]
-	if !exists {
-		chat, err = c.NewChat(ctx, chatID)
-		if err != nil {
-			return "", fmt.Errorf("failed to create new chat: %w", err)
-		}
+	if chatID != 0 {
+		lock := c.chatLock(chatID)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	chat, err := c.GetChat(ctx, chatID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new chat: %w", err)
 	}
 	result, err := chat.Send(ctx, parts...)
 	if err != nil {
 		return "", err
 	}
+	c.saveChatSession(chatID, chat)
 
-	return result.Text(), nil
+	return result.Text, nil
 }
 
 // SendMessage sends a text message to the chat and handles any function calls that may be triggered.
 func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) (string, error) {
-	var err error
-	chat, exists := c.chats[chatID]
-	if !exists {
-		chat, err = c.NewChat(ctx, chatID)
-		if err != nil {
-			return "", fmt.Errorf("failed to create new chat: %w", err)
-		}
+	return c.SendMessageStream(ctx, chatID, text, nil)
+}
+
+// SendMessageStream works like SendMessage but streams the reply, calling
+// onText with the text generated so far as chunks arrive. Function calls made
+// mid-stream are executed and their results streamed back to the model. A nil
+// onText sends the message without streaming.
+func (c *Client) SendMessageStream(ctx context.Context, chatID int64, text string, onText func(text string)) (string, error) {
+	lock := c.chatLock(chatID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	chat, err := c.GetChat(ctx, chatID)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new chat: %w", err)
 	}
 
 	err = c.checkChatHistory(chatID)
@@ -43,55 +62,55 @@ func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) (st
 		return "", err
 	}
 
-	msg := fmt.Sprintf("%s. The chatID is %d", text, chatID)
-	parts := []*genai.Part{genai.NewPartFromText(msg)}
-	result, err := chat.Send(ctx, parts...)
+	chat, _ = c.loadChat(chatID)
+	compacted, err := c.compactIfNeeded(ctx, chatID, chat)
+	if err != nil {
+		fmt.Printf("Failed to compact chat %d, keeping the full history: %v\n", chatID, err)
+	} else {
+		chat = compacted
+	}
+
+	var texts []string
+	emit := func(text string) {
+		if onText != nil {
+			onText(joinTexts(append(texts, text)))
+		}
+	}
+
+	parts := []*genai.Part{genai.NewPartFromText(text)}
+	result, err := c.sendTurn(ctx, chat, parts, onText != nil, emit)
 	if err != nil {
 		return "", fmt.Errorf("failed to send message: %w", err)
 	}
 
-	functionCalls := result.FunctionCalls()
+	functionCalls := result.FunctionCalls
 	for len(functionCalls) > 0 {
+		if result.Text != "" {
+			texts = append(texts, result.Text)
+		}
+
 		var response []*genai.Part
 		for _, call := range functionCalls {
-			toolConfig, exists := c.toolConfigs[call.Name]
-			if !exists {
-				part := genai.NewPartFromText(fmt.Sprintf("Error: Tool configuration for %s not found", call.Name))
-				response = append(response, part)
-				continue
-			}
-
-			functionResult, err := toolConfig.Function(call.Args)
-			if err != nil {
-				part := genai.NewPartFromText(fmt.Sprintf("Error executing function %s: %v", call.Name, err))
-				response = append(response, part)
-				continue
-			}
-
-			if len(functionResult) > MaxFunctionResponseLength {
-				fmt.Printf("Function result too long (%d characters), truncating\n", len(functionResult))
-				functionResult = functionResult[:MaxFunctionResponseLength] + "...(truncated)"
-				response = append(response, genai.NewPartFromText("Note: The function result was too long and has been truncated."))
-			}
-
-			part := genai.NewPartFromFunctionResponse(call.Name, map[string]any{
-				"result": functionResult,
-			})
-			response = append(response, part)
+			response = append(response, c.callTool(ctx, chatID, call)...)
 		}
 
 		if len(response) > 0 {
-			result, err = chat.Send(ctx, response...)
+			result, err = c.sendTurn(ctx, chat, response, onText != nil, emit)
 			if err != nil {
 				return "", fmt.Errorf("failed to send function response: %w", err)
 			}
-			functionCalls = result.FunctionCalls()
+			functionCalls = result.FunctionCalls
 		} else {
 			break
 		}
 	}
 
-	responseText := result.Text()
+	c.saveChatSession(chatID, chat)
+
+	if result.Text != "" {
+		texts = append(texts, result.Text)
+	}
+	responseText := joinTexts(texts)
 	if responseText == "" {
 		err = c.checkChatHistory(chatID)
 		if err != nil {
@@ -103,13 +122,86 @@ func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) (st
 	return responseText, nil
 }
 
+// callTool runs a function call requested by the model and returns the parts
+// answering it. Tools always act on chatID, whatever the model asks for.
+func (c *Client) callTool(ctx context.Context, chatID int64, call *genai.FunctionCall) []*genai.Part {
+	tool, exists := c.tools.Get(call.Name)
+	if !exists {
+		return []*genai.Part{genai.NewPartFromText(fmt.Sprintf("Error: Tool configuration for %s not found", call.Name))}
+	}
+	if !c.toolSettings.Enabled(chatID, tool) {
+		return []*genai.Part{genai.NewPartFromText(fmt.Sprintf("Error: Tool %s is disabled in this chat", call.Name))}
+	}
+
+	identity := auth.IdentityFromContext(ctx)
+	identity.ChatID = chatID
+	ctx = auth.WithIdentity(ctx, identity)
+
+	err := auth.Require(ctx, tool.RequiredRole(call.Args), fmt.Sprintf("use %s this way", call.Name))
+	if err != nil {
+		return []*genai.Part{genai.NewPartFromText(fmt.Sprintf("Error: %v. Tell the user they are not allowed to do this.", err))}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ToolTimeout)
+	defer cancel()
+
+	functionResult, err := tool.Handler(ctx, call.Args)
+	if err != nil {
+		return []*genai.Part{genai.NewPartFromText(fmt.Sprintf("Error executing function %s: %v", call.Name, err))}
+	}
+
+	var parts []*genai.Part
+	if len(functionResult) > MaxFunctionResponseLength {
+		fmt.Printf("Function result too long (%d characters), truncating\n", len(functionResult))
+		functionResult = functionResult[:MaxFunctionResponseLength] + "...(truncated)"
+		parts = append(parts, genai.NewPartFromText("Note: The function result was too long and has been truncated."))
+	}
+
+	return append(parts, genai.NewPartFromFunctionResponse(call.Name, map[string]any{
+		"result": functionResult,
+	}))
+}
+
+// sendTurn sends parts to the chat. When streaming, it merges the chunks into
+// a single response and reports the text of the turn so far through emit.
+func (c *Client) sendTurn(ctx context.Context, chat Chat, parts []*genai.Part, stream bool, emit func(text string)) (*Response, error) {
+	if !stream {
+		return chat.Send(ctx, parts...)
+	}
+
+	var text strings.Builder
+	merged := &Response{}
+	for chunk, err := range chat.SendStream(ctx, parts...) {
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Text != "" {
+			text.WriteString(chunk.Text)
+			emit(text.String())
+		}
+		merged.FunctionCalls = append(merged.FunctionCalls, chunk.FunctionCalls...)
+	}
+	merged.Text = text.String()
+	return merged, nil
+}
+
+func joinTexts(texts []string) string {
+	var nonEmpty []string
+	for _, text := range texts {
+		if text = strings.TrimSpace(text); text != "" {
+			nonEmpty = append(nonEmpty, text)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
+
 func (c *Client) checkChatHistory(chatID int64) error {
-	chat, exists := c.chats[chatID]
+	chat, exists := c.loadChat(chatID)
 	if !exists {
 		return fmt.Errorf("chat with ID %d does not exist", chatID)
 	}
 
-	history := chat.History(false)
+	history := chat.History()
 	for _, content := range history {
 		if content != nil && len(content.Parts) > 0 {
 			continue
@@ -119,7 +211,7 @@ func (c *Client) checkChatHistory(chatID int64) error {
 		if err != nil {
 			return fmt.Errorf("failed to recover chat session: %w", err)
 		}
-		c.chats[chatID] = newChat
+		c.saveChatSession(chatID, newChat)
 		return fmt.Errorf("Due to a known issue, I failed to generate a response and broke the chat history. I had to start a new session. Please try again.\n\nThe issue: https://discuss.ai.google.dev/t/empty-response-text-from-gemini-2-5-pro-despite-no-safety-and-max-tokens-issues/98010/23")
 	}
 
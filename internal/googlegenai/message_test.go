@@ -0,0 +1,59 @@
+package googlegenai_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+)
+
+func TestSendMessageStreamCallsTools(t *testing.T) {
+	const chatID = 7
+	call := addArrow()
+	call.Text = "Let me check the inventory."
+	provider := googlegenai.NewFakeProvider(call, googlegenai.FakeText("Bob has an arrow now."))
+	client := newTestClient(t, provider)
+
+	var updates []string
+	response, err := client.SendMessageStream(chatContext(chatID), chatID, "give bob an arrow", func(text string) {
+		updates = append(updates, text)
+	})
+	if err != nil {
+		t.Fatalf("SendMessageStream() error = %v", err)
+	}
+
+	want := "Let me check the inventory.\n\nBob has an arrow now."
+	if response != want {
+		t.Errorf("response = %q, want %q", response, want)
+	}
+	if len(updates) < 2 {
+		t.Fatalf("got %d streamed updates, want the reply in several chunks", len(updates))
+	}
+	for i := 1; i < len(updates); i++ {
+		if !strings.HasPrefix(updates[i], strings.TrimSpace(updates[i-1])) {
+			t.Errorf("update %d = %q does not extend %q", i, updates[i], updates[i-1])
+		}
+	}
+	if last := updates[len(updates)-1]; last != want {
+		t.Errorf("last update = %q, want %q", last, want)
+	}
+
+	if got := arrows(t, client, chatID); got != 1 {
+		t.Errorf("arrows = %d, want 1", got)
+	}
+
+	sent := provider.Sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d turns, want the message and the tool result", len(sent))
+	}
+	var result string
+	for _, part := range sent[1] {
+		if part.FunctionResponse != nil && part.FunctionResponse.Name == "chat_data" {
+			result = fmt.Sprint(part.FunctionResponse.Response["result"])
+		}
+	}
+	if !strings.Contains(result, "Added arrow") {
+		t.Errorf("tool result sent to the model = %q, want the result of adding the arrow", result)
+	}
+}
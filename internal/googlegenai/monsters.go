@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -11,6 +12,9 @@ import (
 const (
 	// MonsterLookupToolName is the name of the tool that looks up monster descriptions.
 	MonsterLookupToolName = "monster_lookup"
+
+	// MaxMonstersToReturn is the maximum number of monsters to return in a single lookup.
+	MaxMonstersToReturn = 3
 )
 
 var (
@@ -36,7 +40,7 @@ var (
 	}
 )
 
-func (c *Client) MonsterLookup(args map[string]any) (string, error) {
+func (c *Client) MonsterLookup(ctx context.Context, args map[string]any) (string, error) {
 	monsterName, ok := args["monsterName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: monsterName is required")
@@ -44,28 +48,15 @@ func (c *Client) MonsterLookup(args map[string]any) (string, error) {
 
 	fmt.Printf("Looking up monster: %q\n", monsterName)
 
-	monsters, err := c.dbClient.GetMonstersByName(monsterName)
+	found, err := c.LookupMonsters(monsterName)
 	if err != nil {
-		return "", fmt.Errorf("failed to get monsters from database: %v", err)
-	}
-
-	if len(monsters) == 0 {
-		return fmt.Sprintf("No monsters found with the name %q", monsterName), nil
-	}
-
-	results := ""
-	for _, monster := range monsters {
-		results += formatMonsterDescription(monster)
-	}
-
-	if results == "" {
-		return fmt.Sprintf("No description found for the monster %q", monsterName), nil
+		return "", err
 	}
-
-	return results, nil
+	return c.offerCandidates(ctx, found), nil
 }
 
-func formatMonsterDescription(monster *mysql.Monster) string {
+// FormatMonsterDescription renders a monster stat block as plain text.
+func FormatMonsterDescription(monster *mysql.Monster) string {
 	var desc strings.Builder
 
 	// Header with name and type information
@@ -0,0 +1,38 @@
+package googlegenai
+
+import (
+	"context"
+	"iter"
+
+	"google.golang.org/genai"
+)
+
+// Provider is an LLM backend that can hold multi-turn chats and store files.
+type Provider interface {
+	// NewChat starts a chat with the given configuration, seeded with history.
+	NewChat(ctx context.Context, config *genai.GenerateContentConfig, history []*genai.Content) (Chat, error)
+	// UploadFile uploads the file at filePath and returns its remote handle.
+	UploadFile(ctx context.Context, filePath, mimeType string) (*genai.File, error)
+	// GetFile returns the remote file with the given name.
+	GetFile(ctx context.Context, name string) (*genai.File, error)
+	// DeleteFile removes the remote file with the given name.
+	DeleteFile(ctx context.Context, name string) error
+	// ListFiles lists the remote files.
+	ListFiles(ctx context.Context) ([]*genai.File, error)
+}
+
+// Chat is a single multi-turn conversation with the model.
+type Chat interface {
+	// Send sends a user turn and returns the model's reply.
+	Send(ctx context.Context, parts ...*genai.Part) (*Response, error)
+	// SendStream sends a user turn and yields the model's reply in chunks.
+	SendStream(ctx context.Context, parts ...*genai.Part) iter.Seq2[*Response, error]
+	// History returns every turn of the conversation, including invalid ones.
+	History() []*genai.Content
+}
+
+// Response is a single model turn.
+type Response struct {
+	Text          string
+	FunctionCalls []*genai.FunctionCall
+}
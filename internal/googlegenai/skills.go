@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -36,7 +37,7 @@ var (
 	}
 )
 
-func (c *Client) SkillLookup(args map[string]any) (string, error) {
+func (c *Client) SkillLookup(ctx context.Context, args map[string]any) (string, error) {
 	skillName, ok := args["skillName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: skillName is required")
@@ -55,7 +56,7 @@ func (c *Client) SkillLookup(args map[string]any) (string, error) {
 
 	results := ""
 	for _, skill := range skills {
-		results += formatSkillDescription(skill)
+		results += FormatSkillDescription(skill)
 	}
 
 	if results == "" {
@@ -65,7 +66,8 @@ func (c *Client) SkillLookup(args map[string]any) (string, error) {
 	return results, nil
 }
 
-func formatSkillDescription(skill *mysql.Skill) string {
+// FormatSkillDescription renders a skill as plain text.
+func FormatSkillDescription(skill *mysql.Skill) string {
 	var desc strings.Builder
 
 	desc.WriteString(fmt.Sprintf("%s\n\n", skill.Name))
@@ -1,6 +1,7 @@
 package googlegenai
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -39,7 +40,7 @@ var (
 	}
 )
 
-func (c *Client) SpellLookup(args map[string]any) (string, error) {
+func (c *Client) SpellLookup(ctx context.Context, args map[string]any) (string, error) {
 	spellName, ok := args["spellName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: spellName is required")
@@ -47,47 +48,15 @@ func (c *Client) SpellLookup(args map[string]any) (string, error) {
 
 	fmt.Printf("Looking up spell: %q\n", spellName)
 
-	spells, err := c.dbClient.GetSpellByName(spellName)
+	found, err := c.LookupSpells(spellName)
 	if err != nil {
-		return "", fmt.Errorf("failed to get spell from database: %v", err)
+		return "", err
 	}
-
-	if len(spells) == 0 {
-		return fmt.Sprintf("No spell found with the name %q", spellName), nil
-	}
-
-	results := ""
-	for _, spell := range spells {
-		if spell.Name == spellName {
-			results += formatSpellDescription(spell)
-		}
-	}
-
-	if results != "" {
-		return results, nil
-	}
-
-	if len(spells) > MaxSpellsToReturn {
-		results += "Too many spells found, here is a list of names:\n"
-		for _, spell := range spells {
-			results += fmt.Sprintf("- %q from %s\n", spell.Name, spell.Source)
-		}
-		results += fmt.Sprintf("\nPlease be more specific, there are %d spells with similar names.\n\n", len(spells))
-		return results, nil
-	}
-
-	for _, spell := range spells {
-		results += formatSpellDescription(spell)
-	}
-
-	if results == "" {
-		return fmt.Sprintf("The spell %q was found but has no description", spellName), nil
-	}
-
-	return results, nil
+	return c.offerCandidates(ctx, found), nil
 }
 
-func formatSpellDescription(spell *mysql.Spell) string {
+// FormatSpellDescription renders a spell as plain text.
+func FormatSpellDescription(spell *mysql.Spell) string {
 	var desc strings.Builder
 
 	// Header with name and school
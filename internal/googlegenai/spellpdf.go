@@ -39,8 +39,7 @@ var (
 	}
 )
 
-func (c *Client) SpellLookupOnPDF(args map[string]any) (string, error) {
-	ctx := context.Background()
+func (c *Client) SpellLookupOnPDF(ctx context.Context, args map[string]any) (string, error) {
 	spellName, ok := args["spellName"].(string)
 	if !ok {
 		return "", fmt.Errorf("invalid argument: spellName is required")
@@ -48,7 +47,15 @@ func (c *Client) SpellLookupOnPDF(args map[string]any) (string, error) {
 
 	fmt.Printf("Looking up spell: %q\n", spellName)
 
-	spellCompendium, err := c.GetFile(ctx, c.fileMap[SpellCompendium].Name)
+	c.lock.RLock()
+	file := c.fileMap[SpellCompendium]
+	c.lock.RUnlock()
+
+	var spellCompendium *genai.File
+	err := fmt.Errorf("file %s was never uploaded", SpellCompendium)
+	if file != nil {
+		spellCompendium, err = c.GetFile(ctx, file.Name)
+	}
 	if err != nil {
 		filePath := path.Join(storage.BasePath, storage.PDFsPath, SpellCompendium)
 		spellCompendium, err = c.UploadFile(ctx, filePath, SpellCompendium)
@@ -0,0 +1,32 @@
+package googlegenai
+
+import (
+	"context"
+
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+)
+
+// ToolSettings returns the store of per-chat tool settings.
+func (c *Client) ToolSettings() *tools.Settings {
+	return c.toolSettings
+}
+
+// SetToolEnabled enables or disables a tool in a chat, recreating the chat
+// with its current history so the model sees the new set of tools.
+func (c *Client) SetToolEnabled(ctx context.Context, chatID int64, name string, enabled bool) error {
+	lock := c.chatLock(chatID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	err := c.toolSettings.SetEnabled(chatID, name, enabled)
+	if err != nil {
+		return err
+	}
+
+	chat, exists := c.loadChat(chatID)
+	if !exists {
+		return nil
+	}
+	_, err = c.newChat(ctx, chatID, chat.History())
+	return err
+}
@@ -24,11 +24,27 @@ type Feat struct {
 	Categories string `db:"categories"`
 }
 
+// GetFeatByName returns the feats whose names contain name.
 func (c *Client) GetFeatByName(name string) ([]*Feat, error) {
+	return c.queryFeats("f.name LIKE ?", "%"+name+"%")
+}
+
+// GetFeatByID returns the feat with the given id, or nil if there is none.
+func (c *Client) GetFeatByID(id int) (*Feat, error) {
+	feats, err := c.queryFeats("f.id = ?", id)
+	if err != nil || len(feats) == 0 {
+		return nil, err
+	}
+	return feats[0], nil
+}
+
+// queryFeats returns the feats matching condition, a WHERE clause taking arg.
+func (c *Client) queryFeats(condition string, arg any) ([]*Feat, error) {
 	var feats []*Feat
 
-	rows, err := c.dndTools.Query(`
+	rows, err := c.dndTools.Query(fmt.Sprintf(`
 		SELECT 
+			f.id,
 			f.name,
 			f.description,
 			f.benefit,
@@ -45,10 +61,10 @@ func (c *Client) GetFeatByName(name string) ([]*Feat, error) {
 		LEFT JOIN
 			dnd_featcategory fc ON ffc.featcategory_id = fc.id
 		WHERE 
-			f.name LIKE ?
+			%s
 		GROUP BY 
 			f.id, f.name, f.description, f.benefit, f.special, f.normal, r.name
-	`, "%"+name+"%")
+	`, condition), arg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query feats: %v", err)
 	}
@@ -57,6 +73,7 @@ func (c *Client) GetFeatByName(name string) ([]*Feat, error) {
 	for rows.Next() {
 		var feat Feat
 		if err := rows.Scan(
+			&feat.ID,
 			&feat.Name,
 			&feat.Description,
 			&feat.Benefit,
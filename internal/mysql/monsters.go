@@ -43,10 +43,25 @@ type Monster struct {
 	Reference        *string `db:"reference"`
 }
 
+// GetMonstersByName returns the monsters whose name or alternative name contains name.
 func (c *Client) GetMonstersByName(name string) ([]*Monster, error) {
+	return c.queryMonsters("name LIKE ? OR altname LIKE ?", "%"+name+"%", "%"+name+"%")
+}
+
+// GetMonsterByID returns the monster with the given id, or nil if there is none.
+func (c *Client) GetMonsterByID(id int) (*Monster, error) {
+	monsters, err := c.queryMonsters("id = ?", id)
+	if err != nil || len(monsters) == 0 {
+		return nil, err
+	}
+	return monsters[0], nil
+}
+
+// queryMonsters returns the monsters matching condition, a WHERE clause taking args.
+func (c *Client) queryMonsters(condition string, args ...any) ([]*Monster, error) {
 	var monsters []*Monster
 
-	rows, err := c.srd.Query(`
+	rows, err := c.srd.Query(fmt.Sprintf(`
 		SELECT 
 			id,
 			family,
@@ -85,8 +100,8 @@ func (c *Client) GetMonstersByName(name string) ([]*Monster, error) {
 			full_text,
 			reference
 		FROM monster
-		WHERE name LIKE ? OR altname LIKE ?
-	`, "%"+name+"%", "%"+name+"%")
+		WHERE %s
+	`, condition), args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query monsters: %v", err)
 	}
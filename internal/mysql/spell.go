@@ -47,11 +47,27 @@ type Spell struct {
 	Components  string  `db:"components"`
 }
 
+// GetSpellByName returns the spells whose names contain name.
 func (c *Client) GetSpellByName(name string) ([]*Spell, error) {
+	return c.querySpells("s.name LIKE ?", "%"+name+"%")
+}
+
+// GetSpellByID returns the spell with the given id, or nil if there is none.
+func (c *Client) GetSpellByID(id int) (*Spell, error) {
+	spells, err := c.querySpells("s.id = ?", id)
+	if err != nil || len(spells) == 0 {
+		return nil, err
+	}
+	return spells[0], nil
+}
+
+// querySpells returns the spells matching condition, a WHERE clause taking arg.
+func (c *Client) querySpells(condition string, arg any) ([]*Spell, error) {
 	var spells []*Spell
 
-	rows, err := c.dndTools.Query(`
+	rows, err := c.dndTools.Query(fmt.Sprintf(`
 		SELECT 
+				s.id,
 				s.name,
 				sc.name as school,
 				COALESCE(sb.name, '') as sub_school,
@@ -89,12 +105,12 @@ func (c *Client) GetSpellByName(name string) ([]*Spell, error) {
 		LEFT JOIN
 				dnd_characterclass c ON scl.character_class_id = c.id
 		WHERE 
-				s.name LIKE ?
+				%s
 		GROUP BY 
 				s.id, s.name, sc.name, sb.name, s.description, r.name
 		ORDER BY
 				s.name, r.name
-`, "%"+name+"%")
+`, condition), arg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query spells: %v", err)
 	}
@@ -103,6 +119,7 @@ func (c *Client) GetSpellByName(name string) ([]*Spell, error) {
 	for rows.Next() {
 		var spell Spell
 		if err := rows.Scan(
+			&spell.ID,
 			&spell.Name,
 			&spell.School,
 			&spell.SubSchool,
@@ -0,0 +1,134 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/chathistory"
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+)
+
+const (
+	// replyPrefix starts the lines that reply to the bot, which are addressed
+	// to it even in groups.
+	replyPrefix = "> "
+
+	// notePrefix starts the lines of the output that are not replies of the
+	// bot, so scripts can filter them out.
+	notePrefix = "# "
+)
+
+// Options sets who the REPL sends messages as.
+type Options struct {
+	UserName string
+	UserID   int64
+	// ChatID is the chat the messages are sent to. Like in Telegram, private
+	// chats have positive IDs and groups negative ones.
+	ChatID int64
+}
+
+// REPL sends lines of text to the model as if they were Telegram messages,
+// going through the same chat history, without Telegram.
+type REPL struct {
+	config  *config.Config
+	ai      *googlegenai.Client
+	history *chathistory.History
+	options Options
+}
+
+// New creates a REPL sending messages as described by options.
+func New(config *config.Config, ai *googlegenai.Client, history *chathistory.History, options Options) *REPL {
+	return &REPL{
+		config:  config,
+		ai:      ai,
+		history: history,
+		options: options,
+	}
+}
+
+// Run sends every line read from in until it ends or ctx is done, writing the
+// replies to out. Lines starting with "> " reply to the bot.
+func (r *REPL) Run(ctx context.Context, in io.Reader, out io.Writer) error {
+	lines := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		errCh <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-lines:
+			if !ok {
+				return <-errCh
+			}
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			fmt.Fprintln(out, r.Send(ctx, line))
+		}
+	}
+}
+
+// Send handles a line like the Telegram bot handles a message, returning the
+// reply of the bot, or a note when there is none.
+func (r *REPL) Send(ctx context.Context, line string) string {
+	text, replyToBot := strings.CutPrefix(line, replyPrefix)
+	chatID := r.options.ChatID
+	msg := &chathistory.Message{
+		UserID:    r.options.UserID,
+		UserName:  r.options.UserName,
+		Text:      text,
+		Timestamp: time.Now(),
+	}
+	ctx = auth.WithIdentity(ctx, auth.Identity{
+		ChatID:   chatID,
+		UserID:   msg.UserID,
+		UserName: msg.UserName,
+		Role:     auth.RoleOf(r.config, chatID, msg.UserID),
+	})
+
+	prompt, addressed := r.history.Prompt(chatID, msg, chatID > 0, replyToBot)
+	if !addressed {
+		return notePrefix + "kept in the chat history, mention " + r.config.BotName + " to get a reply"
+	}
+
+	ctx, candidates := googlegenai.WithCandidates(ctx)
+	response, err := r.ai.SendMessage(ctx, chatID, prompt)
+	if err != nil {
+		fmt.Printf("Failed to send message: %v\n", err)
+		response = "Sorry, something went wrong."
+	}
+
+	// There are no buttons here, so list what the bot would have offered.
+	var notes []string
+	if offered := candidates.Take(); len(offered) > 0 {
+		var labels []string
+		for _, candidate := range offered {
+			labels = append(labels, candidate.Label())
+		}
+		notes = append(notes, notePrefix+"offered buttons for: "+strings.Join(labels, ", "))
+	}
+	for _, name := range r.ai.TakeDeletions(chatID) {
+		notes = append(notes, notePrefix+"asked to confirm deleting "+name)
+	}
+	return strings.Join(append([]string{response}, notes...), "\n")
+}
@@ -0,0 +1,115 @@
+package repl_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gtrindade/ultra-kiew/internal/chathistory"
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+	"github.com/gtrindade/ultra-kiew/internal/repl"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+)
+
+const (
+	groupID   = -100
+	privateID = 1
+)
+
+// newTestREPL creates a REPL talking to provider as alice, the owner of the
+// bot, keeping its state in a temporary directory.
+func newTestREPL(t *testing.T, provider googlegenai.Provider, chatID int64) *repl.REPL {
+	t.Helper()
+	storageClient := storage.NewClient(storage.NewFileStore(t.TempDir()))
+	t.Cleanup(func() {
+		if err := storageClient.Close(); err != nil {
+			t.Errorf("failed to close storage: %v", err)
+		}
+	})
+
+	cfg := &config.Config{BotName: "kiew", Roles: &config.RolesConfig{Owners: []int64{1}}}
+	registry := tools.NewRegistry()
+	ai, err := googlegenai.NewClient(context.Background(), provider, registry, tools.NewSettings(registry, storageClient), storageClient, nil, cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	history, err := chathistory.New(storageClient, cfg.BotName)
+	if err != nil {
+		t.Fatalf("chathistory.New() error = %v", err)
+	}
+	return repl.New(cfg, ai, history, repl.Options{UserName: "alice", UserID: 1, ChatID: chatID})
+}
+
+func TestSendInGroup(t *testing.T) {
+	ctx := context.Background()
+	provider := googlegenai.NewFakeProvider()
+	r := newTestREPL(t, provider, groupID)
+
+	// Lines that don't address the bot are only kept, like in a Telegram group.
+	if got := r.Send(ctx, "the goblins attack"); !strings.HasPrefix(got, "# kept in the chat history") {
+		t.Errorf("Send() of a message to the group = %q, want a note", got)
+	}
+	if len(provider.Sent()) != 0 {
+		t.Fatalf("sent %d turns to the model, want none", len(provider.Sent()))
+	}
+
+	for _, line := range []string{"kiew, what attacks?", "> and now?"} {
+		got := r.Send(ctx, line)
+		if strings.HasPrefix(got, "#") {
+			t.Errorf("Send(%q) = %q, want a reply", line, got)
+		}
+	}
+
+	sent := provider.Sent()
+	if len(sent) != 2 {
+		t.Fatalf("sent %d turns to the model, want 2", len(sent))
+	}
+	// The first prompt carries the message kept before it.
+	first := sent[0][0].Text
+	if !strings.Contains(first, "the goblins attack") || !strings.Contains(first, "kiew, what attacks?") {
+		t.Errorf("first prompt = %q, want the kept message and the question", first)
+	}
+	second := sent[1][0].Text
+	if strings.Contains(second, "the goblins attack") || !strings.Contains(second, "and now?") || strings.Contains(second, "> ") {
+		t.Errorf("second prompt = %q, want only the reply, without its prefix", second)
+	}
+}
+
+func TestSendNotesDeletions(t *testing.T) {
+	ctx := context.Background()
+	provider := googlegenai.NewFakeProvider(
+		googlegenai.FakeFunctionCall("chat_data", map[string]any{"action": "set", "path": "bob.hp", "value": "12"}),
+		googlegenai.FakeText("Bob has 12 hit points."),
+		googlegenai.FakeFunctionCall("chat_data", map[string]any{"action": "delete", "path": "bob"}),
+		googlegenai.FakeText("Please confirm."),
+	)
+	r := newTestREPL(t, provider, privateID)
+
+	if got := r.Send(ctx, "bob has 12 hp"); got != "Bob has 12 hit points." {
+		t.Errorf("Send() = %q, want the reply", got)
+	}
+	// There are no buttons, so the confirmation the bot asks for is noted.
+	want := "Please confirm.\n# asked to confirm deleting bob"
+	if got := r.Send(ctx, "delete bob"); got != want {
+		t.Errorf("Send() = %q, want %q", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	provider := googlegenai.NewFakeProvider(googlegenai.FakeText("Hello, alice."), googlegenai.FakeText("Rolling."))
+	r := newTestREPL(t, provider, privateID)
+
+	var out bytes.Buffer
+	if err := r.Run(context.Background(), strings.NewReader("hello\n\n   \nroll for me\n"), &out); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got, want := out.String(), "Hello, alice.\nRolling.\n"; got != want {
+		t.Errorf("Run() wrote %q, want %q", got, want)
+	}
+	if len(provider.Sent()) != 2 {
+		t.Errorf("sent %d turns to the model, want one per non-blank line", len(provider.Sent()))
+	}
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// valuesBucket holds the values put by key.
+	valuesBucket = []byte("values")
+
+	// linesBucket holds one nested bucket per key with the lines appended to
+	// it, keyed by their sequence number.
+	linesBucket = []byte("lines")
+)
+
+// BoltStore keeps every value in a single bbolt database file, so changing
+// one value never rewrites the others.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens the bbolt database at path, creating it if needed.
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	err = db.Update(func(btx *bolt.Tx) error {
+		for _, name := range [][]byte{valuesBucket, linesBucket} {
+			if _, err := btx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets in %s: %w", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Get returns the value of key. The lines appended to a key are returned
+// joined by newlines, as they would be in a file.
+func (s *BoltStore) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(btx *bolt.Tx) error {
+		var err error
+		value, err = (&boltTx{btx}).Get(key)
+		return err
+	})
+	return value, err
+}
+
+// Put sets the value of key.
+func (s *BoltStore) Put(key string, value []byte) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Put(key, value)
+	})
+}
+
+// Delete removes the value or the lines of key.
+func (s *BoltStore) Delete(key string) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Delete(key)
+	})
+}
+
+// List returns the keys starting with prefix, including those with lines.
+func (s *BoltStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := s.db.View(func(btx *bolt.Tx) error {
+		var err error
+		keys, err = (&boltTx{btx}).List(prefix)
+		return err
+	})
+	return keys, err
+}
+
+// Update runs fn in a bbolt transaction, which is rolled back if fn fails.
+func (s *BoltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(btx *bolt.Tx) error {
+		return fn(&boltTx{btx})
+	})
+}
+
+// Append adds a line to the lines of key.
+func (s *BoltStore) Append(key string, line []byte) error {
+	return s.Update(func(tx Tx) error {
+		return tx.Append(key, line)
+	})
+}
+
+// Lines calls fn with every line appended to key, in order.
+func (s *BoltStore) Lines(key string, fn func(line []byte) error) error {
+	return s.db.View(func(btx *bolt.Tx) error {
+		lines := btx.Bucket(linesBucket).Bucket([]byte(key))
+		if lines == nil {
+			return nil
+		}
+		return lines.ForEach(func(_, line []byte) error {
+			if err := fn(line); err != nil {
+				return fmt.Errorf("failed to decode line of %s: %w", key, err)
+			}
+			return nil
+		})
+	})
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// boltTx implements Tx on a bbolt transaction.
+type boltTx struct {
+	btx *bolt.Tx
+}
+
+func (tx *boltTx) Get(key string) ([]byte, error) {
+	if value := tx.btx.Bucket(valuesBucket).Get([]byte(key)); value != nil {
+		return bytes.Clone(value), nil
+	}
+
+	lines := tx.btx.Bucket(linesBucket).Bucket([]byte(key))
+	if lines == nil {
+		return nil, fmt.Errorf("key %s: %w", key, ErrNotFound)
+	}
+	var value []byte
+	err := lines.ForEach(func(_, line []byte) error {
+		value = append(append(value, line...), '\n')
+		return nil
+	})
+	return value, err
+}
+
+func (tx *boltTx) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	if err := tx.deleteLines(key); err != nil {
+		return err
+	}
+	if err := tx.btx.Bucket(valuesBucket).Put([]byte(key), value); err != nil {
+		return fmt.Errorf("failed to put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (tx *boltTx) Delete(key string) error {
+	values := tx.btx.Bucket(valuesBucket)
+	hadLines := tx.btx.Bucket(linesBucket).Bucket([]byte(key)) != nil
+	if values.Get([]byte(key)) == nil && !hadLines {
+		return fmt.Errorf("key %s: %w", key, ErrNotFound)
+	}
+	if err := tx.deleteLines(key); err != nil {
+		return err
+	}
+	if err := values.Delete([]byte(key)); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func (tx *boltTx) List(prefix string) ([]string, error) {
+	var keys []string
+	for _, name := range [][]byte{valuesBucket, linesBucket} {
+		cursor := tx.btx.Bucket(name).Cursor()
+		for key, _ := cursor.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, _ = cursor.Next() {
+			keys = append(keys, string(key))
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+func (tx *boltTx) Append(key string, line []byte) error {
+	lines, err := tx.btx.Bucket(linesBucket).CreateBucketIfNotExists([]byte(key))
+	if err == nil {
+		var sequence uint64
+		sequence, err = lines.NextSequence()
+		if err == nil {
+			err = lines.Put(binary.BigEndian.AppendUint64(nil, sequence), line)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append to %s: %w", key, err)
+	}
+	return nil
+}
+
+func (tx *boltTx) deleteLines(key string) error {
+	lines := tx.btx.Bucket(linesBucket)
+	if lines.Bucket([]byte(key)) == nil {
+		return nil
+	}
+	if err := lines.DeleteBucket([]byte(key)); err != nil {
+		return fmt.Errorf("failed to delete lines of %s: %w", key, err)
+	}
+	return nil
+}
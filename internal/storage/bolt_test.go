@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func openTestBolt(t *testing.T, path string) *BoltStore {
+	t.Helper()
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	return store
+}
+
+func lines(t *testing.T, store Store, key string) []string {
+	t.Helper()
+	var got []string
+	err := store.Lines(key, func(line []byte) error {
+		got = append(got, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Lines(%q) error = %v", key, err)
+	}
+	return got
+}
+
+func TestBoltStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := openTestBolt(t, path)
+
+	// More than ten lines, so they would come out of order if their keys
+	// sorted as text.
+	var want []string
+	for i := range 12 {
+		line := fmt.Sprintf(`{"n":%d}`, i)
+		want = append(want, line)
+		if err := store.Append("db/rolls-1.jsonl", []byte(line)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	for key, value := range map[string]string{"db/b.json": "b", "db/a.json": "a", "other/c.json": "c"} {
+		if err := store.Put(key, []byte(value)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	store = openTestBolt(t, path)
+	defer store.Close()
+
+	if got := lines(t, store, "db/rolls-1.jsonl"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %v, want %v", got, want)
+	}
+	if got := get(t, store, "db/rolls-1.jsonl"); got != strings.Join(want, "\n")+"\n" {
+		t.Errorf("Get() of appended lines = %q, want them joined by newlines", got)
+	}
+	if got := lines(t, store, "db/none.jsonl"); len(got) != 0 {
+		t.Errorf("Lines() of a missing key = %v, want none", got)
+	}
+	if got := get(t, store, "db/a.json"); got != "a" {
+		t.Errorf("Get() = %q, want %q", got, "a")
+	}
+
+	keys, err := store.List("db/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := []string{"db/a.json", "db/b.json", "db/rolls-1.jsonl"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+
+	// Putting a value replaces the lines, and deleting removes both.
+	if err := store.Put("db/rolls-1.jsonl", []byte("reset")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got := get(t, store, "db/rolls-1.jsonl"); got != "reset" {
+		t.Errorf("Get() after Put() = %q, want %q", got, "reset")
+	}
+	if err := store.Delete("db/rolls-1.jsonl"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete("db/rolls-1.jsonl"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() of a missing key error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestBoltStoreUpdateFailureChangesNothing(t *testing.T) {
+	store := openTestBolt(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+	if err := store.Put("db/a.json", []byte("a")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	err := store.Update(func(tx Tx) error {
+		tx.Put("db/a.json", []byte("a2"))
+		tx.Append("db/log.jsonl", []byte("line"))
+		return errors.New("boom")
+	})
+	if err == nil {
+		t.Fatalf("Update() succeeded, want an error")
+	}
+
+	if got := get(t, store, "db/a.json"); got != "a" {
+		t.Errorf("db/a.json = %q, want %q", got, "a")
+	}
+	if got := get(t, store, "db/log.jsonl"); got != "<none>" {
+		t.Errorf("db/log.jsonl = %q, want nothing", got)
+	}
+}
+
+func TestImportFilesIntoBolt(t *testing.T) {
+	files := NewFileStore(t.TempDir())
+	if err := files.Put("db/chat-data-1.json", []byte(`{"version":2}`)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	for _, line := range []string{"first", "second"} {
+		if err := files.Append("db/rolls-1.jsonl", []byte(line)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	store := openTestBolt(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+	count, err := Import(store, files, DBPath+"/")
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Import() copied %d keys, want 2", count)
+	}
+
+	if got := get(t, store, "db/chat-data-1.json"); got != `{"version":2}` {
+		t.Errorf("chat data = %q, want it copied", got)
+	}
+	if got := lines(t, store, "db/rolls-1.jsonl"); !reflect.DeepEqual(got, []string{"first", "second"}) {
+		t.Errorf("roll log = %v, want its lines copied in order", got)
+	}
+}
@@ -1,11 +1,14 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -20,80 +23,229 @@ const (
 
 	// ChatHistoryFileName is the filename for chat history.
 	ChatHistoryFileName = "chat_history.json"
+
+	// SaveDelay is how long SaveAsync waits before writing a file, coalescing
+	// the saves made meanwhile.
+	SaveDelay = 2 * time.Second
 )
 
-// Client provides a simple file-based storage system.
+// Client saves and loads JSON data in a Store, by file name.
 type Client struct {
-	sync.RWMutex
+	store Store
+
+	// pendingLock guards pending, timers and writers.
+	pendingLock sync.Mutex
+	// pending holds the latest snapshot passed to SaveAsync for each file
+	// that was not written yet.
+	pending map[string]any
+	timers  map[string]*time.Timer
+	// writers serialize the flushes of each file, so snapshots are written in
+	// the order they were saved.
+	writers map[string]*sync.Mutex
 }
 
-// NewClient creates a new Client instance with the specified base path.
-func NewClient() *Client {
-	return &Client{}
+// NewClient creates a new Client keeping its data in store.
+func NewClient(store Store) *Client {
+	return &Client{
+		store:   store,
+		pending: make(map[string]any),
+		timers:  make(map[string]*time.Timer),
+		writers: make(map[string]*sync.Mutex),
+	}
 }
 
-// Save saves the given data to a file with the specified name.
+// Store returns the store the client keeps its data in.
+func (s *Client) Store() Store {
+	return s.store
+}
+
+// Save saves the given data to a file with the specified name, replacing any
+// snapshot of it still pending from SaveAsync.
 func (s *Client) Save(name string, data any) error {
-	s.Lock()
-	defer s.Unlock()
+	writer := s.writer(name)
+	writer.Lock()
+	defer writer.Unlock()
 
-	filePath := filepath.Join(BasePath, name)
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", filePath, err)
-	}
-	defer file.Close()
+	s.takePending(name)
+	return s.write(name, data)
+}
 
-	encoder := json.NewEncoder(file)
+// write encodes data and puts it in the store under the specified name.
+func (s *Client) write(name string, data any) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
 	if err := encoder.Encode(data); err != nil {
 		return fmt.Errorf("failed to encode data to JSON: %w", err)
 	}
+	if err := s.store.Put(name, buffer.Bytes()); err != nil {
+		return err
+	}
 
-	fmt.Printf("Data saved to file %s successfully\n", filePath)
+	fmt.Printf("Data saved to file %s successfully\n", name)
 
 	return nil
 }
+
+// SaveAsync saves data to a file after SaveDelay, coalescing the saves of the
+// same file made meanwhile so only the latest snapshot is written. data must
+// not be modified afterwards.
 func (s *Client) SaveAsync(name string, data any) {
-	go func() {
-		if err := s.Save(name, data); err != nil {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	s.pending[name] = data
+	if _, scheduled := s.timers[name]; scheduled {
+		return
+	}
+	s.timers[name] = time.AfterFunc(SaveDelay, func() {
+		if err := s.flush(name); err != nil {
 			fmt.Printf("error saving file %s: %v\n", name, err)
 		}
-	}()
+	})
+}
+
+// flush writes the pending snapshot of a file, if any.
+func (s *Client) flush(name string) error {
+	writer := s.writer(name)
+	writer.Lock()
+	defer writer.Unlock()
+
+	data, exists := s.takePending(name)
+	if !exists {
+		return nil
+	}
+	return s.write(name, data)
+}
+
+// takePending removes and returns the pending snapshot of a file, cancelling
+// its scheduled write.
+func (s *Client) takePending(name string) (any, bool) {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	data, exists := s.pending[name]
+	delete(s.pending, name)
+	if timer, scheduled := s.timers[name]; scheduled {
+		timer.Stop()
+		delete(s.timers, name)
+	}
+	return data, exists
+}
+
+// writer returns the lock serializing the flushes of a file.
+func (s *Client) writer(name string) *sync.Mutex {
+	s.pendingLock.Lock()
+	defer s.pendingLock.Unlock()
+
+	writer, exists := s.writers[name]
+	if !exists {
+		writer = &sync.Mutex{}
+		s.writers[name] = writer
+	}
+	return writer
+}
+
+// Flush writes every pending snapshot right away. Call it before exiting so
+// no save is lost.
+func (s *Client) Flush() error {
+	s.pendingLock.Lock()
+	names := make([]string, 0, len(s.pending))
+	for name := range s.pending {
+		names = append(names, name)
+	}
+	s.pendingLock.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		if err := s.flush(name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save file %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// Load loads data from a file with the specified name into the provided data structure.
+// Load loads data from a file with the specified name into the provided data
+// structure, writing its pending snapshot first.
 func (s *Client) Load(name string, data any) error {
-	s.RLock()
-	defer s.RUnlock()
+	if err := s.flush(name); err != nil {
+		return err
+	}
 
-	filePath := filepath.Join(BasePath, name)
-	file, err := os.Open(filePath)
+	value, err := s.store.Get(name)
 	if err != nil {
-		if os.IsNotExist(err) {
-			fmt.Printf("file %s does not exist when trying to load it\n", filePath)
+		if errors.Is(err, ErrNotFound) {
+			fmt.Printf("file %s does not exist when trying to load it\n", name)
 			return nil
 		}
-		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+		return err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(data); err != nil {
+	if err := json.Unmarshal(value, data); err != nil {
 		return fmt.Errorf("failed to decode JSON data: %w", err)
 	}
 
-	fmt.Printf("Data loaded from file %s successfully\n", filePath)
+	fmt.Printf("Data loaded from file %s successfully\n", name)
 	return nil
 }
 
+// Append adds record as a single JSON line at the end of the file with the
+// specified name, creating it if needed. Existing lines are never rewritten.
+func (s *Client) Append(name string, record any) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode data to JSON: %w", err)
+	}
+	return s.store.Append(name, line)
+}
+
+// LoadLines calls decode with every JSON line of a file written by Append, in
+// order. A missing file has no lines.
+func (s *Client) LoadLines(name string, decode func(line []byte) error) error {
+	return s.store.Lines(name, decode)
+}
+
 // LoadFromDB loads data from a file in the predefined database path.
 func (c *Client) LoadFromDB(name string, data any) error {
-	return c.Load(filepath.Join(DBPath, name), data)
+	return c.Load(path.Join(DBPath, name), data)
+}
+
+// SaveToDB saves data to a file in the predefined database path.
+func (c *Client) SaveToDB(name string, data any) error {
+	return c.Save(path.Join(DBPath, name), data)
 }
 
 // SaveToDBAsync saves data to a file in the predefined database path asynchronously.
 func (c *Client) SaveToDBAsync(name string, data any) {
-	c.SaveAsync(filepath.Join(DBPath, name), data)
+	c.SaveAsync(path.Join(DBPath, name), data)
+}
+
+// AppendToDB appends a record to a file in the predefined database path.
+func (c *Client) AppendToDB(name string, record any) error {
+	return c.Append(path.Join(DBPath, name), record)
+}
+
+// LoadLinesFromDB reads the records of a file in the predefined database path.
+func (c *Client) LoadLinesFromDB(name string, decode func(line []byte) error) error {
+	return c.LoadLines(path.Join(DBPath, name), decode)
+}
+
+// DeleteFromDB removes a file from the predefined database path.
+func (c *Client) DeleteFromDB(name string) error {
+	return c.Delete(path.Join(DBPath, name))
+}
+
+// ListDB returns the names of the files in the predefined database path that
+// start with prefix, sorted.
+func (c *Client) ListDB(prefix string) ([]string, error) {
+	keys, err := c.store.List(DBPath + "/" + prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = strings.TrimPrefix(key, DBPath+"/")
+	}
+	return names, nil
 }
 
 // SaveChatHistoryAsync saves chat history to the predefined chat history file asynchronously.
@@ -106,15 +258,17 @@ func (c *Client) LoadChatHistory(data any) error {
 	return c.LoadFromDB(ChatHistoryFileName, data)
 }
 
-// Delete removes the file with the specified name.
+// Delete removes the file with the specified name, dropping its pending snapshot.
 func (s *Client) Delete(name string) error {
-	s.Lock()
-	defer s.Unlock()
+	writer := s.writer(name)
+	writer.Lock()
+	defer writer.Unlock()
 
-	filePath := filepath.Join(BasePath, name)
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to delete file %s: %w", filePath, err)
-	}
+	s.takePending(name)
+	return s.store.Delete(name)
+}
 
-	return nil
+// Close writes every pending snapshot and closes the store.
+func (s *Client) Close() error {
+	return errors.Join(s.Flush(), s.store.Close())
 }
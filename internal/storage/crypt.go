@@ -0,0 +1,305 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// encryptedMarker starts every encrypted line, followed by the base64
+	// nonce and ciphertext. Values are encrypted as a single line.
+	encryptedMarker = "enc1:"
+
+	// KeySize is the size in bytes of the keys made by GenerateKey.
+	KeySize = 32
+
+	// RotatedKey is set by Rotate once every value is encrypted. From then on
+	// values that are not encrypted are rejected, since only someone without
+	// the key could have written them.
+	RotatedKey = "encryption-rotated.json"
+)
+
+var (
+	// ErrDecrypt is returned when data can't be decrypted with any of the keys.
+	ErrDecrypt = errors.New("failed to decrypt data, is the encryption key right?")
+
+	// ErrNotEncrypted is returned when reading data that is not encrypted from
+	// a store that Rotate encrypted entirely.
+	ErrNotEncrypted = errors.New("found data that is not encrypted in a store where everything was encrypted by rotate-key")
+)
+
+// Cipher encrypts data with AES-GCM using the current key, and decrypts data
+// encrypted with it or with any of the old keys.
+type Cipher struct {
+	current cipher.AEAD
+	keys    []cipher.AEAD
+}
+
+// NewCipher creates a Cipher from base64 AES keys of 16, 24 or 32 bytes.
+func NewCipher(key string, oldKeys []string) (*Cipher, error) {
+	c := &Cipher{}
+	for i, encoded := range append([]string{key}, oldKeys...) {
+		aead, err := newAEAD(encoded)
+		if err != nil {
+			if i == 0 {
+				return nil, fmt.Errorf("invalid encryption key: %w", err)
+			}
+			return nil, fmt.Errorf("invalid old encryption key #%d: %w", i, err)
+		}
+		c.keys = append(c.keys, aead)
+	}
+	c.current = c.keys[0]
+	return c, nil
+}
+
+func newAEAD(encoded string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("the key must be base64: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateKey returns a random base64 key for NewCipher.
+func GenerateKey() string {
+	return base64.StdEncoding.EncodeToString(randomBytes(KeySize))
+}
+
+func randomBytes(size int) []byte {
+	data := make([]byte, size)
+	// crypto/rand never fails on the supported platforms.
+	if _, err := rand.Read(data); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	return data
+}
+
+// Seal encrypts data with the current key, returning the nonce followed by
+// the ciphertext.
+func (c *Cipher) Seal(data []byte) []byte {
+	nonce := randomBytes(c.current.NonceSize())
+	return c.current.Seal(nonce, nonce, data, nil)
+}
+
+// Open decrypts data made by Seal with any of the keys.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	for _, aead := range c.keys {
+		if len(data) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, ErrDecrypt
+}
+
+// encryptLine encrypts data into a single line of text.
+func (c *Cipher) encryptLine(data []byte) []byte {
+	return []byte(encryptedMarker + base64.StdEncoding.EncodeToString(c.Seal(data)))
+}
+
+// decryptLine decrypts a line made by encryptLine. Lines that are not
+// encrypted, like those written before encryption was enabled, are returned
+// as they are, unless strict is set.
+func (c *Cipher) decryptLine(line []byte, strict bool) ([]byte, error) {
+	encoded, encrypted := bytes.CutPrefix(line, []byte(encryptedMarker))
+	if !encrypted {
+		if strict && len(line) > 0 {
+			return nil, ErrNotEncrypted
+		}
+		return line, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted line: %w", err)
+	}
+	return c.Open(data)
+}
+
+// decrypt decrypts every line of a value.
+func (c *Cipher) decrypt(value []byte, strict bool) ([]byte, error) {
+	lines := bytes.Split(value, []byte("\n"))
+	for i, line := range lines {
+		var err error
+		if lines[i], err = c.decryptLine(line, strict); err != nil {
+			return nil, err
+		}
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// EncryptedStore encrypts the values and lines kept in another store.
+// Values written before encryption was enabled are still read as they are,
+// until Rotate encrypts them. After that, reading a value that is not
+// encrypted fails with ErrNotEncrypted.
+type EncryptedStore struct {
+	store  Store
+	cipher *Cipher
+	// strict is set once Rotate encrypted every value.
+	strict bool
+}
+
+// NewEncryptedStore wraps store, encrypting everything written to it with c.
+func NewEncryptedStore(store Store, c *Cipher) *EncryptedStore {
+	s := &EncryptedStore{store: store, cipher: c}
+	_, err := store.Get(RotatedKey)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		fmt.Printf("Failed to check whether every value is encrypted, accepting values that are not: %v\n", err)
+	}
+	s.strict = err == nil
+	return s
+}
+
+func (s *EncryptedStore) tx(tx Tx) *encryptedTx {
+	return &encryptedTx{tx: tx, cipher: s.cipher, strict: s.strict}
+}
+
+// Get returns the decrypted value of key.
+func (s *EncryptedStore) Get(key string) ([]byte, error) {
+	return s.tx(s.store).Get(key)
+}
+
+// Put encrypts value and sets it as the value of key.
+func (s *EncryptedStore) Put(key string, value []byte) error {
+	return s.tx(s.store).Put(key, value)
+}
+
+// Delete removes the value of key.
+func (s *EncryptedStore) Delete(key string) error {
+	return s.store.Delete(key)
+}
+
+// List returns the keys starting with prefix.
+func (s *EncryptedStore) List(prefix string) ([]string, error) {
+	return s.store.List(prefix)
+}
+
+// Append encrypts line and adds it to the lines of key.
+func (s *EncryptedStore) Append(key string, line []byte) error {
+	return s.store.Append(key, s.cipher.encryptLine(line))
+}
+
+// Update runs fn in a transaction of the wrapped store, encrypting what it
+// writes.
+func (s *EncryptedStore) Update(fn func(tx Tx) error) error {
+	return s.store.Update(func(tx Tx) error {
+		return fn(s.tx(tx))
+	})
+}
+
+// Lines calls fn with every decrypted line of key.
+func (s *EncryptedStore) Lines(key string, fn func(line []byte) error) error {
+	return s.store.Lines(key, func(line []byte) error {
+		plaintext, err := s.cipher.decryptLine(line, s.strict)
+		if err != nil {
+			return fmt.Errorf("failed to read line of %s: %w", key, err)
+		}
+		return fn(plaintext)
+	})
+}
+
+// Close closes the wrapped store.
+func (s *EncryptedStore) Close() error {
+	return s.store.Close()
+}
+
+// Rotate encrypts every value and line under prefix again with the current
+// key, including those written before encryption was enabled, so the old keys
+// can be dropped. Keys ending in ".jsonl" hold lines. It then sets RotatedKey,
+// so values that are not encrypted are rejected from then on. It returns how
+// many keys were encrypted.
+func (s *EncryptedStore) Rotate(prefix string) (int, error) {
+	var count int
+	err := s.Update(func(tx Tx) error {
+		keys, err := tx.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, err := tx.Get(key)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", key, err)
+			}
+			if !strings.HasSuffix(key, ".jsonl") {
+				if err := tx.Put(key, value); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Delete(key); err != nil {
+				return err
+			}
+			for _, line := range bytes.Split(value, []byte("\n")) {
+				if len(line) == 0 {
+					continue
+				}
+				if err := tx.Append(key, line); err != nil {
+					return err
+				}
+			}
+		}
+		count = len(keys)
+		return tx.Put(RotatedKey, []byte(time.Now().UTC().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.strict = true
+	return count, nil
+}
+
+// encryptedTx encrypts the writes of a transaction of the wrapped store.
+type encryptedTx struct {
+	tx     Tx
+	cipher *Cipher
+	strict bool
+}
+
+func (tx *encryptedTx) Get(key string) ([]byte, error) {
+	value, err := tx.tx.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := tx.cipher.decrypt(value, tx.strict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return plaintext, nil
+}
+
+func (tx *encryptedTx) Put(key string, value []byte) error {
+	return tx.tx.Put(key, tx.cipher.encryptLine(value))
+}
+
+func (tx *encryptedTx) Delete(key string) error {
+	return tx.tx.Delete(key)
+}
+
+func (tx *encryptedTx) List(prefix string) ([]string, error) {
+	return tx.tx.List(prefix)
+}
+
+func (tx *encryptedTx) Append(key string, line []byte) error {
+	return tx.tx.Append(key, tx.cipher.encryptLine(line))
+}
+
+// CipherOf returns the cipher of an encrypted store, or nil.
+func CipherOf(store Store) *Cipher {
+	if encrypted, ok := store.(*EncryptedStore); ok {
+		return encrypted.cipher
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedStoreRejectsPlaintextAfterRotate(t *testing.T) {
+	files := NewFileStore(t.TempDir())
+	if err := files.Put("db/old.json", []byte(`{"old":true}`)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := files.Append("db/log.jsonl", []byte(`{"line":1}`)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	crypt, err := NewCipher(GenerateKey(), nil)
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	store := NewEncryptedStore(files, crypt)
+	if value, err := store.Get("db/old.json"); err != nil || string(value) != `{"old":true}` {
+		t.Fatalf("Get() before rotating = %q, %v, want the plaintext value", value, err)
+	}
+
+	if _, err := store.Rotate("db/"); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if value, err := store.Get("db/old.json"); err != nil || string(value) != `{"old":true}` {
+		t.Fatalf("Get() after rotating = %q, %v, want the decrypted value", value, err)
+	}
+	var lines []string
+	err = store.Lines("db/log.jsonl", func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil || len(lines) != 1 || lines[0] != `{"line":1}` {
+		t.Fatalf("Lines() after rotating = %v, %v, want the decrypted line", lines, err)
+	}
+
+	// Plaintext written behind the store's back, after everything was encrypted.
+	if err := files.Put("db/injected.json", []byte(`{"injected":true}`)); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := files.Append("db/log.jsonl", []byte(`{"line":2}`)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	// A store opened later knows everything was encrypted too.
+	for name, s := range map[string]*EncryptedStore{"rotated": store, "reopened": NewEncryptedStore(files, crypt)} {
+		if _, err := s.Get("db/injected.json"); !errors.Is(err, ErrNotEncrypted) {
+			t.Errorf("%s Get() of plaintext error = %v, want ErrNotEncrypted", name, err)
+		}
+		err := s.Lines("db/log.jsonl", func(line []byte) error { return nil })
+		if !errors.Is(err, ErrNotEncrypted) {
+			t.Errorf("%s Lines() with a plaintext line error = %v, want ErrNotEncrypted", name, err)
+		}
+	}
+}
+
+func TestEncryptedStoreRotatesKeys(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) Store{
+		"file": func(t *testing.T) Store { return NewFileStore(t.TempDir()) },
+		"bolt": func(t *testing.T) Store { return openTestBolt(t, filepath.Join(t.TempDir(), "state.db")) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			raw := open(t)
+			defer raw.Close()
+			oldKey, newKey := GenerateKey(), GenerateKey()
+			oldCipher, err := NewCipher(oldKey, nil)
+			if err != nil {
+				t.Fatalf("NewCipher() error = %v", err)
+			}
+
+			store := NewEncryptedStore(raw, oldCipher)
+			if err := store.Put("db/sheet.json", []byte(`{"hp":12}`)); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+			for _, line := range []string{`{"n":1}`, `{"n":2}`} {
+				if err := store.Append("db/rolls.jsonl", []byte(line)); err != nil {
+					t.Fatalf("Append() error = %v", err)
+				}
+			}
+			if got := get(t, raw, "db/sheet.json"); strings.Contains(got, `"hp"`) {
+				t.Errorf("stored value = %q, want it encrypted", got)
+			}
+			if got := get(t, raw, "db/rolls.jsonl"); strings.Contains(got, `"n"`) || !strings.HasPrefix(got, encryptedMarker) {
+				t.Errorf("stored lines = %q, want them encrypted", got)
+			}
+
+			// The new key reads what the old one wrote until the data is rotated.
+			rotating, err := NewCipher(newKey, []string{oldKey})
+			if err != nil {
+				t.Fatalf("NewCipher() error = %v", err)
+			}
+			store = NewEncryptedStore(raw, rotating)
+			if count, err := store.Rotate("db/"); err != nil || count != 2 {
+				t.Fatalf("Rotate() = %d, %v, want 2 keys", count, err)
+			}
+
+			newCipher, err := NewCipher(newKey, nil)
+			if err != nil {
+				t.Fatalf("NewCipher() error = %v", err)
+			}
+			store = NewEncryptedStore(raw, newCipher)
+			if got := get(t, store, "db/sheet.json"); got != `{"hp":12}` {
+				t.Errorf("Get() with the new key = %q, want the value", got)
+			}
+			if got := lines(t, store, "db/rolls.jsonl"); strings.Join(got, " ") != `{"n":1} {"n":2}` {
+				t.Errorf("Lines() with the new key = %v, want both lines in order", got)
+			}
+
+			if _, err := NewEncryptedStore(raw, oldCipher).Get("db/sheet.json"); !errors.Is(err, ErrDecrypt) {
+				t.Errorf("Get() with the old key after rotating error = %v, want ErrDecrypt", err)
+			}
+		})
+	}
+}
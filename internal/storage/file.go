@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// tempFileMarker is appended to the name of a file, followed by a random
+	// suffix, while it is rewritten.
+	tempFileMarker = ".tmp-"
+)
+
+// FileStore keeps every value in its own file under a directory, with keys
+// as paths relative to it.
+type FileStore struct {
+	dir  string
+	lock sync.RWMutex
+}
+
+// NewFileStore creates a store of the files under dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Get returns the content of the file of key.
+func (s *FileStore) Get(key string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.get(key)
+}
+
+// Put replaces the file of key.
+func (s *FileStore) Put(key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.put(key, value)
+}
+
+// Delete removes the file of key.
+func (s *FileStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.delete(key)
+}
+
+// List returns the keys of the files whose path starts with prefix.
+func (s *FileStore) List(prefix string) ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.list(prefix)
+}
+
+// Update runs fn holding the store, then writes the files it changed in two
+// steps: every new value is first written to a temporary file, and only then
+// are they swapped in, putting the old files back if a swap fails. A failure
+// leaves every file as it was; only a crash while swapping can leave some of
+// them changed, with the old ones kept next to them under a ".tmp-" name.
+func (s *FileStore) Update(fn func(tx Tx) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx := &fileTx{store: s, writes: make(map[string][]byte)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	staged := make(map[string]string)
+	defer func() {
+		for _, tempPath := range staged {
+			os.Remove(tempPath)
+		}
+	}()
+	for _, key := range tx.order {
+		if value := tx.writes[key]; value != nil {
+			tempPath, err := s.stage(key, value)
+			if err != nil {
+				return err
+			}
+			staged[key] = tempPath
+		}
+	}
+
+	var swaps []*swap
+	for _, key := range tx.order {
+		sw, err := s.swap(key, staged[key])
+		if err != nil {
+			for i := len(swaps) - 1; i >= 0; i-- {
+				if undoErr := swaps[i].undo(); undoErr != nil {
+					fmt.Printf("Failed to restore %s: %v\n", swaps[i].path, undoErr)
+				}
+			}
+			return err
+		}
+		delete(staged, key)
+		swaps = append(swaps, sw)
+	}
+	for _, sw := range swaps {
+		sw.done()
+	}
+	return nil
+}
+
+// swap is a file replaced or deleted by Update, which can still be undone.
+type swap struct {
+	path string
+	// old is where the previous file was moved, or empty if there was none.
+	old string
+	// placed is set when a new file took the place of the previous one.
+	placed bool
+}
+
+// swap moves the file of key aside and puts the staged file at tempPath in
+// its place, or only moves it aside when tempPath is empty.
+func (s *FileStore) swap(key, tempPath string) (*swap, error) {
+	filePath := s.path(key)
+	sw := &swap{path: filePath}
+	if _, err := os.Stat(filePath); err == nil {
+		sw.old = filePath + tempFileMarker + "old"
+		if err := os.Rename(filePath, sw.old); err != nil {
+			return nil, fmt.Errorf("failed to move %s aside: %w", filePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to check file %s: %w", filePath, err)
+	}
+
+	if tempPath != "" {
+		if err := os.Rename(tempPath, filePath); err != nil {
+			if undoErr := sw.undo(); undoErr != nil {
+				fmt.Printf("Failed to restore %s: %v\n", filePath, undoErr)
+			}
+			return nil, fmt.Errorf("failed to replace file %s: %w", filePath, err)
+		}
+		sw.placed = true
+	}
+	return sw, nil
+}
+
+// undo puts the previous file back.
+func (sw *swap) undo() error {
+	if sw.placed {
+		if err := os.Remove(sw.path); err != nil {
+			return err
+		}
+	}
+	if sw.old != "" {
+		return os.Rename(sw.old, sw.path)
+	}
+	return nil
+}
+
+// done removes the previous file, once every swap succeeded.
+func (sw *swap) done() {
+	if sw.old == "" {
+		return
+	}
+	if err := os.Remove(sw.old); err != nil {
+		fmt.Printf("Failed to remove %s: %v\n", sw.old, err)
+	}
+}
+
+// Append adds a line at the end of the file of key, creating it if needed.
+func (s *FileStore) Append(key string, line []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	filePath := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+	}
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Lines calls fn with every non-empty line of the file of key.
+func (s *FileStore) Lines(key string, fn func(line []byte) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	filePath := s.path(key)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return fmt.Errorf("failed to decode line of %s: %w", filePath, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Close does nothing, since files are closed after every operation.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *FileStore) get(key string) ([]byte, error) {
+	filePath := s.path(key)
+	value, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file %s: %w", filePath, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	return value, nil
+}
+
+// put writes value to a temporary file that then replaces the file of key,
+// so a crash mid-write never leaves a truncated file behind.
+func (s *FileStore) put(key string, value []byte) error {
+	tempPath, err := s.stage(key, value)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempPath)
+
+	filePath := s.path(key)
+	if err := os.Rename(tempPath, filePath); err != nil {
+		return fmt.Errorf("failed to replace file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// stage writes value to a temporary file next to the file of key, returning
+// its path.
+func (s *FileStore) stage(key string, value []byte) (string, error) {
+	filePath := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", filePath, err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+tempFileMarker+"*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(value); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write file %s: %w", file.Name(), err)
+	}
+	if err := file.Sync(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to sync file %s: %w", file.Name(), err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to close file %s: %w", file.Name(), err)
+	}
+	return file.Name(), nil
+}
+
+func (s *FileStore) delete(key string) error {
+	filePath := s.path(key)
+	if err := os.Remove(filePath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file %s: %w", filePath, ErrNotFound)
+		}
+		return fmt.Errorf("failed to delete file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+func (s *FileStore) list(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == s.dir {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) && !strings.Contains(entry.Name(), tempFileMarker) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s: %w", s.dir, err)
+	}
+	return keys, nil
+}
+
+// fileTx buffers the writes of a FileStore transaction until it succeeds.
+type fileTx struct {
+	store *FileStore
+	// writes holds the new value of each changed key, nil for deleted ones.
+	writes map[string][]byte
+	order  []string
+}
+
+func (tx *fileTx) Get(key string) ([]byte, error) {
+	if value, written := tx.writes[key]; written {
+		if value == nil {
+			return nil, fmt.Errorf("key %s: %w", key, ErrNotFound)
+		}
+		return value, nil
+	}
+	return tx.store.get(key)
+}
+
+func (tx *fileTx) Put(key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	tx.set(key, value)
+	return nil
+}
+
+func (tx *fileTx) Delete(key string) error {
+	if _, err := tx.Get(key); err != nil {
+		return err
+	}
+	tx.set(key, nil)
+	return nil
+}
+
+// Append rewrites the file of key with line added, since the transaction
+// may still fail.
+func (tx *fileTx) Append(key string, line []byte) error {
+	value, err := tx.Get(key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	tx.set(key, append(append(slices.Clip(value), line...), '\n'))
+	return nil
+}
+
+func (tx *fileTx) List(prefix string) ([]string, error) {
+	keys, err := tx.store.list(prefix)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool)
+	for _, key := range keys {
+		listed[key] = true
+	}
+	for key, value := range tx.writes {
+		if strings.HasPrefix(key, prefix) {
+			listed[key] = value != nil
+		}
+	}
+	keys = keys[:0]
+	for key, exists := range listed {
+		if exists {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (tx *fileTx) set(key string, value []byte) {
+	if _, written := tx.writes[key]; !written {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = value
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, store Store, key string) string {
+	t.Helper()
+	value, err := store.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return "<none>"
+	}
+	if err != nil {
+		t.Fatalf("Get(%q) error = %v", key, err)
+	}
+	return string(value)
+}
+
+func TestFileStoreUpdate(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	for key, value := range map[string]string{"db/a.json": "a", "db/b.json": "b"} {
+		if err := store.Put(key, []byte(value)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+
+	err := store.Update(func(tx Tx) error {
+		if err := tx.Put("db/a.json", []byte("a2")); err != nil {
+			return err
+		}
+		if err := tx.Delete("db/b.json"); err != nil {
+			return err
+		}
+		if err := tx.Put("db/c.json", []byte("c")); err != nil {
+			return err
+		}
+		return tx.Append("db/log.jsonl", []byte("line"))
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	want := map[string]string{"db/a.json": "a2", "db/b.json": "<none>", "db/c.json": "c", "db/log.jsonl": "line\n"}
+	for key, value := range want {
+		if got := get(t, store, key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestFileStoreUpdateFailureChangesNothing(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	if err := store.Put("db/a.json", []byte("a")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	tests := map[string]func(tx Tx) error{
+		"fn fails": func(tx Tx) error {
+			tx.Put("db/a.json", []byte("a2"))
+			return errors.New("boom")
+		},
+		// db/a.json is a file, so nothing can be written under it, which only
+		// shows once the writes are staged.
+		"staging fails": func(tx Tx) error {
+			tx.Put("db/a.json", []byte("a2"))
+			tx.Put("db/new.json", []byte("new"))
+			return tx.Put("db/a.json/b.json", []byte("b"))
+		},
+	}
+	for name, fn := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := store.Update(fn); err == nil {
+				t.Fatalf("Update() succeeded, want an error")
+			}
+			if got := get(t, store, "db/a.json"); got != "a" {
+				t.Errorf("db/a.json = %q, want %q", got, "a")
+			}
+			if got := get(t, store, "db/new.json"); got != "<none>" {
+				t.Errorf("db/new.json = %q, want none", got)
+			}
+			assertNoTempFiles(t, dir)
+		})
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.Contains(entry.Name(), tempFileMarker) {
+			t.Errorf("temporary file %s was left behind", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to walk %s: %v", dir, err)
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gtrindade/ultra-kiew/internal/config"
+)
+
+const (
+	// BackendFile keeps every value in its own file under BasePath.
+	BackendFile = "file"
+
+	// BackendBolt keeps every value in a single embedded bbolt database.
+	BackendBolt = "bolt"
+
+	// BoltFileName is the default name of the bbolt database, under BasePath.
+	BoltFileName = "state.db"
+)
+
+// ErrNotFound is returned when a key has no value.
+var ErrNotFound = errors.New("not found")
+
+// Tx reads and writes values by key. Keys are slash-separated paths like
+// "db/chat-data-1.json".
+type Tx interface {
+	// Get returns the value of key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+	// Put sets the value of key.
+	Put(key string, value []byte) error
+	// Delete removes the value of key, or returns ErrNotFound.
+	Delete(key string) error
+	// List returns the keys starting with prefix, sorted.
+	List(prefix string) ([]string, error)
+	// Append adds a line to the lines of key without rewriting the ones
+	// already there.
+	Append(key string, line []byte) error
+}
+
+// Store is where the bot keeps its state.
+type Store interface {
+	Tx
+
+	// Update runs fn in a transaction, applying its writes together only if
+	// it succeeds. A failed Update changes nothing, but a crash in the middle
+	// of one can leave a FileStore with only some of its writes.
+	Update(fn func(tx Tx) error) error
+
+	// Lines calls fn with every line appended to key, in order. A key without
+	// lines has none.
+	Lines(key string, fn func(line []byte) error) error
+
+	// Close releases the store.
+	Close() error
+}
+
+// Open opens the store selected in cfg, defaulting to files under BasePath,
+// encrypted when cfg has an encryption key. A new bolt database imports the
+// data kept in files so far.
+func Open(cfg *config.StorageConfig) (Store, error) {
+	if cfg == nil {
+		cfg = &config.StorageConfig{}
+	}
+
+	var crypt *Cipher
+	if cfg.EncryptionKey != "" {
+		var err error
+		if crypt, err = NewCipher(cfg.EncryptionKey, cfg.OldEncryptionKeys); err != nil {
+			return nil, err
+		}
+	}
+	encrypt := func(store Store) Store {
+		if crypt == nil {
+			return store
+		}
+		return NewEncryptedStore(store, crypt)
+	}
+
+	if cfg.Backend == "" || cfg.Backend == BackendFile {
+		return encrypt(NewFileStore(BasePath)), nil
+	}
+	if cfg.Backend != BackendBolt {
+		return nil, fmt.Errorf("unknown storage backend %q, use %q or %q", cfg.Backend, BackendFile, BackendBolt)
+	}
+
+	dbPath := cfg.Path
+	if dbPath == "" {
+		dbPath = filepath.Join(BasePath, BoltFileName)
+	}
+	_, err := os.Stat(dbPath)
+	isNew := os.IsNotExist(err)
+
+	boltStore, err := OpenBoltStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	store := encrypt(boltStore)
+	if isNew {
+		count, err := Import(store, encrypt(NewFileStore(BasePath)), DBPath+"/")
+		if err != nil {
+			store.Close()
+			os.Remove(dbPath)
+			return nil, fmt.Errorf("failed to import files into %s: %w", dbPath, err)
+		}
+		fmt.Printf("Imported %d files into %s\n", count, dbPath)
+	}
+	return store, nil
+}
+
+// Import copies the values and lines under prefix from one store to another,
+// returning how many keys were copied. Keys ending in ".jsonl" are copied
+// line by line.
+func Import(dst, src Store, prefix string) (int, error) {
+	keys, err := src.List(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".jsonl") {
+			err = src.Lines(key, func(line []byte) error {
+				return dst.Append(key, line)
+			})
+		} else {
+			var value []byte
+			value, err = src.Get(key)
+			if err == nil {
+				err = dst.Put(key, value)
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to copy %s: %w", key, err)
+		}
+	}
+	return len(keys), nil
+}
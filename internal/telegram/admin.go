@@ -0,0 +1,128 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
+)
+
+// toolsCommand lists the tools of a chat, or enables and disables them with
+// "/tools enable <name>" and "/tools disable <name>".
+func (c *Client) toolsCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	settings := c.ai.ToolSettings()
+	action, name, _ := strings.Cut(args, " ")
+	name = strings.TrimSpace(name)
+
+	switch strings.ToLower(action) {
+	case "":
+		var sb strings.Builder
+		sb.WriteString("Tools in this chat:\n")
+		for _, tool := range settings.Tools() {
+			status := "disabled"
+			if settings.Enabled(msg.Chat.ID, tool) {
+				status = "enabled"
+			}
+			sb.WriteString(fmt.Sprintf("- %s: %s", tool.Name(), status))
+			if tool.Role > auth.RolePlayer {
+				sb.WriteString(fmt.Sprintf(" (%s only)", tool.Role))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\nUse /tools enable <name> or /tools disable <name> to change them.")
+		return sb.String(), nil
+	case "enable", "disable":
+		if name == "" {
+			return fmt.Sprintf("Usage: /tools %s <name>", action), nil
+		}
+		var tool *tools.Tool
+		for _, t := range settings.Tools() {
+			if t.Name() == name {
+				tool = t
+			}
+		}
+		if tool == nil {
+			return fmt.Sprintf("Unknown tool %q", name), nil
+		}
+		// Chat administrators manage the tools of their chat like GMs, but
+		// tools restricted to GMs or owners still need that role, whatever
+		// the chat.
+		err := auth.Require(ctx, max(auth.RoleGM, tool.Role), "change "+name)
+		if err != nil && tool.Role == auth.RolePlayer && c.isChatAdmin(ctx, msg) {
+			err = nil
+		}
+		if err != nil {
+			return err.Error(), nil
+		}
+
+		enabled := strings.EqualFold(action, "enable")
+		err = c.ai.SetToolEnabled(ctx, msg.Chat.ID, name, enabled)
+		if err != nil {
+			return "", fmt.Errorf("failed to update tool %s: %w", name, err)
+		}
+		return fmt.Sprintf("Tool %s is now %sd.", name, strings.ToLower(action)), nil
+	default:
+		return "Usage: /tools [enable|disable <name>]", nil
+	}
+}
+
+// isChatAdmin tells whether the sender of msg administers the chat. Everyone
+// administers their own private chat with the bot, so this only ever grants
+// what players may do.
+func (c *Client) isChatAdmin(ctx context.Context, msg *models.Message) bool {
+	if msg.Chat.Type == models.ChatTypePrivate {
+		return true
+	}
+	if msg.From == nil {
+		return false
+	}
+
+	member, err := c.bot.GetChatMember(ctx, &bot.GetChatMemberParams{
+		ChatID: msg.Chat.ID,
+		UserID: msg.From.ID,
+	})
+	if err != nil {
+		fmt.Printf("Failed to get chat member %d: %v\n", msg.From.ID, err)
+		return false
+	}
+	return member.Type == models.ChatMemberTypeOwner || member.Type == models.ChatMemberTypeAdministrator
+}
+
+// backupCommand takes a snapshot of the bot state, or lists the snapshots
+// with "/backup list". Only owners can use it, since snapshots hold the data
+// of every chat.
+func (c *Client) backupCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if err := auth.Require(ctx, auth.RoleOwner, "back up the bot"); err != nil {
+		return err.Error(), nil
+	}
+
+	switch strings.ToLower(args) {
+	case "":
+		snapshot, err := c.backups.Create()
+		if err != nil {
+			return "", fmt.Errorf("failed to back up the bot state: %w", err)
+		}
+		return fmt.Sprintf("Saved backup %s", snapshot), nil
+	case "list":
+		snapshots, err := c.backups.Snapshots()
+		if err != nil {
+			return "", err
+		}
+		if len(snapshots) == 0 {
+			return "There are no backups yet.", nil
+		}
+		var sb strings.Builder
+		sb.WriteString("Backups, newest first:\n")
+		for _, snapshot := range snapshots {
+			sb.WriteString(fmt.Sprintf("- %s\n", snapshot))
+		}
+		sb.WriteString("\nRestore one by running the bot with: restore <name>")
+		return sb.String(), nil
+	default:
+		return "Usage: /backup [list]", nil
+	}
+}
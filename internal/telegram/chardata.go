@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+)
+
+const (
+	// deleteCallbackPrefix prefixes the data of the buttons confirming the
+	// deletion of a character, followed by "yes:" or "no:" and its name.
+	deleteCallbackPrefix = "delete:"
+)
+
+func (c *Client) undoCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	text, err := c.ai.Undo(ctx)
+	if err != nil {
+		return fmt.Sprintf("Couldn't undo: %v", err), nil
+	}
+	return text, nil
+}
+
+// offerDeletions asks the user to confirm the deletions of whole characters
+// the AI requested while answering the message of update.
+func (c *Client) offerDeletions(ctx context.Context, update *models.Update) {
+	for _, name := range c.ai.TakeDeletions(update.Message.Chat.ID) {
+		data := deleteCallbackPrefix + "yes:" + name
+		if len(data) > maxCallbackDataLength {
+			fmt.Printf("Can't offer to delete %s, the name is too long for a button\n", name)
+			continue
+		}
+
+		_, err := c.bot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          update.Message.Chat.ID,
+			Text:            fmt.Sprintf("Delete the whole sheet of %s?", name),
+			ReplyParameters: replyParameters(update),
+			ReplyMarkup: &models.InlineKeyboardMarkup{
+				InlineKeyboard: [][]models.InlineKeyboardButton{{
+					{Text: "Delete " + truncate(name, maxButtonLength), CallbackData: data},
+					{Text: "Keep", CallbackData: deleteCallbackPrefix + "no:" + name},
+				}},
+			},
+		})
+		if err != nil {
+			fmt.Printf("Failed to ask to confirm the deletion of %s: %v\n", name, err)
+		}
+	}
+}
+
+// deleteCallback handles the buttons confirming the deletion of a character,
+// replacing the question with the outcome.
+func (c *Client) deleteCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return
+	}
+	msg := query.Message.Message
+	ctx = c.callbackContext(ctx, query)
+
+	callbackAnswer := &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}
+	// Only game masters can answer, so players can't delete characters nor
+	// dismiss the question.
+	if err := auth.Require(ctx, auth.RoleGM, "delete characters"); err != nil {
+		callbackAnswer.Text = err.Error()
+		callbackAnswer.ShowAlert = true
+		if _, err := b.AnswerCallbackQuery(ctx, callbackAnswer); err != nil {
+			fmt.Printf("Failed to answer callback query: %v\n", err)
+		}
+		return
+	}
+
+	answer, name, _ := strings.Cut(strings.TrimPrefix(query.Data, deleteCallbackPrefix), ":")
+	text := fmt.Sprintf("Kept %s.", name)
+	var err error
+	if answer == "yes" {
+		text, err = c.ai.DeleteCharacter(ctx, name)
+	}
+
+	if err != nil {
+		fmt.Printf("Failed to delete %s: %v\n", name, err)
+		callbackAnswer.Text = "Sorry, something went wrong."
+		callbackAnswer.ShowAlert = true
+	}
+	if _, err := b.AnswerCallbackQuery(ctx, callbackAnswer); err != nil {
+		fmt.Printf("Failed to answer callback query: %v\n", err)
+	}
+	if err != nil {
+		return
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    msg.Chat.ID,
+		MessageID: msg.ID,
+		Text:      text,
+	})
+	if err != nil {
+		fmt.Printf("Failed to update deletion message: %v\n", err)
+	}
+}
@@ -5,50 +5,54 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"github.com/gtrindade/ultra-kiew/internal/backup"
+	"github.com/gtrindade/ultra-kiew/internal/chathistory"
+	"github.com/gtrindade/ultra-kiew/internal/combat"
 	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/diceroller"
 	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+	"github.com/gtrindade/ultra-kiew/internal/mysql"
 	"github.com/gtrindade/ultra-kiew/internal/storage"
 )
 
 // Client represents the Telegram bot client.
 type Client struct {
-	bot            *bot.Bot
-	ai             *googlegenai.Client
-	storage        *storage.Client
-	botName        string
-	lock           sync.RWMutex
-	chatHistory    map[int64][]*SavedMessage
-	maxHistorySize int
-}
-
-// SavedMessage represents a message saved from a user.
-type SavedMessage struct {
-	UserID    int64
-	UserName  string
-	Text      string
-	Timestamp time.Time
-}
-
-func (m *SavedMessage) String() string {
-	return fmt.Sprintf("[%s - %s]: `%s`", m.Timestamp.Format(time.RFC3339), m.UserName, m.Text)
+	bot         *bot.Bot
+	ai          *googlegenai.Client
+	dice        *diceroller.Client
+	combat      *combat.Tracker
+	db          *mysql.Client
+	storage     *storage.Client
+	backups     *backup.Manager
+	config      *config.Config
+	botName     string
+	replyFormat string
+	streaming   bool
+	commands    map[string]commandFunc
+	history     *chathistory.History
 }
 
 // NewBot creates a new Telegram bot client with the provided configuration and AI client.
-func NewBot(config *config.Config, ai *googlegenai.Client, storageClient *storage.Client) (*Client, error) {
+func NewBot(config *config.Config, ai *googlegenai.Client, dice *diceroller.Client, tracker *combat.Tracker, dbClient *mysql.Client, storageClient *storage.Client, backups *backup.Manager) (*Client, error) {
 	c := &Client{
-		storage:        storageClient,
-		ai:             ai,
-		chatHistory:    make(map[int64][]*SavedMessage),
-		maxHistorySize: 600,
+		storage: storageClient,
+		backups: backups,
+		ai:      ai,
+		dice:    dice,
+		combat:  tracker,
+		db:      dbClient,
 	}
 	opts := []bot.Option{
 		bot.WithDefaultHandler(c.handler),
+		bot.WithCallbackQueryDataHandler(combatCallbackPrefix, bot.MatchTypePrefix, c.combatCallback),
+		bot.WithCallbackQueryDataHandler(lookupCallbackPrefix, bot.MatchTypePrefix, c.lookupCallback),
+		bot.WithCallbackQueryDataHandler(deleteCallbackPrefix, bot.MatchTypePrefix, c.deleteCallback),
 		bot.WithCheckInitTimeout(time.Second * 30),
 	}
 
@@ -62,19 +66,27 @@ func NewBot(config *config.Config, ai *googlegenai.Client, storageClient *storag
 	}
 
 	c.bot = b
+	c.config = config
 	c.botName = config.BotName
+	c.replyFormat = config.ReplyFormat
+	c.streaming = !config.DisableStreaming
+	if c.replyFormat == "" {
+		c.replyFormat = ReplyFormatPlain
+	}
+	c.registerCommands()
 
-	err = c.storage.LoadChatHistory(&c.chatHistory)
+	c.history, err = chathistory.New(storageClient, c.botName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load chat history: %w", err)
+		return nil, err
 	}
 
 	return c, nil
 }
 
-// Start starts the Telegram bot and listens for updates.
+// Start starts the Telegram bot and listens for updates until the process is
+// interrupted or terminated.
 func (c *Client) Start(ctx context.Context) {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	fmt.Println("Starting Telegram bot...")
@@ -91,82 +103,77 @@ func (c *Client) handler(ctx context.Context, b *bot.Bot, update *models.Update)
 
 	chatID := update.Message.Chat.ID
 	text := update.Message.Text
-	hasBotName := strings.Contains(strings.ToLower(text), strings.ToLower(c.botName))
+	ctx = auth.WithIdentity(ctx, c.identity(getMessageFromUpdate(update), chatID))
 	isChatPrivate := update.Message.Chat.Type == models.ChatTypePrivate
-	isReplyToBot := update.Message.ReplyToMessage != nil && update.Message.ReplyToMessage.From != nil && update.Message.ReplyToMessage.From.Username == c.botName
-	if !isChatPrivate && !hasBotName && !isReplyToBot {
-		c.addToChatHistory(update)
-		return
-	}
-	text = c.getChatHistory(chatID) + "\n" + getMessageFromUpdate(update).String()
-	c.clearChatHistory(chatID)
-	response, err = c.ai.SendMessage(ctx, chatID, text)
-
-	if err != nil {
-		fmt.Printf("Failed to send message: %v", err)
-		response = "Sorry, something went wrong."
-	}
 
-	var replyParams *models.ReplyParameters
-	if !isChatPrivate {
-		replyParams = &models.ReplyParameters{
-			MessageID: update.Message.ID,
+	if name, args, ok := c.parseCommand(text); ok {
+		if command, exists := c.commands[name]; exists {
+			response, err = command(ctx, update.Message, args)
+			if err != nil {
+				fmt.Printf("Failed to run command /%s: %v\n", name, err)
+				response = "Sorry, something went wrong."
+			}
+			// Commands that send their own messages reply with nothing.
+			if response != "" {
+				c.reply(ctx, update, response)
+			}
+			return
 		}
 	}
 
-	b.SendMessage(ctx, &bot.SendMessageParams{
-		ReplyParameters: replyParams,
-		ChatID:          chatID,
-		Text:            response,
-	})
-}
-
-func getMessageFromUpdate(update *models.Update) *SavedMessage {
-	return &SavedMessage{
-		UserID:    update.Message.From.ID,
-		UserName:  update.Message.From.Username,
-		Text:      update.Message.Text,
-		Timestamp: time.Unix(int64(update.Message.Date), 0),
+	isReplyToBot := update.Message.ReplyToMessage != nil && update.Message.ReplyToMessage.From != nil && update.Message.ReplyToMessage.From.Username == c.botName
+	text, addressed := c.history.Prompt(chatID, getMessageFromUpdate(update), isChatPrivate, isReplyToBot)
+	if !addressed {
+		return
+	}
+	ctx, candidates := googlegenai.WithCandidates(ctx)
+	if c.streaming {
+		c.streamReply(ctx, update, text)
+	} else {
+		response, err = c.ai.SendMessage(ctx, chatID, text)
+		if err != nil {
+			fmt.Printf("Failed to send message: %v\n", err)
+			response = "Sorry, something went wrong."
+		}
+		c.reply(ctx, update, response)
 	}
+	c.offerCandidates(ctx, update, candidates.Take())
+	c.offerDeletions(ctx, update)
 }
 
-func (c *Client) addToChatHistory(update *models.Update) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	msg := getMessageFromUpdate(update)
-	chatID := update.Message.Chat.ID
-	if c.chatHistory[chatID] == nil {
-		c.chatHistory[chatID] = make([]*SavedMessage, 0)
+// replyParameters makes replies quote the original message in groups.
+func replyParameters(update *models.Update) *models.ReplyParameters {
+	if update.Message.Chat.Type == models.ChatTypePrivate {
+		return nil
 	}
-	c.chatHistory[chatID] = append(c.chatHistory[chatID], msg)
-	if len(c.chatHistory[chatID]) > c.maxHistorySize {
-		c.chatHistory[chatID] = c.chatHistory[chatID][1:]
+	return &models.ReplyParameters{
+		MessageID: update.Message.ID,
 	}
-	c.storage.SaveChatHistoryAsync(c.getCopyOfChatHistory())
 }
 
-func (c *Client) getChatHistory(chatID int64) string {
-	c.lock.RLock()
-	defer c.lock.RUnlock()
-	historyLines := make([]string, len(c.chatHistory[chatID]))
-	for i, msg := range c.chatHistory[chatID] {
-		historyLines[i] = msg.String()
+// reply sends text to the chat of the update, replying to the original message in groups.
+func (c *Client) reply(ctx context.Context, update *models.Update, text string) {
+	err := c.sendReply(ctx, update.Message.Chat.ID, replyParameters(update), text)
+	if err != nil {
+		fmt.Printf("Failed to send reply: %v\n", err)
 	}
-	return strings.Join(historyLines, "\n")
 }
 
-func (c *Client) clearChatHistory(chatID int64) {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.chatHistory[chatID] = make([]*SavedMessage, 0)
-	c.storage.SaveChatHistoryAsync(c.getCopyOfChatHistory())
+// identity resolves the role of the sender of msg in a chat.
+func (c *Client) identity(msg *chathistory.Message, chatID int64) auth.Identity {
+	return auth.Identity{
+		ChatID:   chatID,
+		UserID:   msg.UserID,
+		UserName: msg.UserName,
+		Role:     auth.RoleOf(c.config, chatID, msg.UserID),
+	}
 }
 
-func (c *Client) getCopyOfChatHistory() map[int64][]*SavedMessage {
-	history := make(map[int64][]*SavedMessage, len(c.chatHistory))
-	for chatID, messages := range c.chatHistory {
-		history[chatID] = make([]*SavedMessage, len(messages))
-		copy(history[chatID], messages)
+func getMessageFromUpdate(update *models.Update) *chathistory.Message {
+	return &chathistory.Message{
+		UserID:    update.Message.From.ID,
+		UserName:  update.Message.From.Username,
+		Text:      update.Message.Text,
+		Timestamp: time.Unix(int64(update.Message.Date), 0),
 	}
-	return history
 }
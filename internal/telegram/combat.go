@@ -0,0 +1,220 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+)
+
+const (
+	// combatCallbackPrefix prefixes the data of the inline buttons of encounters.
+	combatCallbackPrefix = "combat:"
+
+	combatUsage = `Usage:
+/combat [status|start|stop|next]
+/combat add <character> [initiative]
+/combat monster <name> [count]
+/combat remove <name>
+/combat dmg|heal <name> <amount>
+/combat hp <name> <hp>[/<max hp>]
+/combat init <name> <initiative>
+/combat cond <name> <condition> [rounds]
+/combat uncond <name> <condition>`
+)
+
+// combatKeyboard holds the buttons shown under encounter messages.
+var combatKeyboard = &models.InlineKeyboardMarkup{
+	InlineKeyboard: [][]models.InlineKeyboardButton{{
+		{Text: "Next turn", CallbackData: combatCallbackPrefix + "next"},
+		{Text: "Status", CallbackData: combatCallbackPrefix + "status"},
+	}},
+}
+
+// combatCommand runs an encounter action and replies with the encounter
+// buttons while an encounter is running.
+func (c *Client) combatCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	toolArgs, ok := parseCombatArgs(args)
+	if !ok {
+		return combatUsage, nil
+	}
+
+	text, err := c.runCombat(ctx, toolArgs)
+	if err != nil {
+		return err.Error(), nil
+	}
+	if !c.combat.Active(msg.Chat.ID) {
+		return text, nil
+	}
+
+	_, err = c.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          msg.Chat.ID,
+		Text:            text,
+		ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+		ReplyMarkup:     combatKeyboard,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send encounter message: %w", err)
+	}
+	return "", nil
+}
+
+func (c *Client) nextCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	return c.combatCommand(ctx, msg, "next")
+}
+
+// runCombat checks that the combat tool is enabled in the chat and the role
+// needed for an action, like the AI does, and runs it.
+func (c *Client) runCombat(ctx context.Context, args map[string]any) (string, error) {
+	tool := c.combat.GetTool()
+	if !c.ai.ToolSettings().Enabled(auth.IdentityFromContext(ctx).ChatID, tool) {
+		return "", fmt.Errorf("the %s tool is disabled in this chat, enable it with /tools enable %s", tool.Name(), tool.Name())
+	}
+	err := auth.Require(ctx, tool.RequiredRole(args), fmt.Sprintf("%s the encounter", args["action"]))
+	if err != nil {
+		return "", err
+	}
+	return c.combat.Handle(ctx, args)
+}
+
+// combatCallback handles the encounter buttons, editing the message they are attached to.
+func (c *Client) combatCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return
+	}
+	msg := query.Message.Message
+	ctx = c.callbackContext(ctx, query)
+
+	action := strings.TrimPrefix(query.Data, combatCallbackPrefix)
+	text, err := c.runCombat(ctx, map[string]any{"action": action})
+
+	answer := &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}
+	if err != nil {
+		answer.Text = err.Error()
+		answer.ShowAlert = true
+	}
+	if _, err := b.AnswerCallbackQuery(ctx, answer); err != nil {
+		fmt.Printf("Failed to answer callback query: %v\n", err)
+	}
+	if err != nil {
+		return
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.ID,
+		Text:        text,
+		ReplyMarkup: combatKeyboard,
+	})
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		fmt.Printf("Failed to update encounter message: %v\n", err)
+	}
+}
+
+// callbackContext adds the identity of the user who pressed a button to ctx.
+func (c *Client) callbackContext(ctx context.Context, query *models.CallbackQuery) context.Context {
+	chatID := query.Message.Message.Chat.ID
+	return auth.WithIdentity(ctx, auth.Identity{
+		ChatID:   chatID,
+		UserID:   query.From.ID,
+		UserName: query.From.Username,
+		Role:     auth.RoleOf(c.config, chatID, query.From.ID),
+	})
+}
+
+// parseCombatArgs turns "/combat" arguments into combat tool arguments. Names
+// may contain spaces, so numbers and conditions are read from the end.
+func parseCombatArgs(args string) (map[string]any, bool) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return map[string]any{"action": "status"}, true
+	}
+	command, rest := strings.ToLower(fields[0]), fields[1:]
+
+	switch command {
+	case "status", "start", "stop", "next":
+		return map[string]any{"action": command}, len(rest) == 0
+	case "add":
+		name, initiative, found := cutNumber(rest)
+		toolArgs := map[string]any{"action": "add", "name": name}
+		if found {
+			toolArgs["initiative"] = float64(initiative)
+		}
+		return toolArgs, name != ""
+	case "monster":
+		name, count, found := cutNumber(rest)
+		toolArgs := map[string]any{"action": "add_monster", "name": name}
+		if found {
+			toolArgs["count"] = float64(count)
+		}
+		return toolArgs, name != ""
+	case "remove":
+		name := strings.Join(rest, " ")
+		return map[string]any{"action": "remove", "name": name}, name != ""
+	case "dmg", "damage", "heal", "init":
+		action := map[string]string{"dmg": "damage", "damage": "damage", "heal": "heal", "init": "set_initiative"}[command]
+		name, amount, found := cutNumber(rest)
+		return map[string]any{"action": action, "name": name, "amount": float64(amount)}, found && name != ""
+	case "hp":
+		// The maximum is written like "5/12", since monsters are named like
+		// "Goblin 1" and a second number would be part of the name.
+		if len(rest) < 2 {
+			return nil, false
+		}
+		name := strings.Join(rest[:len(rest)-1], " ")
+		hpText, maxText, hasMax := strings.Cut(rest[len(rest)-1], "/")
+		hp, err := strconv.Atoi(hpText)
+		if err != nil {
+			return nil, false
+		}
+		toolArgs := map[string]any{"action": "set_hp", "name": name, "amount": float64(hp)}
+		if hasMax {
+			maxHP, err := strconv.Atoi(maxText)
+			if err != nil {
+				return nil, false
+			}
+			toolArgs["max_hp"] = float64(maxHP)
+		}
+		return toolArgs, true
+	case "cond":
+		name, rounds, found := cutNumber(rest)
+		fields := strings.Fields(name)
+		if len(fields) < 2 {
+			return nil, false
+		}
+		toolArgs := map[string]any{
+			"action":    "add_condition",
+			"name":      strings.Join(fields[:len(fields)-1], " "),
+			"condition": fields[len(fields)-1],
+		}
+		if found {
+			toolArgs["rounds"] = float64(rounds)
+		}
+		return toolArgs, true
+	case "uncond":
+		if len(rest) < 2 {
+			return nil, false
+		}
+		return map[string]any{
+			"action":    "remove_condition",
+			"name":      strings.Join(rest[:len(rest)-1], " "),
+			"condition": rest[len(rest)-1],
+		}, true
+	}
+	return nil, false
+}
+
+// cutNumber splits fields into the text before a trailing number and the number.
+func cutNumber(fields []string) (string, int, bool) {
+	if len(fields) > 0 {
+		if number, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			return strings.Join(fields[:len(fields)-1], " "), number, true
+		}
+	}
+	return strings.Join(fields, " "), 0, false
+}
@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCombatArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want map[string]any
+	}{
+		{"", map[string]any{"action": "status"}},
+		{"start", map[string]any{"action": "start"}},
+		{"NEXT", map[string]any{"action": "next"}},
+		{"add bob", map[string]any{"action": "add", "name": "bob"}},
+		{"add Sir Bob 15", map[string]any{"action": "add", "name": "Sir Bob", "initiative": float64(15)}},
+		{"monster dire wolf 3", map[string]any{"action": "add_monster", "name": "dire wolf", "count": float64(3)}},
+		{"remove Goblin 2", map[string]any{"action": "remove", "name": "Goblin 2"}},
+		{"dmg Goblin 1 7", map[string]any{"action": "damage", "name": "Goblin 1", "amount": float64(7)}},
+		{"heal bob 4", map[string]any{"action": "heal", "name": "bob", "amount": float64(4)}},
+		{"init bob 20", map[string]any{"action": "set_initiative", "name": "bob", "amount": float64(20)}},
+		{"hp bob 5", map[string]any{"action": "set_hp", "name": "bob", "amount": float64(5)}},
+		{"hp bob 5/12", map[string]any{"action": "set_hp", "name": "bob", "amount": float64(5), "max_hp": float64(12)}},
+		// Numbered monsters keep their number in the name.
+		{"hp Goblin 1 5", map[string]any{"action": "set_hp", "name": "Goblin 1", "amount": float64(5)}},
+		{"hp Goblin 1 5/7", map[string]any{"action": "set_hp", "name": "Goblin 1", "amount": float64(5), "max_hp": float64(7)}},
+		{"cond Goblin 2 prone 3", map[string]any{"action": "add_condition", "name": "Goblin 2", "condition": "prone", "rounds": float64(3)}},
+		{"cond bob hasted", map[string]any{"action": "add_condition", "name": "bob", "condition": "hasted"}},
+		{"uncond Goblin 2 prone", map[string]any{"action": "remove_condition", "name": "Goblin 2", "condition": "prone"}},
+	}
+
+	for _, test := range tests {
+		got, ok := parseCombatArgs(test.args)
+		if !ok {
+			t.Errorf("parseCombatArgs(%q) failed, want %v", test.args, test.want)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseCombatArgs(%q) = %v, want %v", test.args, got, test.want)
+		}
+	}
+}
+
+func TestParseCombatArgsUsage(t *testing.T) {
+	for _, args := range []string{
+		"start now",
+		"add",
+		"monster",
+		"remove",
+		"dmg bob",
+		"dmg 5",
+		"hp bob",
+		"hp bob five",
+		"hp bob 5/",
+		"hp bob 5/x",
+		"cond bob",
+		"uncond bob",
+		"fight",
+	} {
+		if got, ok := parseCombatArgs(args); ok {
+			t.Errorf("parseCombatArgs(%q) = %v, want the usage", args, got)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/diceroller"
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+	"github.com/gtrindade/ultra-kiew/internal/mysql"
+)
+
+const (
+	// maxLookupResults is the maximum number of full descriptions sent for a lookup command.
+	maxLookupResults = 3
+
+	// rollsPageSize is the number of rolls shown per page of /rolls.
+	rollsPageSize = 10
+)
+
+// commandFunc handles a slash command sent in msg. args is the text following the command.
+type commandFunc func(ctx context.Context, msg *models.Message, args string) (string, error)
+
+func (c *Client) registerCommands() {
+	c.commands = map[string]commandFunc{
+		"roll":      c.rollCommand,
+		"r":         c.rollCommand,
+		"rolls":     c.rollsCommand,
+		"gmroll":    c.gmRollCommand,
+		"dicestats": c.diceStatsCommand,
+		"spell":     c.spellCommand,
+		"feat":      c.featCommand,
+		"skill":     c.skillCommand,
+		"item":      c.itemCommand,
+		"equip":     c.equipmentCommand,
+		"monster":   c.monsterCommand,
+		"inv":       c.inventoryCommand,
+		"undo":      c.undoCommand,
+		"tools":     c.toolsCommand,
+		"backup":    c.backupCommand,
+		"combat":    c.combatCommand,
+		"next":      c.nextCommand,
+	}
+}
+
+// parseCommand splits a message like "/roll@botname 1d20+4" into the command
+// name and its arguments. Commands addressed to other bots are ignored.
+func (c *Client) parseCommand(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	name, args, _ := strings.Cut(text[1:], " ")
+	name, target, found := strings.Cut(name, "@")
+	if found && !strings.EqualFold(target, c.botName) {
+		return "", "", false
+	}
+
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+func (c *Client) rollCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /roll <dice expression or macro>, e.g. /roll 1d20+4 [str], /roll 6x 4d6k3 or /roll bob.attack\n" +
+			"Save a macro with /roll bob.attack = 1d20 + @bob.str_mod; 1d8+4", nil
+	}
+
+	if name, macro, found := strings.Cut(args, "="); found {
+		return c.saveMacro(ctx, strings.TrimSpace(name), strings.TrimSpace(macro))
+	}
+
+	if diceroller.IsMacroName(args) {
+		roll, err := c.dice.RollMacro(ctx, args)
+		if err != nil {
+			return fmt.Sprintf("Couldn't roll %s: %v", args, err), nil
+		}
+		lines := []string{roll.Name + ":"}
+		for _, result := range roll.Results {
+			lines = append(lines, formatRoll(result))
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	result, err := c.dice.RollExpanded(ctx, args)
+	if err != nil {
+		return fmt.Sprintf("Couldn't roll %s: %v", args, err), nil
+	}
+	return formatRoll(result), nil
+}
+
+// saveMacro stores a roll macro as a character property in the chat data.
+func (c *Client) saveMacro(ctx context.Context, name, macro string) (string, error) {
+	if !diceroller.IsMacroName(name) {
+		return fmt.Sprintf("%q is not a valid macro name, use character.name like bob.attack", name), nil
+	}
+	if err := diceroller.ValidateMacro(macro); err != nil {
+		return fmt.Sprintf("Couldn't save %s: %v", name, err), nil
+	}
+	return c.ai.ChatData(ctx, map[string]any{
+		"action": "set",
+		"path":   name,
+		"value":  macro,
+	})
+}
+
+func (c *Client) rollsCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	page := 1
+	if args != "" {
+		var err error
+		page, err = strconv.Atoi(args)
+		if err != nil || page < 1 {
+			return "Usage: /rolls [page]", nil
+		}
+	}
+
+	entries, pages, err := c.dice.RecentRolls(msg.Chat.ID, page, rollsPageSize)
+	if err != nil {
+		return "", err
+	}
+	if pages == 0 {
+		return "No rolls were made in this chat yet.", nil
+	}
+	if len(entries) == 0 {
+		return fmt.Sprintf("There are only %d pages of rolls.", pages), nil
+	}
+
+	lines := []string{fmt.Sprintf("Rolls, page %d of %d (newest first):", page, pages)}
+	for _, entry := range entries {
+		lines = append(lines, entry.String())
+	}
+	if page < pages {
+		lines = append(lines, fmt.Sprintf("Use /rolls %d for older rolls.", page+1))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatRoll renders a roll for the chat, ending repeated rolls with a summary of their totals.
+func formatRoll(result *diceroller.Result) string {
+	if len(result.Rolls) == 1 {
+		return result.String()
+	}
+
+	totals := make([]string, 0, len(result.Rolls))
+	for _, roll := range result.Rolls {
+		totals = append(totals, strconv.Itoa(roll.Total))
+	}
+	return fmt.Sprintf("%s\nTotals: %s", result, strings.Join(totals, ", "))
+}
+
+func (c *Client) diceStatsCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	window, err := diceroller.ParseWindow(args)
+	if err != nil {
+		return "Usage: /dicestats [window], e.g. /dicestats 30d, /dicestats 2w or /dicestats all", nil
+	}
+
+	stats, err := c.dice.Stats(msg.Chat.ID, diceroller.Since(window))
+	if err != nil {
+		return "", err
+	}
+	return stats.String(), nil
+}
+
+func (c *Client) spellCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /spell <name>", nil
+	}
+	found, err := c.ai.LookupSpells(args)
+	if err != nil {
+		return "", err
+	}
+	return c.lookupCommand(ctx, msg, found)
+}
+
+func (c *Client) featCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /feat <name>", nil
+	}
+	found, err := c.ai.LookupFeats(args)
+	if err != nil {
+		return "", err
+	}
+	return c.lookupCommand(ctx, msg, found)
+}
+
+func (c *Client) skillCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /skill <name>", nil
+	}
+	skills, err := c.db.GetSkillsByName(args)
+	if err != nil {
+		return "", fmt.Errorf("failed to get skills from database: %w", err)
+	}
+	return formatLookup("skill", args, skills, func(s *mysql.Skill) string { return s.Name }, googlegenai.FormatSkillDescription), nil
+}
+
+func (c *Client) itemCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /item <name>", nil
+	}
+	items, err := c.db.GetItemsByName(args)
+	if err != nil {
+		return "", fmt.Errorf("failed to get items from database: %w", err)
+	}
+	return formatLookup("item", args, items, func(i *mysql.Item) string { return i.Name }, googlegenai.FormatItemDescription), nil
+}
+
+func (c *Client) equipmentCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /equip <name>", nil
+	}
+	equipment, err := c.db.GetEquipmentByName(args)
+	if err != nil {
+		return "", fmt.Errorf("failed to get equipment from database: %w", err)
+	}
+	return formatLookup("equipment", args, equipment, func(e *mysql.Equipment) string { return e.Name }, googlegenai.FormatEquipmentDescription), nil
+}
+
+func (c *Client) monsterCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /monster <name>", nil
+	}
+	found, err := c.ai.LookupMonsters(args)
+	if err != nil {
+		return "", err
+	}
+	return c.lookupCommand(ctx, msg, found)
+}
+
+func (c *Client) inventoryCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	return c.ai.CharacterData(msg.Chat.ID, args)
+}
+
+// formatLookup renders lookup results, preferring exact name matches and
+// falling back to a list of names when there are too many results.
+func formatLookup[T any](kind, name string, results []T, nameOf func(T) string, format func(T) string) string {
+	if len(results) == 0 {
+		return fmt.Sprintf("No %s found with the name %q", kind, name)
+	}
+
+	var sb strings.Builder
+	for _, result := range results {
+		if strings.EqualFold(nameOf(result), name) {
+			sb.WriteString(format(result))
+		}
+	}
+	if sb.Len() > 0 {
+		return sb.String()
+	}
+
+	if len(results) > maxLookupResults {
+		sb.WriteString(fmt.Sprintf("Found %d matches for %q, please be more specific:\n", len(results), name))
+		for _, result := range results {
+			sb.WriteString(fmt.Sprintf("- %s\n", nameOf(result)))
+		}
+		return sb.String()
+	}
+
+	for _, result := range results {
+		sb.WriteString(format(result))
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
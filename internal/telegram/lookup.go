@@ -0,0 +1,120 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+)
+
+const (
+	// lookupCallbackPrefix prefixes the data of the buttons offering lookup
+	// matches, followed by the kind and id of the entry, as in "lookup:spell:42".
+	lookupCallbackPrefix = "lookup:"
+
+	// maxButtonLength is the maximum length of the text of a button.
+	maxButtonLength = 60
+
+	// maxCallbackDataLength is the maximum length Telegram allows for the data of a button.
+	maxCallbackDataLength = 64
+)
+
+// lookupCommand replies with the result of a lookup, or with buttons to pick
+// one of the matches when there are too many of them.
+func (c *Client) lookupCommand(ctx context.Context, msg *models.Message, found *googlegenai.Lookup) (string, error) {
+	if len(found.Candidates) == 0 {
+		return found.Text, nil
+	}
+
+	err := c.sendCandidates(ctx, msg.Chat.ID, &models.ReplyParameters{MessageID: msg.ID}, found.Candidates)
+	if err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// sendCandidates sends a message with one button per candidate.
+func (c *Client) sendCandidates(ctx context.Context, chatID int64, replyParams *models.ReplyParameters, candidates []*googlegenai.Candidate) error {
+	keyboard := &models.InlineKeyboardMarkup{}
+	for _, candidate := range candidates {
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []models.InlineKeyboardButton{{
+			Text:         truncate(candidate.Label(), maxButtonLength),
+			CallbackData: fmt.Sprintf("%s%s:%d", lookupCallbackPrefix, candidate.Kind, candidate.ID),
+		}})
+	}
+
+	_, err := c.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          chatID,
+		Text:            fmt.Sprintf("Found %d matches, pick one:", len(candidates)),
+		ReplyParameters: replyParams,
+		ReplyMarkup:     keyboard,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send lookup matches: %w", err)
+	}
+	return nil
+}
+
+// offerCandidates sends the matches of the lookups the AI made while answering
+// the message of update, if any were ambiguous.
+func (c *Client) offerCandidates(ctx context.Context, update *models.Update, candidates []*googlegenai.Candidate) {
+	if len(candidates) == 0 {
+		return
+	}
+	err := c.sendCandidates(ctx, update.Message.Chat.ID, replyParameters(update), candidates)
+	if err != nil {
+		fmt.Printf("Failed to offer lookup matches: %v\n", err)
+	}
+}
+
+// lookupCallback handles the lookup buttons, replying with the chosen entry.
+func (c *Client) lookupCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	query := update.CallbackQuery
+	if query == nil || query.Message.Message == nil {
+		return
+	}
+	msg := query.Message.Message
+
+	text, err := c.describe(strings.TrimPrefix(query.Data, lookupCallbackPrefix))
+
+	answer := &bot.AnswerCallbackQueryParams{CallbackQueryID: query.ID}
+	if err != nil {
+		fmt.Printf("Failed to describe %q: %v\n", query.Data, err)
+		answer.Text = "Sorry, something went wrong."
+		answer.ShowAlert = true
+	}
+	if _, err := b.AnswerCallbackQuery(ctx, answer); err != nil {
+		fmt.Printf("Failed to answer callback query: %v\n", err)
+	}
+	if err != nil {
+		return
+	}
+
+	err = c.sendReply(ctx, msg.Chat.ID, &models.ReplyParameters{MessageID: msg.ID}, text)
+	if err != nil {
+		fmt.Printf("Failed to send lookup result: %v\n", err)
+	}
+}
+
+// describe renders the entry named by callback data like "spell:42".
+func (c *Client) describe(data string) (string, error) {
+	kind, rawID, found := strings.Cut(data, ":")
+	id, err := strconv.Atoi(rawID)
+	if !found || err != nil {
+		return "", fmt.Errorf("invalid lookup button data: %q", data)
+	}
+	return c.ai.Describe(kind, id)
+}
+
+// truncate shortens text to at most limit characters, marking the cut with an ellipsis.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,194 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// maxMessageLength is Telegram's limit for a single text message.
+	maxMessageLength = 4096
+
+	// maxChunkLength leaves room for the markup added when rendering a chunk as HTML.
+	maxChunkLength = 3500
+
+	// maxReplyMessages is the number of messages a reply may be split into
+	// before it is sent as a text document instead.
+	maxReplyMessages = 4
+
+	// ReplyFormatPlain sends replies as plain text.
+	ReplyFormatPlain = "plain"
+
+	// ReplyFormatHTML renders the Markdown used by the model as Telegram HTML.
+	ReplyFormatHTML = "html"
+)
+
+var (
+	codeBlockPattern  = regexp.MustCompile("(?s)```[a-zA-Z]*\n?(.*?)```")
+	inlineCodePattern = regexp.MustCompile("`([^`\n]+)`")
+	boldPattern       = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	headingPattern    = regexp.MustCompile(`(?m)^#{1,6} +(.+)$`)
+)
+
+// sendReply sends text to a chat, splitting it on section boundaries to fit
+// Telegram's message limit, or attaching it as a document when it is too long.
+func (c *Client) sendReply(ctx context.Context, chatID int64, replyParams *models.ReplyParameters, text string) error {
+	chunks := splitMessage(text, maxChunkLength)
+	if len(chunks) > maxReplyMessages {
+		return c.sendDocument(ctx, chatID, replyParams, text)
+	}
+
+	for i, chunk := range chunks {
+		var params *models.ReplyParameters
+		if i == 0 {
+			params = replyParams
+		}
+		err := c.sendChunk(ctx, chatID, params, chunk)
+		if err != nil {
+			return fmt.Errorf("failed to send message %d of %d: %w", i+1, len(chunks), err)
+		}
+	}
+	return nil
+}
+
+// sendChunk sends a single chunk in the configured reply format, falling back
+// to plain text if Telegram rejects the markup.
+func (c *Client) sendChunk(ctx context.Context, chatID int64, replyParams *models.ReplyParameters, chunk string) error {
+	text, parseMode := c.formatChunk(chunk)
+	params := &bot.SendMessageParams{
+		ChatID:          chatID,
+		ReplyParameters: replyParams,
+		Text:            text,
+		ParseMode:       parseMode,
+	}
+
+	_, err := c.bot.SendMessage(ctx, params)
+	if err != nil && parseMode != "" {
+		fmt.Printf("Failed to send HTML reply, falling back to plain text: %v\n", err)
+		params.Text = chunk
+		params.ParseMode = ""
+		_, err = c.bot.SendMessage(ctx, params)
+	}
+	return err
+}
+
+// editChunk replaces the text of a message with chunk, like sendChunk.
+func (c *Client) editChunk(ctx context.Context, chatID int64, messageID int, chunk string) error {
+	text, parseMode := c.formatChunk(chunk)
+	params := &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      text,
+		ParseMode: parseMode,
+	}
+
+	_, err := c.bot.EditMessageText(ctx, params)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	if err != nil && parseMode != "" {
+		fmt.Printf("Failed to edit HTML reply, falling back to plain text: %v\n", err)
+		params.Text = chunk
+		params.ParseMode = ""
+		_, err = c.bot.EditMessageText(ctx, params)
+	}
+	return err
+}
+
+func (c *Client) formatChunk(chunk string) (string, models.ParseMode) {
+	if c.replyFormat == ReplyFormatHTML {
+		if rendered := renderHTML(chunk); textLength(rendered) <= maxMessageLength {
+			return rendered, models.ParseModeHTML
+		}
+	}
+	return chunk, ""
+}
+
+func (c *Client) sendDocument(ctx context.Context, chatID int64, replyParams *models.ReplyParameters, text string) error {
+	caption, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	if textLength(caption) > 200 {
+		caption = string([]rune(caption)[:200]) + "..."
+	}
+
+	_, err := c.bot.SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:          chatID,
+		ReplyParameters: replyParams,
+		Caption:         caption,
+		Document: &models.InputFileUpload{
+			Filename: "reply.txt",
+			Data:     bytes.NewReader([]byte(text)),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send reply as a document: %w", err)
+	}
+	return nil
+}
+
+// splitMessage splits text into chunks of at most limit characters,
+// preferring blank lines, then line breaks, then spaces as split points.
+func splitMessage(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+
+	var chunks []string
+	for textLength(text) > limit {
+		cut := cutIndex(text, limit)
+		chunk := strings.TrimSpace(text[:cut])
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// cutIndex returns the byte index where text should be split so the first
+// part holds at most limit characters.
+func cutIndex(text string, limit int) int {
+	var length, maxIndex int
+	for i, r := range text {
+		length += len(utf16.Encode([]rune{r}))
+		if length > limit {
+			break
+		}
+		maxIndex = i + len(string(r))
+	}
+
+	head := text[:maxIndex]
+	for _, separator := range []string{"\n\n", "\n", " "} {
+		if i := strings.LastIndex(head, separator); i > 0 {
+			return i + len(separator)
+		}
+	}
+	return maxIndex
+}
+
+// textLength counts characters the way Telegram does, in UTF-16 code units.
+func textLength(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
+
+// renderHTML escapes text and converts the small subset of Markdown the
+// model tends to use into Telegram HTML.
+func renderHTML(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = codeBlockPattern.ReplaceAllString(escaped, "<pre>$1</pre>")
+	escaped = inlineCodePattern.ReplaceAllString(escaped, "<code>$1</code>")
+	escaped = boldPattern.ReplaceAllString(escaped, "<b>$1</b>")
+	escaped = headingPattern.ReplaceAllString(escaped, "<b>$1</b>")
+	return escaped
+}
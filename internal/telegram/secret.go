@@ -0,0 +1,55 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+)
+
+// Whisper sends text by private message to every game master of a chat. GMs
+// must have started a private chat with the bot to receive it.
+func (c *Client) Whisper(ctx context.Context, chatID int64, text string) error {
+	gameMasters := auth.GameMasters(c.config, chatID)
+	if len(gameMasters) == 0 {
+		return errors.New("this chat has no GM configured")
+	}
+
+	chat, err := c.bot.GetChat(ctx, &bot.GetChatParams{ChatID: chatID})
+	if err == nil && chat.Title != "" {
+		text = fmt.Sprintf("[%s] %s", chat.Title, text)
+	}
+
+	var errs []error
+	for _, userID := range gameMasters {
+		_, err := c.bot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: userID,
+			Text:   text,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to message GM %d, they may need to start a private chat with the bot first: %w", userID, err))
+		}
+	}
+	// The roll is delivered as long as one GM got it.
+	if len(errs) == len(gameMasters) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		fmt.Printf("Failed to whisper to a GM of chat %d: %v\n", chatID, err)
+	}
+	return nil
+}
+
+func (c *Client) gmRollCommand(ctx context.Context, msg *models.Message, args string) (string, error) {
+	if args == "" {
+		return "Usage: /gmroll <dice expression or macro>, e.g. /gmroll 1d20+4 or /gmroll bob.attack, the result is sent privately to the GM", nil
+	}
+	response, err := c.dice.SecretRoll(ctx, args)
+	if err != nil {
+		return fmt.Sprintf("Couldn't roll %s secretly: %v", args, err), nil
+	}
+	return response, nil
+}
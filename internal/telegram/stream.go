@@ -0,0 +1,191 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// streamPlaceholder is the text of the reply posted before the first chunk arrives.
+	streamPlaceholder = "..."
+
+	// streamEditInterval is the minimum time between two edits of a streaming reply,
+	// to stay under Telegram's rate limits.
+	streamEditInterval = time.Second
+
+	// typingInterval is how often the "typing" chat action is refreshed; Telegram
+	// clears it after about five seconds.
+	typingInterval = 4 * time.Second
+)
+
+// streamEditor progressively edits a placeholder message with the latest text.
+type streamEditor struct {
+	client    *Client
+	chatID    int64
+	messageID int
+	lock      sync.Mutex
+	latest    string
+	shown     string
+	done      chan struct{}
+	finished  sync.WaitGroup
+}
+
+// streamReply sends text to the AI and progressively edits a placeholder
+// reply as the answer streams in, while showing the "typing" chat action.
+func (c *Client) streamReply(ctx context.Context, update *models.Update, text string) {
+	chatID := update.Message.Chat.ID
+	replyParams := replyParameters(update)
+
+	stopTyping := c.keepTyping(ctx, chatID)
+	defer stopTyping()
+
+	placeholder, err := c.bot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          chatID,
+		ReplyParameters: replyParams,
+		Text:            streamPlaceholder,
+	})
+	if err != nil {
+		fmt.Printf("Failed to send placeholder, replying without streaming: %v\n", err)
+		response, err := c.ai.SendMessage(ctx, chatID, text)
+		if err != nil {
+			fmt.Printf("Failed to send message: %v\n", err)
+			response = "Sorry, something went wrong."
+		}
+		c.reply(ctx, update, response)
+		return
+	}
+
+	editor := &streamEditor{
+		client:    c,
+		chatID:    chatID,
+		messageID: placeholder.ID,
+		done:      make(chan struct{}),
+	}
+	editor.finished.Add(1)
+	go editor.run(ctx)
+
+	response, err := c.ai.SendMessageStream(ctx, chatID, text, editor.update)
+	editor.stop()
+	if err != nil {
+		fmt.Printf("Failed to send message: %v\n", err)
+		response = "Sorry, something went wrong."
+	}
+
+	err = c.finishStream(ctx, chatID, placeholder.ID, response)
+	if err != nil {
+		fmt.Printf("Failed to finish streaming reply: %v\n", err)
+	}
+}
+
+// finishStream replaces the placeholder with the final response, sending any
+// overflow as extra messages or as a document.
+func (c *Client) finishStream(ctx context.Context, chatID int64, messageID int, response string) error {
+	chunks := splitMessage(response, maxChunkLength)
+	if len(chunks) == 0 {
+		chunks = []string{"Sorry, something went wrong."}
+	}
+	if len(chunks) > maxReplyMessages {
+		err := c.editChunk(ctx, chatID, messageID, "The reply is too long, sending it as a document.")
+		if err != nil {
+			return err
+		}
+		return c.sendDocument(ctx, chatID, &models.ReplyParameters{MessageID: messageID}, response)
+	}
+
+	err := c.editChunk(ctx, chatID, messageID, chunks[0])
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks[1:] {
+		err = c.sendChunk(ctx, chatID, nil, chunk)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepTyping shows the "typing" chat action until the returned function is called.
+func (c *Client) keepTyping(ctx context.Context, chatID int64) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(typingInterval)
+		defer ticker.Stop()
+		for {
+			_, err := c.bot.SendChatAction(ctx, &bot.SendChatActionParams{
+				ChatID: chatID,
+				Action: models.ChatActionTyping,
+			})
+			if err != nil {
+				fmt.Printf("Failed to send typing action: %v\n", err)
+			}
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// update records the text generated so far; it is called from the AI client.
+func (e *streamEditor) update(text string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.latest = text
+}
+
+func (e *streamEditor) run(ctx context.Context) {
+	defer e.finished.Done()
+	ticker := time.NewTicker(streamEditInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.flush(ctx)
+		}
+	}
+}
+
+func (e *streamEditor) flush(ctx context.Context) {
+	e.lock.Lock()
+	latest := e.latest
+	e.lock.Unlock()
+
+	if latest == "" || latest == e.shown {
+		return
+	}
+	text := latest
+	if textLength(text) > maxChunkLength {
+		text = text[:cutIndex(text, maxChunkLength)] + "..."
+	}
+
+	_, err := e.client.bot.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    e.chatID,
+		MessageID: e.messageID,
+		Text:      text,
+	})
+	if err != nil {
+		fmt.Printf("Failed to edit streaming reply: %v\n", err)
+		return
+	}
+	e.shown = latest
+}
+
+// stop ends the progressive edits and waits for any edit in flight.
+func (e *streamEditor) stop() {
+	close(e.done)
+	e.finished.Wait()
+}
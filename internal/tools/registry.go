@@ -0,0 +1,97 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gtrindade/ultra-kiew/internal/auth"
+	"google.golang.org/genai"
+)
+
+// Function is the handler of a tool, called with the arguments chosen by the
+// model. ctx carries the caller's auth.Identity, including the chat the call
+// belongs to, and the deadline of the call.
+type Function func(ctx context.Context, args map[string]any) (string, error)
+
+// Tool is a function the model can call.
+type Tool struct {
+	// Declaration is the schema shown to the model; its name identifies the tool.
+	Declaration *genai.FunctionDeclaration
+	// Handler runs the tool.
+	Handler Function
+	// Role is the role needed to call the tool, and to enable or disable it.
+	Role auth.Role
+	// ActionRoles raises the role needed for some values of the "action" argument.
+	ActionRoles map[string]auth.Role
+	// DefaultEnabled tells whether the tool is available in chats that never toggled it.
+	DefaultEnabled bool
+}
+
+// Name returns the name the model uses to call the tool.
+func (t *Tool) Name() string {
+	return t.Declaration.Name
+}
+
+// RequiredRole returns the role needed to call the tool with args.
+func (t *Tool) RequiredRole(args map[string]any) auth.Role {
+	required := t.Role
+	if action, ok := args["action"].(string); ok {
+		if role, ok := t.ActionRoles[action]; ok && role > required {
+			required = role
+		}
+	}
+	return required
+}
+
+// Registry holds every tool known to the bot.
+type Registry struct {
+	lock  sync.RWMutex
+	tools map[string]*Tool
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		tools: make(map[string]*Tool),
+	}
+}
+
+// Register adds a tool to the registry, replacing any tool with the same name.
+func (r *Registry) Register(tool *Tool) error {
+	if tool == nil || tool.Declaration == nil || tool.Declaration.Name == "" {
+		return errors.New("tool declaration is missing or has no name")
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("handler for tool %s is not defined", tool.Name())
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.tools[tool.Name()] = tool
+	return nil
+}
+
+// Get returns the tool with the given name.
+func (r *Registry) Get(name string) (*Tool, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// List returns every registered tool, sorted by name.
+func (r *Registry) List() []*Tool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	tools := make([]*Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name() < tools[j].Name()
+	})
+	return tools
+}
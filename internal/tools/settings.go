@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+	"google.golang.org/genai"
+)
+
+const (
+	// SettingsFile is the name of the file where a chat's tool settings are stored.
+	SettingsFile = "tool-settings-%d.json"
+)
+
+// Settings stores which tools each chat has enabled or disabled.
+type Settings struct {
+	registry *Registry
+	storage  *storage.Client
+	lock     sync.Mutex
+	chats    map[int64]map[string]bool
+}
+
+// NewSettings creates a per-chat settings store for the tools in registry.
+func NewSettings(registry *Registry, storageClient *storage.Client) *Settings {
+	return &Settings{
+		registry: registry,
+		storage:  storageClient,
+		chats:    make(map[int64]map[string]bool),
+	}
+}
+
+// getOverrides returns the tools a chat toggled, loading them on first use.
+// The caller must hold s.lock.
+func (s *Settings) getOverrides(chatID int64) map[string]bool {
+	overrides, exists := s.chats[chatID]
+	if exists {
+		return overrides
+	}
+	overrides = make(map[string]bool)
+	if chatID != 0 {
+		err := s.storage.LoadFromDB(fmt.Sprintf(SettingsFile, chatID), &overrides)
+		if err != nil {
+			fmt.Printf("Failed to load tool settings for chat %d: %v\n", chatID, err)
+		}
+	}
+	s.chats[chatID] = overrides
+	return overrides
+}
+
+// Enabled tells whether a tool is enabled in a chat.
+func (s *Settings) Enabled(chatID int64, tool *Tool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	enabled, exists := s.getOverrides(chatID)[tool.Name()]
+	if !exists {
+		return tool.DefaultEnabled
+	}
+	return enabled
+}
+
+// SetEnabled enables or disables a tool in a chat.
+func (s *Settings) SetEnabled(chatID int64, name string, enabled bool) error {
+	if _, ok := s.registry.Get(name); !ok {
+		return fmt.Errorf("unknown tool %q", name)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	overrides := s.getOverrides(chatID)
+	overrides[name] = enabled
+	return s.storage.SaveToDB(fmt.Sprintf(SettingsFile, chatID), maps.Clone(overrides))
+}
+
+// Tools returns every registered tool, sorted by name.
+func (s *Settings) Tools() []*Tool {
+	return s.registry.List()
+}
+
+// EnabledTools returns the tools enabled in a chat, sorted by name.
+func (s *Settings) EnabledTools(chatID int64) []*Tool {
+	var enabled []*Tool
+	for _, tool := range s.registry.List() {
+		if s.Enabled(chatID, tool) {
+			enabled = append(enabled, tool)
+		}
+	}
+	return enabled
+}
+
+// Declarations returns the model-facing tools enabled in a chat.
+func (s *Settings) Declarations(chatID int64) []*genai.Tool {
+	enabled := s.EnabledTools(chatID)
+	if len(enabled) == 0 {
+		return nil
+	}
+	declarations := make([]*genai.FunctionDeclaration, 0, len(enabled))
+	for _, tool := range enabled {
+		declarations = append(declarations, tool.Declaration)
+	}
+	return []*genai.Tool{{FunctionDeclarations: declarations}}
+}
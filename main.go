@@ -2,14 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
 
+	"github.com/gtrindade/ultra-kiew/internal/backup"
+	"github.com/gtrindade/ultra-kiew/internal/combat"
 	"github.com/gtrindade/ultra-kiew/internal/config"
 	"github.com/gtrindade/ultra-kiew/internal/diceroller"
 	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
 	"github.com/gtrindade/ultra-kiew/internal/mysql"
 	"github.com/gtrindade/ultra-kiew/internal/storage"
 	"github.com/gtrindade/ultra-kiew/internal/telegram"
+	"github.com/gtrindade/ultra-kiew/internal/tools"
 )
 
 func main() {
@@ -20,29 +25,133 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			err = restore(config, os.Args[2:])
+		case "rotate-key":
+			err = rotateKey(config, os.Args[2:])
+		case "repl":
+			err = runREPL(ctx, config, os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q, use restore, rotate-key, repl or no command to run the bot", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	provider, err := googlegenai.NewGeminiProvider(ctx, config.GeminiAPIKey)
+	if err != nil {
+		log.Fatalf("failed to create Gemini provider: %v", err)
+	}
+
 	dbClient, err := mysql.NewMySQLClient(config)
 	if err != nil {
-		log.Fatalf("Failed to create MySQL client: %v", err)
+		log.Fatalf("failed to create MySQL client: %v", err)
 	}
-	defer dbClient.Close()
 
-	toolConfigs := map[string]*googlegenai.ToolConfig{
-		diceroller.RollDice: {
-			Function: diceroller.RollWithArgs,
-			Tool:     diceroller.GetToolConfig(),
-		},
+	store, err := storage.Open(config.Storage)
+	if err != nil {
+		dbClient.Close()
+		log.Fatalf("failed to open storage: %v", err)
 	}
 
-	storageClient := storage.NewClient()
-	aiClient, err := googlegenai.NewClient(ctx, toolConfigs, storageClient, dbClient, config)
+	services, err := newServices(ctx, config, provider, store, dbClient)
 	if err != nil {
-		log.Fatalf("failed to create Google GenAI client: %v", err)
+		log.Fatal(err)
 	}
 
-	botClient, err := telegram.NewBot(config, aiClient, storageClient)
+	backups, err := backup.NewManager(config.Backup, services.storage)
 	if err != nil {
+		services.Close()
+		log.Fatalf("failed to configure backups: %v", err)
+	}
+
+	botClient, err := telegram.NewBot(config, services.ai, services.dice, services.combat, services.db, services.storage, backups)
+	if err != nil {
+		services.Close()
 		log.Fatalf("failed to create Telegram bot: %v", err)
 	}
 
+	services.dice.SetWhisperer(botClient)
+
+	backupCtx, stopBackups := context.WithCancel(ctx)
+	go backups.Run(backupCtx)
+
 	botClient.Start(ctx)
+	stopBackups()
+
+	services.Close()
+}
+
+// services are the clients shared by the Telegram bot and the REPL.
+type services struct {
+	db      *mysql.Client
+	storage *storage.Client
+	dice    *diceroller.Client
+	ai      *googlegenai.Client
+	combat  *combat.Tracker
+}
+
+// newServices wires the clients on top of store and dbClient, with the AI
+// talking to provider. dbClient may be nil, leaving out the rules lookups.
+// The services own store and dbClient from then on, closing them on failure.
+func newServices(ctx context.Context, config *config.Config, provider googlegenai.Provider, store storage.Store, dbClient *mysql.Client) (*services, error) {
+	s := &services{db: dbClient, storage: storage.NewClient(store)}
+
+	s.dice = diceroller.NewClient(s.storage, nil)
+
+	registry := tools.NewRegistry()
+	err := registry.Register(s.dice.GetTool())
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to register dice tool: %w", err)
+	}
+	err = registry.Register(s.dice.GetStatsTool())
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to register dice stats tool: %w", err)
+	}
+	err = registry.Register(s.dice.GetOddsTool())
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to register dice odds tool: %w", err)
+	}
+	toolSettings := tools.NewSettings(registry, s.storage)
+
+	s.ai, err = googlegenai.NewClient(ctx, provider, registry, toolSettings, s.storage, dbClient, config)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to create Google GenAI client: %w", err)
+	}
+	s.dice.SetProperties(s.ai)
+
+	// A nil *mysql.Client would make a non-nil Monsters, so pass nil explicitly.
+	var monsters combat.Monsters
+	if dbClient != nil {
+		monsters = dbClient
+	}
+	s.combat = combat.NewTracker(s.storage, s.dice, monsters, s.ai)
+	err = registry.Register(s.combat.GetTool())
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to register combat tool: %w", err)
+	}
+
+	return s, nil
+}
+
+// Close saves pending data and disconnects from the storage and the databases.
+func (s *services) Close() {
+	if err := s.storage.Close(); err != nil {
+		log.Printf("failed to close storage: %v", err)
+	}
+	if s.db == nil {
+		return
+	}
+	if err := s.db.Close(); err != nil {
+		log.Printf("failed to close MySQL client: %v", err)
+	}
 }
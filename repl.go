@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/gtrindade/ultra-kiew/internal/chathistory"
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/googlegenai"
+	"github.com/gtrindade/ultra-kiew/internal/mysql"
+	"github.com/gtrindade/ultra-kiew/internal/repl"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+// replChatID is the chat the REPL sends to by default, a private chat that no
+// Telegram chat can be, as their IDs have at most 52 significant bits.
+const replChatID int64 = 1 << 53
+
+// scriptedResponse is a response of the offline model in a -script file,
+// either text or a call to a tool.
+type scriptedResponse struct {
+	Text string         `json:"text"`
+	Call string         `json:"call"`
+	Args map[string]any `json:"args"`
+}
+
+// runREPL sends the lines read from stdin to the model like Telegram messages
+// and prints the replies, to debug prompts and tools without Telegram.
+func runREPL(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	userName := flags.String("user", "local", "user name to send messages as")
+	userID := flags.Int64("user-id", 1, "Telegram user ID to send messages as, which sets the role")
+	chatID := flags.Int64("chat", replChatID, "chat to send messages to, a private chat that is not a real Telegram one by default; negative IDs are groups, where only messages mentioning the bot get replies")
+	dataDir := flags.String("data", "", "directory to keep the REPL state in between runs, a temporary one removed on exit by default; never the bot's own data")
+	useDB := flags.Bool("db", false, "connect to the MySQL databases of the config for the rules lookups")
+	outPath := flags.String("out", "", "file to write the conversation to instead of stdout, keeping it apart from the logs")
+	fake := flags.Bool("fake", false, "use an offline model that echoes what it is sent instead of Gemini")
+	script := flags.String("script", "", "JSON file with a list of responses for the offline model to replay, like [{\"text\": \"hi\"}, {\"call\": \"roll_dice\", \"args\": {...}}]; implies -fake")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s repl [flags] < messages\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *outPath, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	var provider googlegenai.Provider
+	if *fake || *script != "" {
+		responses, err := loadScript(*script)
+		if err != nil {
+			return err
+		}
+		provider = googlegenai.NewFakeProvider(responses...)
+	} else {
+		var err error
+		provider, err = googlegenai.NewGeminiProvider(ctx, cfg.GeminiAPIKey)
+		if err != nil {
+			return fmt.Errorf("failed to create Gemini provider: %w", err)
+		}
+	}
+
+	store, cleanup, err := openREPLStore(*dataDir)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var dbClient *mysql.Client
+	if *useDB {
+		dbClient, err = mysql.NewMySQLClient(cfg)
+		if err != nil {
+			store.Close()
+			return fmt.Errorf("failed to create MySQL client: %w", err)
+		}
+	}
+
+	services, err := newServices(ctx, cfg, provider, store, dbClient)
+	if err != nil {
+		return err
+	}
+	defer services.Close()
+
+	history, err := chathistory.New(services.storage, cfg.BotName)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	r := repl.New(cfg, services.ai, history, repl.Options{
+		UserName: *userName,
+		UserID:   *userID,
+		ChatID:   *chatID,
+	})
+	return r.Run(ctx, os.Stdin, out)
+}
+
+// openREPLStore opens the files under dir as the REPL's store, or under a new
+// temporary directory when dir is empty. cleanup removes the temporary
+// directory, and must run after the store is closed.
+func openREPLStore(dir string) (storage.Store, func(), error) {
+	if dir != "" {
+		if filepath.Clean(dir) == filepath.Clean(storage.BasePath) {
+			return nil, nil, fmt.Errorf("the REPL can't use the bot's data in %s, pick another directory", storage.BasePath)
+		}
+		return storage.NewFileStore(dir), func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "ultra-kiew-repl-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("Failed to remove %s: %v\n", dir, err)
+		}
+	}
+	return storage.NewFileStore(dir), cleanup, nil
+}
+
+// loadScript reads the responses of a -script file, if any.
+func loadScript(path string) ([]*googlegenai.Response, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script %s: %w", path, err)
+	}
+	var scripted []*scriptedResponse
+	if err := json.Unmarshal(data, &scripted); err != nil {
+		return nil, fmt.Errorf("failed to decode script %s: %w", path, err)
+	}
+
+	responses := make([]*googlegenai.Response, len(scripted))
+	for i, response := range scripted {
+		if response.Call != "" {
+			responses[i] = googlegenai.FakeFunctionCall(response.Call, response.Args)
+		} else {
+			responses[i] = googlegenai.FakeText(response.Text)
+		}
+	}
+	return responses, nil
+}
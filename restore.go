@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gtrindade/ultra-kiew/internal/backup"
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+// restore validates a backup and replaces the bot state with it, or lists the
+// backups when none is named. The bot must be stopped first.
+func restore(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	check := flags.Bool("check", false, "only validate the backup, without restoring it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s restore [-check] [backup name]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	storageClient := storage.NewClient(store)
+	defer storageClient.Close()
+
+	backups, err := backup.NewManager(cfg.Backup, storageClient)
+	if err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		snapshots, err := backups.Snapshots()
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			fmt.Println("There are no backups yet.")
+			return nil
+		}
+		fmt.Println("Backups, newest first:")
+		for _, snapshot := range snapshots {
+			fmt.Printf("- %s\n", snapshot)
+		}
+		return nil
+	}
+
+	name := flags.Arg(0)
+	if *check {
+		files, err := backups.Validate(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup %s is valid, with %d files\n", name, len(files))
+		return nil
+	}
+
+	previous, err := backups.Restore(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup %s. The state it replaced was saved to %s\n", name, previous.Name)
+	return nil
+}
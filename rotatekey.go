@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gtrindade/ultra-kiew/internal/backup"
+	"github.com/gtrindade/ultra-kiew/internal/config"
+	"github.com/gtrindade/ultra-kiew/internal/storage"
+)
+
+// rotateKey encrypts the stored state and the backups again with the current
+// encryption key, so the old keys can be dropped, or prints a new key. The
+// bot must be stopped first.
+func rotateKey(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	generate := flags.Bool("generate", false, "print a new random key and exit")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s rotate-key [-generate]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *generate {
+		fmt.Println(storage.GenerateKey())
+		return nil
+	}
+
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	storageClient := storage.NewClient(store)
+	defer storageClient.Close()
+
+	encrypted, ok := store.(*storage.EncryptedStore)
+	if !ok {
+		return fmt.Errorf("storage encryption is disabled, set storage.encryption_key or %s first", config.EncryptionKeyEnv)
+	}
+
+	count, err := encrypted.Rotate(storage.DBPath + "/")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the stored state: %w", err)
+	}
+	fmt.Printf("Encrypted %d files with the current key\n", count)
+
+	backups, err := backup.NewManager(cfg.Backup, storageClient)
+	if err != nil {
+		return err
+	}
+	count, err = backups.Reencrypt()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the backups: %w", err)
+	}
+	fmt.Printf("Encrypted %d backups with the current key. The old keys can be removed now.\n", count)
+	return nil
+}